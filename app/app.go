@@ -1,17 +1,33 @@
 package app
 
 import (
+	"cmp"
+	"context"
 	"errors"
+	"fmt"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/romanWienicke/go-app-test/events"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/logging"
+	"github.com/romanWienicke/go-app-test/foundation/money"
 	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/ingest"
+	"github.com/romanWienicke/go-app-test/outbox"
 	"github.com/romanWienicke/go-app-test/rest"
+	apiKeyService "github.com/romanWienicke/go-app-test/service/apikey"
 	customerService "github.com/romanWienicke/go-app-test/service/customer"
 	orderService "github.com/romanWienicke/go-app-test/service/order"
 	productService "github.com/romanWienicke/go-app-test/service/product"
 	userService "github.com/romanWienicke/go-app-test/service/user"
+	webhookService "github.com/romanWienicke/go-app-test/service/webhook"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -19,10 +35,20 @@ import (
 
 type app struct {
 	db              *postgres.Db
+	authConfig      auth.Config
+	verifier        *auth.Verifier
+	signer          *auth.Signer
 	userService     *userService.UserService
 	orderService    *orderService.OrderService
 	customerService *customerService.CustomerService
 	productService  *productService.ProductService
+	apiKeyService   *apiKeyService.APIKeyService
+	webhookService  *webhookService.WebhookService
+	publisher       *events.KafkaPublisher
+	outbox          *outbox.Outbox
+	ingestReader    *ingest.KafkaReader
+	deadLetters     *ingest.KafkaWriter
+	orderConsumer   *ingest.OrderConsumer
 }
 
 var logger zerolog.Logger
@@ -45,49 +71,348 @@ func (a *app) runServer() {
 	if port == "" {
 		port = "8080"
 	}
-	// Start the REST server in a goroutine
 
+	cfg := rest.Config{
+		Port:             port,
+		CORSAllowOrigins: envList("CORS_ALLOW_ORIGINS"),
+		TrustedProxies:   envList("TRUSTED_PROXIES"),
+		MaxBodySize:      os.Getenv("MAX_BODY_SIZE"),
+		ReadTimeout:      envDuration("HTTP_READ_TIMEOUT"),
+		WriteTimeout:     envDuration("HTTP_WRITE_TIMEOUT"),
+		IdleTimeout:      envDuration("HTTP_IDLE_TIMEOUT"),
+		HandlerTimeout:   envDuration("HANDLER_TIMEOUT"),
+		Auth: &rest.AuthConfig{
+			Verifier:     a.verifier,
+			APIKeys:      a.apiKeyService,
+			PublicRoutes: append(slices.Clone(rest.DefaultPublicRoutes), a.userService.PublicRoutes()...),
+		},
+		Tenant: &rest.TenantConfig{
+			Domain:         os.Getenv("TENANT_DOMAIN"),
+			Default:        defaultTenant(),
+			Exists:         a.tenantExists,
+			OptionalRoutes: rest.DefaultPublicRoutes,
+		},
+		OpenAPI: &rest.OpenAPIConfig{
+			SpecFile:          os.Getenv("OPENAPI_SPEC"),
+			ValidateResponses: os.Getenv("OPENAPI_VALIDATE_RESPONSES") == "true",
+		},
+	}
+	if certFile := os.Getenv("TLS_CERT_FILE"); certFile != "" {
+		cfg.TLS = &rest.TLSConfig{
+			CertFile:          certFile,
+			KeyFile:           os.Getenv("TLS_KEY_FILE"),
+			ReloadInterval:    envDuration("TLS_RELOAD_INTERVAL"),
+			ClientCAFile:      os.Getenv("TLS_CLIENT_CA_FILE"),
+			RequireClientCert: os.Getenv("TLS_REQUIRE_CLIENT_CERT") == "true",
+		}
+	}
+	cfg.H2C = os.Getenv("HTTP_H2C") == "true"
+	if cfg.OpenAPI.SpecFile == "" {
+		cfg.OpenAPI.SpecFile = "../api/openapi.yaml"
+	}
+
+	// bulk imports stream large bodies and outlast the regular limits
+	bulkBodySize := os.Getenv("BULK_MAX_BODY_SIZE")
+	if bulkBodySize == "" {
+		bulkBodySize = "256M"
+	}
+	bulkTimeout := envDuration("BULK_TIMEOUT")
+	if bulkTimeout == 0 {
+		bulkTimeout = 10 * time.Minute
+	}
+	cfg.BodyLimits = map[string]string{}
+	cfg.HandlerTimeouts = map[string]time.Duration{}
+	for _, route := range bulkRoutes {
+		cfg.BodyLimits[route] = bulkBodySize
+		cfg.HandlerTimeouts[route] = bulkTimeout
+	}
+	// exports and event streams run until done or until the client goes away
+	for _, route := range slices.Concat(exportRoutes, eventRoutes) {
+		cfg.HandlerTimeouts[route] = 0
+	}
+	cfg.Exports = &rest.ExportLimitConfig{
+		Routes:      exportRoutes,
+		PerClient:   envInt("EXPORT_MAX_PER_CLIENT"),
+		Total:       envInt("EXPORT_MAX_CONCURRENT"),
+		MaxDuration: envDuration("EXPORT_MAX_DURATION"),
+	}
+
+	if os.Getenv("COMPRESSION") != "off" {
+		cfg.Compression = &rest.CompressConfig{
+			MinSize:    envInt("COMPRESSION_MIN_SIZE"),
+			SkipRoutes: envList("COMPRESSION_SKIP_ROUTES"),
+		}
+	}
+
+	if os.Getenv("ACCESS_LOG") != "off" {
+		cfg.AccessLog = &rest.AccessLogConfig{SampleRate: envFloat("ACCESS_LOG_SAMPLE_RATE", 1)}
+	}
+
+	moneyFormat, err := money.ParseFormat(os.Getenv("MONEY_JSON_FORMAT"))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid MONEY_JSON_FORMAT")
+	}
+	money.SetJSONFormat(moneyFormat)
+
+	// the workers stop with the server, pending deliveries and events are picked up after a restart
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	rateLimit, err := a.rateLimitConfig(workerCtx)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid rate limit configuration")
+	}
+	cfg.RateLimit = rateLimit
+
+	rpc := rest.NewRPC(&logger,
+		a.customerService.RPCMethods(),
+		a.productService.RPCMethods(),
+		a.orderService.RPCMethods(),
+	)
+
+	server, err := rest.NewServer(cfg, &logger,
+		a.userService.RouteAdder(),
+		a.orderService.RouteAdder(),
+		a.customerService.RouteAdder(),
+		a.productService.RouteAdder(),
+		a.apiKeyService.RouteAdder(),
+		a.webhookService.RouteAdder(),
+		rpc.RouteAdder())
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create server")
+	}
+
+	// Start the REST server in a goroutine
 	go func() {
-		if err := rest.NewServer(port,
-			a.userService.RouteAdder(),
-			a.orderService.RouteAdder(),
-			a.customerService.RouteAdder(),
-			a.productService.RouteAdder()); err != nil {
+		if err := server.Start(); err != nil {
 			logger.Fatal().Err(err).Msg("Server failed")
 		}
 	}()
 
+	admin := a.startAdminServer(server)
+
+	go a.webhookService.Run(workerCtx)
+	go a.apiKeyService.RunUsage(workerCtx, envDuration("APIKEY_USAGE_INTERVAL"))
+	if a.outbox != nil {
+		go a.outbox.Run(workerCtx, a.publisher)
+	}
+	consumerDone := make(chan struct{})
+	if a.orderConsumer != nil {
+		go func() {
+			defer close(consumerDone)
+			if err := a.orderConsumer.Run(workerCtx); err != nil {
+				logger.Error().Err(err).Msg("Order ingestion stopped")
+			}
+		}()
+	} else {
+		close(consumerDone)
+	}
+
 	// Create a channel to listen for interrupt or terminate signals
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 
 	logger.Info().Msg("Shutting down gracefully...")
+	stopWorkers()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error().Err(err).Msg("Error during server shutdown")
+	}
+	// the consumer finishes its message before Close leaves the consumer group
+	select {
+	case <-consumerDone:
+	case <-ctx.Done():
+	}
+	if admin != nil {
+		if err := admin.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Msg("Error during admin server shutdown")
+		}
+	}
+	if err := a.apiKeyService.FlushUsage(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to record API key usage")
+	}
 	if err := a.Close(); err != nil {
 		logger.Error().Err(err).Msg("Error during shutdown")
 	}
 }
 
-func (a *app) Close() error {
-	if a.db == nil {
+// bulkRoutes are the NDJSON import routes.
+var bulkRoutes = []string{"POST /customer:bulk", "POST /product:bulk", "POST /order:bulk"}
+
+// exportRoutes stream their results and run without handler deadline, bounded by the export limits.
+var exportRoutes = []string{"GET /customer/export", "GET /order/export"}
+
+// eventRoutes stream Server-Sent Events.
+var eventRoutes = []string{"GET /order/events", "GET /order/:id/events"}
+
+// configKeys are the environment variables shown (masked) on the admin server.
+var configKeys = []string{
+	"HTTP_PORT", "ADMIN_PORT", "ADMIN_USER", "ADMIN_PASSWORD",
+	"DB_HOST", "DB_PORT", "DB_USER", "DB_PASSWORD", "DB_NAME",
+	"JWT_SECRET", "JWT_JWKS_FILE", "JWT_PRIVATE_KEY_FILE", "JWT_KEY_ID", "JWT_ISSUER", "JWT_AUDIENCE",
+	"JWT_ACCESS_TTL", "JWT_REFRESH_TTL", "LOGIN_MAX_FAILURES", "LOGIN_LOCKOUT",
+	"OPENAPI_SPEC", "OPENAPI_VALIDATE_RESPONSES",
+	"RATE_LIMIT", "RATE_LIMIT_IP", "RATE_LIMIT_ROUTES", "RATE_LIMIT_STORE", "APIKEY_USAGE_INTERVAL",
+	"CORS_ALLOW_ORIGINS", "TRUSTED_PROXIES", "MAX_BODY_SIZE", "HANDLER_TIMEOUT",
+	"HTTP_READ_TIMEOUT", "HTTP_WRITE_TIMEOUT", "HTTP_IDLE_TIMEOUT",
+	"BULK_MAX_BODY_SIZE", "BULK_TIMEOUT", "EXPORT_MAX_PER_CLIENT", "EXPORT_MAX_CONCURRENT", "EXPORT_MAX_DURATION",
+	"COMPRESSION", "COMPRESSION_MIN_SIZE", "COMPRESSION_SKIP_ROUTES",
+	"ACCESS_LOG", "ACCESS_LOG_SAMPLE_RATE",
+	"ORDER_EVENTS_MAX_SUBSCRIBERS", "ORDER_EVENTS_HEARTBEAT",
+	"WEBHOOK_POLL_INTERVAL", "WEBHOOK_BATCH_SIZE", "WEBHOOK_TIMEOUT", "WEBHOOK_MAX_ATTEMPTS",
+	"WEBHOOK_BACKOFF_BASE", "WEBHOOK_BACKOFF_MAX", "WEBHOOK_ALLOW_HTTP", "WEBHOOK_ALLOW_PRIVATE_NETWORKS",
+	"KAFKA_BROKERS", "KAFKA_TOPIC",
+	"OUTBOX_POLL_INTERVAL", "OUTBOX_BATCH_SIZE", "OUTBOX_RETENTION",
+	"ORDER_INGEST_TOPIC", "ORDER_INGEST_GROUP", "ORDER_INGEST_DLQ_TOPIC", "ORDER_INGEST_TENANT", "ORDER_INGEST_TENANTS",
+	"TENANT_DOMAIN", "TENANT_DEFAULT", "MONEY_JSON_FORMAT",
+	"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_RELOAD_INTERVAL", "TLS_CLIENT_CA_FILE", "TLS_REQUIRE_CLIENT_CERT", "HTTP_H2C",
+}
+
+// startAdminServer starts the admin server on ADMIN_PORT, guarded by ADMIN_USER and
+// ADMIN_PASSWORD. Without a password the admin server stays off.
+func (a *app) startAdminServer(api *rest.Server) *rest.Server {
+	if os.Getenv("ADMIN_PASSWORD") == "" {
+		logger.Warn().Msg("ADMIN_PASSWORD not set, admin server disabled")
 		return nil
 	}
-	return a.db.Close()
+
+	config := make(map[string]string, len(configKeys))
+	for _, key := range configKeys {
+		config[key] = os.Getenv(key)
+	}
+
+	cfg := rest.AdminConfig{
+		Port:     os.Getenv("ADMIN_PORT"),
+		Username: os.Getenv("ADMIN_USER"),
+		Password: os.Getenv("ADMIN_PASSWORD"),
+		Config:   config,
+	}
+	if cfg.Port == "" {
+		cfg.Port = "8081"
+	}
+	if a.db != nil {
+		cfg.DBStats = a.db.GetDB().Stats
+	}
+
+	admin, err := rest.NewAdminServer(cfg, &logger, api)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create admin server")
+	}
+	go func() {
+		if err := admin.Start(); err != nil {
+			logger.Fatal().Err(err).Msg("Admin server failed")
+		}
+	}()
+	return admin
+}
+
+// loginLimit throttles password guessing per client IP, which also slows down locking accounts
+// of others.
+var loginLimit = rest.Limit{Rate: 0.1, Burst: 10}
+
+// rateLimitConfig reads RATE_LIMIT (rate:burst per client), RATE_LIMIT_IP (rate:burst per IP
+// ahead of authentication), RATE_LIMIT_ROUTES (per route overrides like "POST /order=5:10", on top
+// of loginLimit) and RATE_LIMIT_STORE (memory or postgres). The cleanup of the postgres store runs until ctx is done.
+func (a *app) rateLimitConfig(ctx context.Context) (*rest.RateLimitConfig, error) {
+	cfg := &rest.RateLimitConfig{Default: rest.Limit{Rate: 20, Burst: 40}, IP: rest.Limit{Rate: 50, Burst: 100}}
+
+	if v := os.Getenv("RATE_LIMIT"); v != "" {
+		limit, err := rest.ParseLimit(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Default = limit
+	}
+	if v := os.Getenv("RATE_LIMIT_IP"); v != "" {
+		limit, err := rest.ParseLimit(v)
+		if err != nil {
+			return nil, err
+		}
+		cfg.IP = limit
+	}
+
+	routes, err := rest.ParseRouteLimits(os.Getenv("RATE_LIMIT_ROUTES"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Routes = map[string]rest.Limit{"POST /auth/login": loginLimit}
+	maps.Copy(cfg.Routes, routes)
+
+	switch os.Getenv("RATE_LIMIT_STORE") {
+	case "", "memory":
+		cfg.Store = rest.NewMemoryRateLimitStore()
+	case "postgres":
+		store := rest.NewPostgresRateLimitStore(a.db)
+		go store.RunCleanup(ctx, 10*time.Minute, time.Hour, &logger)
+		cfg.Store = store
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q", os.Getenv("RATE_LIMIT_STORE"))
+	}
+
+	return cfg, nil
+}
+
+func (a *app) Close() error {
+	var errs error
+	if a.ingestReader != nil {
+		errs = errors.Join(errs, a.ingestReader.Close())
+	}
+	if a.deadLetters != nil {
+		errs = errors.Join(errs, a.deadLetters.Close())
+	}
+	if a.publisher != nil {
+		errs = errors.Join(errs, a.publisher.Close())
+	}
+	if a.db != nil {
+		errs = errors.Join(errs, a.db.Close())
+	}
+	return errs
 }
 
 func (a *app) init() error {
 	var errs error
 
-	logger = zerolog.New(os.Stderr)
+	// customer names and e-mail addresses never reach the logs
+	logger = zerolog.New(logging.NewRedactingWriter(os.Stderr, logging.DefaultRedactedFields...)).
+		With().Timestamp().Logger()
 	zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
 
 	errs = errors.Join(errs, a.initPostgres())
+	errs = errors.Join(errs, a.initAuth())
 
-	a.userService = userService.NewUserService(a.db, &logger)
+	a.userService = userService.NewUserService(a.db, &logger, userService.AuthConfig{
+		Signer:          a.signer,
+		Issuer:          a.authConfig.Issuer,
+		Audience:        a.authConfig.Audience,
+		AccessTokenTTL:  envDuration("JWT_ACCESS_TTL"),
+		RefreshTokenTTL: envDuration("JWT_REFRESH_TTL"),
+		MaxFailedLogins: envInt("LOGIN_MAX_FAILURES"),
+		LockoutDuration: envDuration("LOGIN_LOCKOUT"),
+	})
 	a.orderService = orderService.NewOrderService(a.db, &logger)
+	a.orderService.ConfigureEvents(orderService.EventConfig{
+		MaxSubscribers: envInt("ORDER_EVENTS_MAX_SUBSCRIBERS"),
+		Heartbeat:      envDuration("ORDER_EVENTS_HEARTBEAT"),
+	})
 	a.customerService = customerService.NewCustomerService(a.db, &logger)
 	a.productService = productService.NewProductService(a.db, &logger)
+	a.apiKeyService = apiKeyService.NewAPIKeyService(a.db, &logger)
+	a.webhookService = webhookService.NewWebhookService(a.db, &logger, webhookService.Config{
+		PollInterval: envDuration("WEBHOOK_POLL_INTERVAL"),
+		BatchSize:    envInt("WEBHOOK_BATCH_SIZE"),
+		Timeout:      envDuration("WEBHOOK_TIMEOUT"),
+		MaxAttempts:  envInt("WEBHOOK_MAX_ATTEMPTS"),
+		BackoffBase:  envDuration("WEBHOOK_BACKOFF_BASE"),
+		BackoffMax:   envDuration("WEBHOOK_BACKOFF_MAX"),
+		AllowHTTP:    os.Getenv("WEBHOOK_ALLOW_HTTP") == "true",
+		// e.g. for partners in the same network, webhooks must not reach internal services otherwise
+		AllowPrivateNetworks: os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true",
+	})
+	a.orderService.SetNotifier(a.webhookService)
+	errs = errors.Join(errs, a.initEvents())
 	return errs
 }
 
@@ -107,3 +432,131 @@ func (a *app) initPostgres() error {
 
 	return a.db.Init("../migrations")
 }
+
+// initEvents publishes the domain events of the services to KAFKA_BROKERS, if set. The services
+// store their events in the outbox, which the relay started by runServer publishes.
+func (a *app) initEvents() error {
+	brokers := envList("KAFKA_BROKERS")
+	if len(brokers) == 0 {
+		return nil
+	}
+
+	var err error
+	a.publisher, err = events.NewKafkaPublisher(events.KafkaConfig{
+		Brokers: brokers,
+		Topic:   os.Getenv("KAFKA_TOPIC"),
+	})
+	if err != nil {
+		return err
+	}
+	a.outbox = outbox.NewOutbox(a.db, &logger, outbox.Config{
+		PollInterval: envDuration("OUTBOX_POLL_INTERVAL"),
+		BatchSize:    envInt("OUTBOX_BATCH_SIZE"),
+		Retention:    envDuration("OUTBOX_RETENTION"),
+	})
+	a.customerService.SetOutbox(a.outbox)
+	a.productService.SetOutbox(a.outbox)
+	a.orderService.SetOutbox(a.outbox)
+	return a.initIngest(brokers)
+}
+
+// initIngest creates the orders partners put on ORDER_INGEST_TOPIC, if set. Poison messages go
+// to ORDER_INGEST_DLQ_TOPIC, the topic with a ".dlq" suffix by default. Messages without
+// tenant-id header belong to ORDER_INGEST_TENANT, the default tenant by default; the header may
+// only name the tenants listed in ORDER_INGEST_TENANTS.
+func (a *app) initIngest(brokers []string) error {
+	topic := os.Getenv("ORDER_INGEST_TOPIC")
+	if topic == "" {
+		return nil
+	}
+	group := cmp.Or(os.Getenv("ORDER_INGEST_GROUP"), "order-ingest")
+	dlqTopic := cmp.Or(os.Getenv("ORDER_INGEST_DLQ_TOPIC"), topic+".dlq")
+
+	var err error
+	a.ingestReader, err = ingest.NewKafkaReader(brokers, topic, group)
+	if err != nil {
+		return err
+	}
+	a.deadLetters, err = ingest.NewKafkaWriter(brokers, dlqTopic)
+	if err != nil {
+		return err
+	}
+	a.orderConsumer = ingest.NewOrderConsumer(a.ingestReader, a.deadLetters, a.orderService, &logger, ingest.Config{
+		Tenant:  cmp.Or(os.Getenv("ORDER_INGEST_TENANT"), defaultTenant()),
+		Tenants: envList("ORDER_INGEST_TENANTS"),
+	})
+	return nil
+}
+
+// defaultTenant is TENANT_DEFAULT, "default" if unset: the tenant of requests naming none, which
+// keeps single tenant deployments working. Set it empty to require a tenant on every request.
+func defaultTenant() string {
+	if tenant, ok := os.LookupEnv("TENANT_DEFAULT"); ok {
+		return tenant
+	}
+	return "default"
+}
+
+// tenantExists reports whether the tenant is in the tenants table.
+func (a *app) tenantExists(ctx context.Context, tenant string) (bool, error) {
+	var exists bool
+	err := a.db.GetDB().GetContext(ctx, &exists, "select exists(select 1 from tenants where id=$1)", tenant)
+	return exists, err
+}
+
+func (a *app) initAuth() error {
+	a.authConfig = auth.Config{
+		Secret:         os.Getenv("JWT_SECRET"),
+		JWKSFile:       os.Getenv("JWT_JWKS_FILE"),
+		PrivateKeyFile: os.Getenv("JWT_PRIVATE_KEY_FILE"),
+		KeyID:          os.Getenv("JWT_KEY_ID"),
+		Issuer:         os.Getenv("JWT_ISSUER"),
+		Audience:       os.Getenv("JWT_AUDIENCE"),
+	}
+
+	var err error
+	a.verifier, err = auth.NewVerifier(a.authConfig)
+	if err != nil {
+		return err
+	}
+	a.signer, err = auth.NewSignerFromConfig(a.authConfig)
+	return err
+}
+
+// envDuration parses an optional duration like 15m, zero selects the default.
+func envDuration(key string) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// envList splits an optional comma separated list.
+func envList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// envInt parses an optional integer, zero selects the default.
+func envInt(key string) int {
+	i, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return 0
+	}
+	return i
+}
+
+// envFloat parses an optional float, falling back to def when unset or invalid.
+func envFloat(key string, def float64) float64 {
+	f, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
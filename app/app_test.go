@@ -1,25 +1,46 @@
 package app
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/romanWienicke/go-app-test/client"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/money"
 	test "github.com/romanWienicke/go-app-test/foundation/testing"
 	"github.com/romanWienicke/go-app-test/webtest"
 )
 
-func startServer(t *testing.T) string {
+func startServer(t *testing.T) (string, string) {
 	port, err := webtest.GetRandomOpenPort(t)
 	if err != nil || port == "" {
 		port = "8080"
 	}
+	adminPort, err := webtest.GetRandomOpenPort(t)
+	if err != nil || adminPort == "" {
+		adminPort = "8081"
+	}
+	if err := os.Setenv("ADMIN_PORT", adminPort); err != nil {
+		t.Fatalf("Failed to set ADMIN_PORT environment variable: %v", err)
+	}
+	if err := os.Setenv("ADMIN_PASSWORD", "admin-test"); err != nil {
+		t.Fatalf("Failed to set ADMIN_PASSWORD environment variable: %v", err)
+	}
 
 	if err := os.Setenv("HTTP_PORT", port); err != nil {
 		t.Fatalf("Failed to set PORT environment variable: %v", err)
 	}
+	// fail every response that drifts from the OpenAPI document
+	if err := os.Setenv("OPENAPI_VALIDATE_RESPONSES", "true"); err != nil {
+		t.Fatalf("Failed to set OPENAPI_VALIDATE_RESPONSES environment variable: %v", err)
+	}
 
 	go func() {
 		a, err := NewApp()
@@ -33,7 +54,7 @@ func startServer(t *testing.T) string {
 	// Allow some time for the server to start
 	time.Sleep(1 * time.Second)
 
-	return port
+	return port, adminPort
 }
 
 func startup(t *testing.T) {
@@ -54,24 +75,102 @@ func Test_Application(t *testing.T) {
 		test.DockerComposeDown(t, "../docker-compose.yaml")
 	})
 
-	tester := webtest.NewWebTest(startServer(t))
+	port, adminPort := startServer(t)
+	tester := webtest.NewWebTest(port)
+	tester.SetBearerToken(test.MintToken(t, "app-test", auth.RoleAdmin))
 	tests := []struct {
 		name string
 		tc   webtest.TestCase
 	}{
+		{"GET /ping without token", webtest.TestCase{
+			Method:       http.MethodGet,
+			Path:         "/ping",
+			Headers:      map[string]string{"Authorization": ""},
+			ExpectedCode: http.StatusOK,
+			ExpectedBody: "pong",
+		}},
+		{"GET /customer/:id without token", webtest.TestCase{
+			Method:       http.MethodGet,
+			Path:         "/customer/00000000-0000-0000-0000-000000000000",
+			Headers:      map[string]string{"Authorization": ""},
+			ExpectedCode: http.StatusUnauthorized,
+			ExpectedBody: map[string]any{"error": "Missing bearer token"},
+		}},
 		{"POST /user with valid data", webtest.TestCase{
 			Method:              http.MethodPost,
 			Path:                "/user",
-			Payload:             map[string]any{"name": "Alice", "email": "alice@example.com"},
+			Payload:             map[string]any{"name": "Alice", "email": "alice@example.com", "password": "correct horse"},
 			ExpectedCode:        http.StatusCreated,
 			ExpectedBodyPattern: "{\"id\":(?P<userId>\\d+),\"name\":\"Alice\",\"email\":\"alice@example.com\"}",
 		}},
+		{"PUT /admin/users/:userId/roles", webtest.TestCase{
+			Method:       http.MethodPut,
+			Path:         "/admin/users/:userId/roles",
+			Payload:      map[string]any{"roles": []string{"customer"}},
+			ExpectedCode: http.StatusOK,
+			ExpectedBody: `{"roles":["customer"]}`,
+		}},
+		{"PUT /admin/users/:userId/roles with unknown role", webtest.TestCase{
+			Method:       http.MethodPut,
+			Path:         "/admin/users/:userId/roles",
+			Payload:      map[string]any{"roles": []string{"superuser"}},
+			ExpectedCode: http.StatusBadRequest,
+		}},
+		{"POST /auth/login with wrong password", webtest.TestCase{
+			Method:       http.MethodPost,
+			Path:         "/auth/login",
+			Payload:      map[string]any{"email": "alice@example.com", "password": "wrong password"},
+			ExpectedCode: http.StatusUnauthorized,
+			ExpectedBody: map[string]any{"error": "Invalid email or password"},
+		}},
+		{"POST /auth/login", webtest.TestCase{
+			Method:              http.MethodPost,
+			Path:                "/auth/login",
+			Payload:             map[string]any{"email": "alice@example.com", "password": "correct horse"},
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "{\"access_token\":\"(?P<accessToken>[^\"]+)\",\"refresh_token\":\"(?P<refreshToken>[^\"]+)\",\"token_type\":\"Bearer\",\"expires_in\":\\d+}",
+		}},
+		{"POST /auth/refresh", webtest.TestCase{
+			Method:              http.MethodPost,
+			Path:                "/auth/refresh",
+			Payload:             map[string]any{"refresh_token": ":refreshToken"},
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "{\"access_token\":\"(?P<accessToken>[^\"]+)\",\"refresh_token\":\"[^\"]+\",\"token_type\":\"Bearer\",\"expires_in\":\\d+}",
+		}},
+		{"POST /auth/refresh with rotated token", webtest.TestCase{
+			Method:       http.MethodPost,
+			Path:         "/auth/refresh",
+			Payload:      map[string]any{"refresh_token": ":refreshToken"},
+			ExpectedCode: http.StatusUnauthorized,
+			ExpectedBody: map[string]any{"error": "Invalid refresh token"},
+		}},
+		{"DELETE /customer/:id as customer", webtest.TestCase{
+			Method:       http.MethodDelete,
+			Path:         "/customer/00000000-0000-0000-0000-000000000000",
+			Headers:      map[string]string{"Authorization": "Bearer :accessToken"},
+			ExpectedCode: http.StatusForbidden,
+			ExpectedBody: map[string]any{"error": "Missing permission customer:delete"},
+		}},
 		{"GET /user/:userId", webtest.TestCase{
 			Method:              http.MethodGet,
 			Path:                "/user/:userId",
 			ExpectedCode:        http.StatusOK,
 			ExpectedBodyPattern: "{\"id\":\\d+,\"name\":\"Alice\",\"email\":\"alice@example.com\"}",
 		}},
+		{"POST /admin/apikeys", webtest.TestCase{
+			Method:              http.MethodPost,
+			Path:                "/admin/apikeys",
+			Payload:             map[string]any{"name": "warehouse", "scopes": []string{"product:read"}},
+			ExpectedCode:        http.StatusCreated,
+			ExpectedBodyPattern: "\"key\":\"(?P<apiKey>gat_[0-9a-f]+_[A-Za-z0-9_-]+)\"",
+		}},
+		{"POST /customer with API key missing the scope", webtest.TestCase{
+			Method:       http.MethodPost,
+			Path:         "/customer",
+			Headers:      map[string]string{"Authorization": "ApiKey :apiKey"},
+			Payload:      map[string]any{"name": "Eve", "email": "eve@example.com"},
+			ExpectedCode: http.StatusForbidden,
+		}},
 		{"POST /customer with valid data", webtest.TestCase{
 			Method:              http.MethodPost,
 			Path:                "/customer",
@@ -98,63 +197,164 @@ func Test_Application(t *testing.T) {
 			ExpectedCode:        http.StatusOK,
 			ExpectedBodyPattern: "{\"id\":\"[0-9a-fA-F-]{36}\",\"name\":\"Robert\",\"email\":\"robert@example.com\"}",
 		}},
+		{"POST /customer with invalid data", webtest.TestCase{
+			Method:              http.MethodPost,
+			Path:                "/customer",
+			Payload:             map[string]any{"name": "Eve", "email": "not-an-email"},
+			ExpectedCode:        http.StatusBadRequest,
+			ExpectedBodyPattern: "{\"error\":\"Validation failed: .*Email.*\"}",
+		}},
+		{"POST /rpc customer.get", webtest.TestCase{
+			Method:              http.MethodPost,
+			Path:                "/rpc",
+			Payload:             map[string]any{"jsonrpc": "2.0", "method": "customer.get", "params": map[string]any{"id": ":customerId"}, "id": 1},
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "{\"jsonrpc\":\"2.0\",\"result\":{\"id\":\":customerId\",\"name\":\"Robert\",\"email\":\"robert@example.com\"},\"id\":1}",
+		}},
+		{"POST /rpc batch with invalid customer", webtest.TestCase{
+			Method: http.MethodPost,
+			Path:   "/rpc",
+			Payload: []map[string]any{
+				{"jsonrpc": "2.0", "method": "customer.create", "params": map[string]any{"name": "Eve", "email": "not-an-email"}, "id": 1},
+				{"jsonrpc": "2.0", "method": "customer.get", "params": map[string]any{"id": "00000000-0000-4000-8000-000000000000"}, "id": 2},
+			},
+			ExpectedCode: http.StatusOK,
+			ExpectedBodyPattern: "\\[{\"jsonrpc\":\"2.0\",\"error\":{\"code\":-32602,\"message\":\"Validation failed: .*\",\"data\":{\"status\":400}},\"id\":1}," +
+				"{\"jsonrpc\":\"2.0\",\"error\":{\"code\":-32004,\"message\":\"Customer not found\",\"data\":{\"status\":404}},\"id\":2}\\]",
+		}},
 
 		{"POST /product with valid data", webtest.TestCase{
 			Method:              http.MethodPost,
 			Path:                "/product",
-			Payload:             map[string]any{"name": "Widget", "price": 19.99},
+			Payload:             map[string]any{"name": "Widget", "price": map[string]any{"amount": "19.99", "currency": "EUR"}},
 			ExpectedCode:        http.StatusCreated,
-			ExpectedBodyPattern: "{\"id\":\"(?P<productId>[0-9a-fA-F-]{36})\",\"name\":\"Widget\",\"description\":\"\",\"price\":19.99}",
+			ExpectedBodyPattern: "{\"id\":\"(?P<productId>[0-9a-fA-F-]{36})\",\"name\":\"Widget\",\"description\":\"\",\"price\":{\"amount\":\"19.99\",\"currency\":\"EUR\"}}",
 		}},
 		{"GET /product/:productId", webtest.TestCase{
 			Method:              http.MethodGet,
 			Path:                "/product/:productId",
 			ExpectedCode:        http.StatusOK,
-			ExpectedBodyPattern: "{\"id\":\"[0-9a-fA-F-]{36}\",\"name\":\"Widget\",\"description\":\"\",\"price\":19.99}",
+			ExpectedBodyPattern: "{\"id\":\"[0-9a-fA-F-]{36}\",\"name\":\"Widget\",\"description\":\"\",\"price\":{\"amount\":\"19.99\",\"currency\":\"EUR\"}}",
 		}},
 		{"PUT /product/:productId", webtest.TestCase{
 			Method:              http.MethodPut,
 			Path:                "/product/:productId",
-			Payload:             map[string]any{"name": "Super Widget", "description": "An improved widget", "price": 29.99},
+			Payload:             map[string]any{"name": "Super Widget", "description": "An improved widget", "price": map[string]any{"amount": "29.99", "currency": "EUR"}},
 			ExpectedCode:        http.StatusOK,
-			ExpectedBodyPattern: "{\"id\":\"[0-9a-fA-F-]{36}\",\"name\":\"Super Widget\",\"description\":\"An improved widget\",\"price\":29.99}",
+			ExpectedBodyPattern: "{\"id\":\"[0-9a-fA-F-]{36}\",\"name\":\"Super Widget\",\"description\":\"An improved widget\",\"price\":{\"amount\":\"29.99\",\"currency\":\"EUR\"}}",
 		}},
 		{"GET /product/:productId after update", webtest.TestCase{
 			Method:              http.MethodGet,
 			Path:                "/product/:productId",
 			ExpectedCode:        http.StatusOK,
-			ExpectedBodyPattern: "{\"id\":\"[0-9a-fA-F-]{36}\",\"name\":\"Super Widget\",\"description\":\"An improved widget\",\"price\":29.99}",
+			ExpectedBodyPattern: "{\"id\":\"[0-9a-fA-F-]{36}\",\"name\":\"Super Widget\",\"description\":\"An improved widget\",\"price\":{\"amount\":\"29.99\",\"currency\":\"EUR\"}}",
 		}},
 
 		{"POST /order with valid data", webtest.TestCase{
 			Method: http.MethodPost,
 			Path:   "/order",
-			Payload: map[string]any{"customer_id": ":customerId", "status": "pending", "total": 39.98, "items": []map[string]any{
+			Payload: map[string]any{"customer_id": ":customerId", "status": "pending", "total": map[string]any{"amount": "59.98", "currency": "EUR"}, "items": []map[string]any{
 				{"product_id": ":productId", "quantity": 2},
 			}},
 			ExpectedCode:        http.StatusCreated,
-			ExpectedBodyPattern: "{\"id\":\"(?P<orderId>[0-9a-fA-F-]{36})\",\"customer_id\":\":customerId\",\"status\":\"pending\",\"total\":39.98,\"items\":\\[\\{\"id\":\"[0-9a-fA-F-]{36}\",\"order_id\":\"[0-9a-fA-F-]{36}\",\"product_id\":\":productId\",\"quantity\":2\\}\\]\\}",
+			ExpectedBodyPattern: "{\"id\":\"(?P<orderId>[0-9a-fA-F-]{36})\",\"customer_id\":\":customerId\",\"status\":\"pending\",\"total\":{\"amount\":\"59.98\",\"currency\":\"EUR\"},\"items\":\\[\\{\"id\":\"[0-9a-fA-F-]{36}\",\"order_id\":\"[0-9a-fA-F-]{36}\",\"product_id\":\":productId\",\"quantity\":2\\}\\]\\}",
 		}},
 		{"GET /order/:orderId", webtest.TestCase{
 			Method:              http.MethodGet,
 			Path:                "/order/:orderId",
 			ExpectedCode:        http.StatusOK,
-			ExpectedBodyPattern: "{\"id\":\":orderId\",\"customer_id\":\":customerId\",\"status\":\"pending\",\"total\":39.98,\"items\":\\[\\{\"id\":\"[0-9a-fA-F-]{36}\",\"order_id\":\"[0-9a-fA-F-]{36}\",\"product_id\":\":productId\",\"quantity\":2}\\]\\}",
+			ExpectedBodyPattern: "{\"id\":\":orderId\",\"customer_id\":\":customerId\",\"status\":\"pending\",\"total\":{\"amount\":\"59.98\",\"currency\":\"EUR\"},\"items\":\\[\\{\"id\":\"[0-9a-fA-F-]{36}\",\"order_id\":\"[0-9a-fA-F-]{36}\",\"product_id\":\":productId\",\"quantity\":2}\\]\\}",
+		}},
+		{"POST /product:bulk", webtest.TestCase{
+			Method:              http.MethodPost,
+			Path:                "/product:bulk",
+			Headers:             map[string]string{"Content-Type": "application/x-ndjson"},
+			Payload:             "{\"name\":\"Bolt\",\"price\":{\"amount\":\"0.25\",\"currency\":\"EUR\"}}\n{\"name\":\"Nut\",\"price\":{\"amount\":0,\"currency\":\"EUR\"}}\n",
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "\\{\"line\":1,\"id\":\"[0-9a-f-]{36}\"\\}\n\\{\"line\":2,\"error\":\"[^\"]+\"\\}\n\\{\"summary\":\\{\"total\":2,\"created\":1,\"failed\":1,\"committed\":true\\}\\}",
+		}},
+		{"POST /customer:bulk atomic", webtest.TestCase{
+			Method:              http.MethodPost,
+			Path:                "/customer:bulk?atomic=true",
+			Headers:             map[string]string{"Content-Type": "application/x-ndjson"},
+			Payload:             "{\"name\":\"Dora\",\"email\":\"dora@example.com\"}\n{\"name\":\"Dora\",\"email\":\"dora@example.com\"}\n",
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "\"line\":2,\"error\":\"duplicate key value[^\n]+\n\\{\"summary\":\\{\"total\":2,\"created\":1,\"failed\":1,\"committed\":false\\}\\}",
+		}},
+		{"GET /order as CSV", webtest.TestCase{
+			Method:              http.MethodGet,
+			Path:                "/order",
+			Headers:             map[string]string{"Accept": "text/csv"},
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "id,customer_id,status,total\n:orderId,:customerId,pending,59.98 EUR\n",
+		}},
+		{"GET /order/export", webtest.TestCase{
+			Method:              http.MethodGet,
+			Path:                "/order/export?status=pending&customer_id=:customerId",
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "^\\{\"id\":\":orderId\",\"customer_id\":\":customerId\",\"status\":\"pending\",\"total\":{\"amount\":\"59.98\",\"currency\":\"EUR\"},\"order_date\":\"[^\"]+\",\"items\":\\[\\{\"id\":\"[0-9a-f-]{36}\",\"order_id\":\":orderId\",\"product_id\":\":productId\",\"quantity\":2\\}\\]\\}\n$",
+		}},
+		{"GET /order/export as CSV", webtest.TestCase{
+			Method:              http.MethodGet,
+			Path:                "/order/export?customer_id=:customerId",
+			Headers:             map[string]string{"Accept": "text/csv"},
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "^order_id,customer_id,status,total,order_date,item_id,product_id,quantity\n:orderId,:customerId,pending,59.98 EUR,[^,]+,[0-9a-f-]{36},:productId,2\n$",
+		}},
+		{"GET /order/export of another status", webtest.TestCase{
+			Method:              http.MethodGet,
+			Path:                "/order/export?status=shipped",
+			Headers:             map[string]string{"Accept": "text/csv"},
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "^order_id,customer_id,status,total,order_date,item_id,product_id,quantity\n$",
+		}},
+		{"GET /customer/export with invalid date", webtest.TestCase{
+			Method:       http.MethodGet,
+			Path:         "/customer/export?from=yesterday",
+			ExpectedCode: http.StatusBadRequest,
+		}},
+		{"GET /customer/:customerId as XML", webtest.TestCase{
+			Method:              http.MethodGet,
+			Path:                "/customer/:customerId",
+			Headers:             map[string]string{"Accept": "application/xml"},
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "<customer><id>:customerId</id><name>Robert</name><email>robert@example.com</email></customer>",
+		}},
+		{"GET /customer/:customerId as PDF", webtest.TestCase{
+			Method:       http.MethodGet,
+			Path:         "/customer/:customerId",
+			Headers:      map[string]string{"Accept": "application/pdf"},
+			ExpectedCode: http.StatusNotAcceptable,
+		}},
+		{"POST /customer with XML body", webtest.TestCase{
+			Method:              http.MethodPost,
+			Path:                "/customer",
+			Headers:             map[string]string{"Content-Type": "application/xml"},
+			Payload:             "<customer><name>Carol</name><email>carol@example.com</email></customer>",
+			ExpectedCode:        http.StatusCreated,
+			ExpectedBodyPattern: "\"name\":\"Carol\"",
+		}},
+		{"POST /product with unsupported body", webtest.TestCase{
+			Method:       http.MethodPost,
+			Path:         "/product",
+			Headers:      map[string]string{"Content-Type": "application/pdf"},
+			Payload:      "%PDF-1.7",
+			ExpectedCode: http.StatusUnsupportedMediaType,
 		}},
 		{"PUT /order/:orderId", webtest.TestCase{
 			Method: http.MethodPut,
 			Path:   "/order/:orderId",
-			Payload: map[string]any{"customer_id": ":customerId", "status": "pending", "total": 11.98, "items": []map[string]any{
+			Payload: map[string]any{"customer_id": ":customerId", "status": "pending", "total": map[string]any{"amount": "89.97", "currency": "EUR"}, "items": []map[string]any{
 				{"product_id": ":productId", "quantity": 3},
 			}},
 			ExpectedCode:        http.StatusOK,
-			ExpectedBodyPattern: "{\"id\":\"[0-9a-fA-F-]{36}\",\"customer_id\":\":customerId\",\"status\":\"pending\",\"total\":11.98,\"items\":\\[\\{\"id\":\"[0-9a-fA-F-]{36}\",\"order_id\":\"[0-9a-fA-F-]{36}\",\"product_id\":\":productId\",\"quantity\":3\\}\\]\\}",
+			ExpectedBodyPattern: "{\"id\":\"[0-9a-fA-F-]{36}\",\"customer_id\":\":customerId\",\"status\":\"pending\",\"total\":{\"amount\":\"89.97\",\"currency\":\"EUR\"},\"items\":\\[\\{\"id\":\"[0-9a-fA-F-]{36}\",\"order_id\":\"[0-9a-fA-F-]{36}\",\"product_id\":\":productId\",\"quantity\":3\\}\\]\\}",
 		}},
 		{"GET /order/:orderId after update", webtest.TestCase{
 			Method:              http.MethodGet,
 			Path:                "/order/:orderId",
 			ExpectedCode:        http.StatusOK,
-			ExpectedBodyPattern: "{\"id\":\":orderId\",\"customer_id\":\":customerId\",\"status\":\"pending\",\"total\":11.98,\"items\":\\[\\{\"id\":\"[0-9a-fA-F-]{36}\",\"order_id\":\"[0-9a-fA-F-]{36}\",\"product_id\":\":productId\",\"quantity\":3\\}\\]\\}",
+			ExpectedBodyPattern: "{\"id\":\":orderId\",\"customer_id\":\":customerId\",\"status\":\"pending\",\"total\":{\"amount\":\"89.97\",\"currency\":\"EUR\"},\"items\":\\[\\{\"id\":\"[0-9a-fA-F-]{36}\",\"order_id\":\"[0-9a-fA-F-]{36}\",\"product_id\":\":productId\",\"quantity\":3\\}\\]\\}",
 		}},
 		{"DELETE /order/:orderId", webtest.TestCase{
 			Method:       http.MethodDelete,
@@ -179,4 +379,113 @@ func Test_Application(t *testing.T) {
 			t.Logf("Request %s took %v", tc.name, duration)
 		})
 	}
+
+	admin := webtest.NewWebTest(adminPort)
+	adminTests := []struct {
+		name string
+		tc   webtest.TestCase
+	}{
+		{"GET /debug/routes without credentials", webtest.TestCase{
+			Method:       http.MethodGet,
+			Path:         "/debug/routes",
+			ExpectedCode: http.StatusUnauthorized,
+		}},
+		{"GET /debug/routes", webtest.TestCase{
+			Method:              http.MethodGet,
+			Path:                "/debug/routes",
+			Headers:             map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:admin-test"))},
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "\"path\":\"/customer/:id\"",
+		}},
+		{"GET /debug/config masks secrets", webtest.TestCase{
+			Method:              http.MethodGet,
+			Path:                "/debug/config",
+			Headers:             map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:admin-test"))},
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "\"DB_PASSWORD\":\"\\*+\"",
+		}},
+		{"GET /debug/vars reports the outbox", webtest.TestCase{
+			Method:              http.MethodGet,
+			Path:                "/debug/vars",
+			Headers:             map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:admin-test"))},
+			ExpectedCode:        http.StatusOK,
+			ExpectedBodyPattern: "\"outbox\": {",
+		}},
+	}
+	for _, tc := range adminTests {
+		t.Run(tc.name, func(t *testing.T) {
+			admin.RunTest(t, tc.tc)
+		})
+	}
+
+	t.Run("client", func(t *testing.T) {
+		testClient(t, port)
+	})
+}
+
+// testClient runs the typed client against the server.
+func testClient(t *testing.T, port string) {
+	ctx := context.Background()
+	api, err := client.New(client.Config{
+		BaseURL:     "http://localhost:" + port,
+		BearerToken: test.MintToken(t, "app-test", auth.RoleAdmin),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	created, err := api.Customers().Create(ctx, client.Customer{Name: "Dave", Email: "dave@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create customer: %v", err)
+	}
+	created.Name = "David"
+	if updated, err := api.Customers().Update(ctx, *created); err != nil || updated.Name != "David" {
+		t.Fatalf("Failed to update customer: %+v, %v", updated, err)
+	}
+	if _, err := api.Customers().Create(ctx, client.Customer{Name: "Eve", Email: "not-an-email"}); !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+	if _, err := api.Customers().Get(ctx, uuid.New()); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Expected a missing customer, got %v", err)
+	}
+
+	gadget, err := api.Products().Create(ctx, client.Product{Name: "Gadget", Price: money.New(950, "EUR")})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+	var orderIDs []uuid.UUID
+	for range 3 {
+		o, err := api.Orders().Create(ctx, client.Order{
+			CustomerID: created.ID,
+			Status:     "pending",
+			Total:      money.New(950, "EUR"),
+			Items:      []client.OrderItem{{ProductID: gadget.ID, Quantity: 1}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+		orderIDs = append(orderIDs, o.ID)
+	}
+	got, err := api.Orders().Get(ctx, orderIDs[0])
+	if err != nil || got.CustomerID != created.ID || len(got.Items) != 1 {
+		t.Fatalf("Failed to retrieve order: %+v, %v", got, err)
+	}
+
+	seen := map[uuid.UUID]bool{}
+	for o, err := range api.Orders().All(ctx, 2) {
+		if err != nil {
+			t.Fatalf("Failed to list orders: %v", err)
+		}
+		seen[o.ID] = true
+	}
+	for _, id := range orderIDs {
+		if !seen[id] {
+			t.Errorf("Order %s missing from the listing", id)
+		}
+	}
+
+	api.SetBearerToken(test.MintToken(t, "app-test", auth.RoleCustomer))
+	if err := api.Customers().Delete(ctx, created.ID); !errors.Is(err, client.ErrForbidden) {
+		t.Errorf("Expected a customer to be forbidden to delete, got %v", err)
+	}
 }
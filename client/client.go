@@ -0,0 +1,262 @@
+// Package client is a typed Go client for the REST API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Config configures a Client.
+type Config struct {
+	// BaseURL is the address of the API, like https://api.example.com.
+	BaseURL string
+	// HTTPClient sends the requests, a client with a 30s timeout by default.
+	HTTPClient *http.Client
+	// BearerToken or APIKey authenticate the requests, the token wins if both are set.
+	BearerToken string
+	APIKey      string
+	// MaxRetries is the number of retries of a failed call, 3 by default; negative disables
+	// retries. Only idempotent calls are retried after errors whose effect is unknown.
+	MaxRetries int
+	// RetryWait is the wait before the first retry, doubled for every further retry up to
+	// MaxRetryWait. 200ms and 5s by default. A Retry-After of the server takes precedence.
+	RetryWait    time.Duration
+	MaxRetryWait time.Duration
+	// UserAgent is sent with every request.
+	UserAgent string
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.RetryWait <= 0 {
+		cfg.RetryWait = 200 * time.Millisecond
+	}
+	if cfg.MaxRetryWait <= 0 {
+		cfg.MaxRetryWait = 5 * time.Second
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "go-app-test-client"
+	}
+	return cfg
+}
+
+// Client calls the REST API. It is safe for concurrent use.
+type Client struct {
+	cfg  Config
+	base *url.URL
+
+	mu          sync.RWMutex
+	bearerToken string
+	apiKey      string
+}
+
+// New returns a client for the API at cfg.BaseURL.
+func New(cfg Config) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(cfg.BaseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q", cfg.BaseURL)
+	}
+
+	cfg = cfg.withDefaults()
+	return &Client{cfg: cfg, base: base, bearerToken: cfg.BearerToken, apiKey: cfg.APIKey}, nil
+}
+
+// SetBearerToken authenticates the following requests with a JWT, e.g. after a token refresh.
+func (c *Client) SetBearerToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bearerToken = token
+}
+
+// SetAPIKey authenticates the following requests with an API key.
+func (c *Client) SetAPIKey(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apiKey = key
+}
+
+func (c *Client) authorization() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	switch {
+	case c.bearerToken != "":
+		return "Bearer " + c.bearerToken
+	case c.apiKey != "":
+		return "ApiKey " + c.apiKey
+	}
+	return ""
+}
+
+// idempotent reports whether a request may be sent again after a failure whose effect is unknown.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// do sends a JSON request and decodes the JSON response into out. Idempotent requests are
+// retried after network errors and 502, 503 and 504; every request is retried after 429, which
+// the server answers before handling the request.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	u := c.base.JoinPath(path)
+	u.RawQuery = query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, method, u.String(), body)
+		retries := attempt < c.cfg.MaxRetries
+		if err != nil {
+			if !retries || !idempotent(method) || ctx.Err() != nil {
+				return err
+			}
+			if err := c.wait(ctx, attempt, 0); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if res.StatusCode >= http.StatusBadRequest {
+			apiErr := decodeError(res)
+			if retries && retryable(method, res.StatusCode) {
+				if err := c.wait(ctx, attempt, apiErr.RetryAfter); err != nil {
+					return err
+				}
+				continue
+			}
+			return apiErr
+		}
+
+		return decodeBody(res, out)
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	req.Header.Set("User-Agent", c.cfg.UserAgent)
+	if authorization := c.authorization(); authorization != "" {
+		req.Header.Set(echo.HeaderAuthorization, authorization)
+	}
+	return c.cfg.HTTPClient.Do(req)
+}
+
+func retryable(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(method)
+	}
+	return false
+}
+
+// wait sleeps before a retry: retryAfter if the server sent one, else an exponential backoff with
+// jitter, so clients failing together don't retry together.
+func (c *Client) wait(ctx context.Context, attempt int, retryAfter time.Duration) error {
+	d := retryAfter
+	if d <= 0 {
+		d = c.cfg.RetryWait << attempt
+		if d <= 0 || d > c.cfg.MaxRetryWait {
+			d = c.cfg.MaxRetryWait
+		}
+		d = d/2 + rand.N(d/2+1)
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func decodeBody(res *http.Response, out any) error {
+	defer func() { _ = res.Body.Close() }()
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s response: %w", res.Request.URL.Path, err)
+	}
+	return nil
+}
+
+// page fetches a page of a list endpoint.
+type page[T any] func(ctx context.Context, limit, offset int) ([]T, error)
+
+// paginate iterates over every item of a list endpoint, fetching pageSize items at a time. The
+// iteration stops at the first error, which is yielded with the zero value.
+func paginate[T any](ctx context.Context, pageSize int, fetch page[T]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for offset := 0; ; offset += pageSize {
+			items, err := fetch(ctx, pageSize, offset)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if len(items) < pageSize {
+				return
+			}
+		}
+	}
+}
+
+func pagingQuery(limit, offset int) url.Values {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	return query
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/romanWienicke/go-app-test/foundation/money"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c, err := New(Config{BaseURL: server.URL, BearerToken: "token", RetryWait: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
+
+func TestCreateAndGet(t *testing.T) {
+	id := uuid.New()
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		var in Customer
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				t.Errorf("decode: %v", err)
+			}
+		} else if r.URL.Path != "/customer/"+id.String() {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		in.ID = id
+		in.Name = "Bob"
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(in)
+	})
+
+	created, err := c.Customers().Create(context.Background(), Customer{Name: "Bob", Email: "bob@example.com"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.ID != id || created.Email != "bob@example.com" {
+		t.Errorf("unexpected customer %+v", created)
+	}
+	got, err := c.Customers().Get(context.Background(), id)
+	if err != nil || got.ID != id {
+		t.Errorf("Get: %+v, %v", got, err)
+	}
+	if _, err := c.Customers().Update(context.Background(), Customer{Name: "Bob"}); !errors.Is(err, ErrMissingID) {
+		t.Errorf("expected ErrMissingID, got %v", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-1")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"Customer not found"}`))
+	})
+
+	_, err := c.Customers().Get(context.Background(), uuid.New())
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrServer) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Message != "Customer not found" || apiErr.RequestID != "req-1" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"` + uuid.NewString() + `"}`))
+	})
+
+	if _, err := c.Orders().Get(context.Background(), uuid.New()); err != nil {
+		t.Errorf("expected the GET to be retried: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 calls, got %d", calls.Load())
+	}
+
+	calls.Store(0)
+	if _, err := c.Orders().Create(context.Background(), Order{}); !errors.Is(err, ErrServer) {
+		t.Errorf("expected the POST not to be retried, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected 1 call, got %d", calls.Load())
+	}
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	if _, err := c.Orders().Create(context.Background(), Order{}); err != nil {
+		t.Errorf("expected a rate limited POST to be retried: %v", err)
+	}
+}
+
+func TestAll(t *testing.T) {
+	const total = 5
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		orders := []Order{}
+		for i := offset; i < min(offset+limit, total); i++ {
+			orders = append(orders, Order{Total: money.New(int64(i)*100, "EUR")})
+		}
+		_ = json.NewEncoder(w).Encode(orders)
+	})
+
+	var got []int64
+	for o, err := range c.Orders().All(context.Background(), 2) {
+		if err != nil {
+			t.Fatalf("All: %v", err)
+		}
+		got = append(got, o.Total.Cents)
+	}
+	if len(got) != total || got[total-1] != (total-1)*100 {
+		t.Errorf("unexpected orders %v", got)
+	}
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Errors matched by an *Error with errors.Is, one per status class callers handle differently.
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrServer       = errors.New("server error")
+
+	// ErrMissingID is returned by updates of an entity without ID.
+	ErrMissingID = errors.New("missing ID")
+)
+
+// Error is a failed API call.
+type Error struct {
+	StatusCode int
+	// Message is the error message of the response.
+	Message string
+	// ErrorID identifies server errors in the server log.
+	ErrorID string
+	// RequestID is the X-Request-Id of the response.
+	RequestID string
+	// RetryAfter is the wait the server asked for, e.g. with 429.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("api: %d %s", e.StatusCode, e.Message)
+	if e.ErrorID != "" {
+		msg += " (error_id " + e.ErrorID + ")"
+	}
+	return msg
+}
+
+// Is matches the sentinel errors of the status code.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// decodeError reads an error response, a body that is not the API's error JSON becomes the
+// status text.
+func decodeError(res *http.Response) *Error {
+	defer func() { _ = res.Body.Close() }()
+	apiErr := &Error{
+		StatusCode: res.StatusCode,
+		RequestID:  res.Header.Get("X-Request-Id"),
+	}
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	var body errorResponse
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if err := json.Unmarshal(data, &body); err == nil && body.Error != "" {
+		apiErr.Message = body.Error
+		apiErr.ErrorID = body.ErrorID
+	} else {
+		apiErr.Message = http.StatusText(res.StatusCode)
+	}
+	return apiErr
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Customers returns the client of the /customer routes.
+func (c *Client) Customers() *Resource[Customer] {
+	return &Resource[Customer]{client: c, path: "customer", id: func(c Customer) uuid.UUID { return c.ID }}
+}
+
+// Products returns the client of the /product routes.
+func (c *Client) Products() *Resource[Product] {
+	return &Resource[Product]{client: c, path: "product", id: func(p Product) uuid.UUID { return p.ID }}
+}
+
+// Orders returns the client of the /order routes.
+func (c *Client) Orders() *OrderResource {
+	return &OrderResource{Resource[Order]{client: c, path: "order", id: func(o Order) uuid.UUID { return o.ID }}}
+}
+
+// Resource calls the create, read, update and delete routes of an entity.
+type Resource[T any] struct {
+	client *Client
+	path   string
+	id     func(T) uuid.UUID
+}
+
+// Create stores a new entity and returns it with its ID. Creates are not retried after errors
+// whose effect is unknown, as the entity may exist already.
+func (r *Resource[T]) Create(ctx context.Context, entity T) (*T, error) {
+	var created T
+	if err := r.client.do(ctx, http.MethodPost, r.path, nil, entity, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (r *Resource[T]) Get(ctx context.Context, id uuid.UUID) (*T, error) {
+	var entity T
+	if err := r.client.do(ctx, http.MethodGet, r.path+"/"+id.String(), nil, nil, &entity); err != nil {
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// Update replaces the entity with the ID of entity and returns the stored entity.
+func (r *Resource[T]) Update(ctx context.Context, entity T) (*T, error) {
+	id := r.id(entity)
+	if id == uuid.Nil {
+		return nil, ErrMissingID
+	}
+	var updated T
+	if err := r.client.do(ctx, http.MethodPut, r.path+"/"+id.String(), nil, entity, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (r *Resource[T]) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.client.do(ctx, http.MethodDelete, r.path+"/"+id.String(), nil, nil, nil)
+}
+
+// OrderResource calls the /order routes, which can also list orders.
+type OrderResource struct {
+	Resource[Order]
+}
+
+// List returns a page of orders including their items, oldest first. A limit of 0 selects the
+// server's default page size.
+func (r *OrderResource) List(ctx context.Context, limit, offset int) ([]Order, error) {
+	var orders []Order
+	if err := r.client.do(ctx, http.MethodGet, r.path, pagingQuery(limit, offset), nil, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// All iterates over all orders, fetching pageSize orders at a time (100 if not positive).
+func (r *OrderResource) All(ctx context.Context, pageSize int) iter.Seq2[Order, error] {
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	return paginate(ctx, pageSize, r.List)
+}
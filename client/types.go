@@ -0,0 +1,43 @@
+package client
+
+import (
+	"github.com/google/uuid"
+	"github.com/romanWienicke/go-app-test/foundation/money"
+)
+
+// The entities as the API sends and takes them. They are declared here, so the client doesn't
+// depend on the server packages.
+
+type Customer struct {
+	ID    uuid.UUID `json:"id,omitzero"`
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+}
+
+type Product struct {
+	ID          uuid.UUID   `json:"id,omitzero"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Price       money.Money `json:"price"`
+}
+
+type Order struct {
+	ID         uuid.UUID   `json:"id,omitzero"`
+	CustomerID uuid.UUID   `json:"customer_id"`
+	Status     string      `json:"status"`
+	Total      money.Money `json:"total"`
+	Items      []OrderItem `json:"items"`
+}
+
+type OrderItem struct {
+	ID        uuid.UUID `json:"id,omitzero"`
+	OrderID   uuid.UUID `json:"order_id,omitzero"`
+	ProductID uuid.UUID `json:"product_id"`
+	Quantity  float32   `json:"quantity"`
+}
+
+// errorResponse is the body of error responses.
+type errorResponse struct {
+	Error   string `json:"error"`
+	ErrorID string `json:"error_id,omitempty"`
+}
@@ -0,0 +1,220 @@
+// Package events publishes domain events of the services to other systems. Events travel in a
+// JSON Envelope that carries the event type and schema version; the aggregate ID is the
+// partition key, so the events of one customer, product or order stay in order.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/romanWienicke/go-app-test/foundation/money"
+)
+
+var (
+	ErrUnknownEventType   = errors.New("unknown event type")
+	ErrUnsupportedVersion = errors.New("unsupported event schema version")
+)
+
+// Event is a typed domain event.
+type Event interface {
+	// EventType names the event, like "order.created".
+	EventType() string
+	// AggregateID is the ID of the entity the event belongs to.
+	AggregateID() uuid.UUID
+}
+
+// Envelope is the wire format of an event. TenantID is the tenant of the aggregate, set by the
+// outbox from the transaction that stored the event.
+type Envelope struct {
+	ID            uuid.UUID       `json:"id"`
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	AggregateID   uuid.UUID       `json:"aggregate_id"`
+	TenantID      string          `json:"tenant_id,omitempty"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Publisher sends events. Publish returns once the events are stored by the transport.
+type Publisher interface {
+	Publish(ctx context.Context, events ...Event) error
+}
+
+// EnvelopePublisher sends envelopes built earlier, like the outbox relay does. Envelopes of the
+// same aggregate are sent in the given order.
+type EnvelopePublisher interface {
+	PublishEnvelopes(ctx context.Context, envelopes ...Envelope) error
+}
+
+// NewEnvelopes wraps events with NewEnvelope.
+func NewEnvelopes(events ...Event) ([]Envelope, error) {
+	envelopes := make([]Envelope, len(events))
+	for i, e := range events {
+		env, err := NewEnvelope(e)
+		if err != nil {
+			return nil, err
+		}
+		envelopes[i] = env
+	}
+	return envelopes, nil
+}
+
+// Handler processes a received event. An error stops the subscription, so the event is received
+// again when it restarts.
+type Handler func(ctx context.Context, envelope Envelope) error
+
+// Subscriber receives events and passes them to the handler one at a time, until ctx is done or
+// the handler fails.
+type Subscriber interface {
+	Subscribe(ctx context.Context, handler Handler) error
+}
+
+// schema is the current schema version of an event type and how to decode its data.
+type schema struct {
+	version int
+	decode  func(data json.RawMessage) (Event, error)
+	// older decodes the data of older versions where it differs
+	older map[int]func(data json.RawMessage) (Event, error)
+}
+
+// schemas are the known event types. A breaking change of an event increments its version;
+// consumers reject versions they don't know instead of misreading them.
+var schemas = map[string]schema{
+	CustomerCreatedType:     {1, decodeData[CustomerCreated], nil},
+	ProductPriceChangedType: {2, decodeData[ProductPriceChanged], map[int]func(json.RawMessage) (Event, error){1: decodeProductPriceChangedV1}},
+	OrderCreatedType:        {2, decodeData[OrderCreated], map[int]func(json.RawMessage) (Event, error){1: decodeOrderCreatedV1}},
+	OrderStatusChangedType:  {1, decodeData[OrderStatusChanged], nil},
+}
+
+func decodeData[T Event](data json.RawMessage) (Event, error) {
+	var e T
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// NewEnvelope wraps an event with a new ID, the current time and its schema version.
+func NewEnvelope(e Event) (Envelope, error) {
+	s, ok := schemas[e.EventType()]
+	if !ok {
+		return Envelope{}, fmt.Errorf("%w %q", ErrUnknownEventType, e.EventType())
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		ID:            uuid.New(),
+		Type:          e.EventType(),
+		SchemaVersion: s.version,
+		AggregateID:   e.AggregateID(),
+		OccurredAt:    time.Now().UTC(),
+		Data:          data,
+	}, nil
+}
+
+// Decode returns the typed event of an envelope.
+func (env Envelope) Decode() (Event, error) {
+	s, ok := schemas[env.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownEventType, env.Type)
+	}
+	if env.SchemaVersion < 1 || env.SchemaVersion > s.version {
+		return nil, fmt.Errorf("%w %d of %q", ErrUnsupportedVersion, env.SchemaVersion, env.Type)
+	}
+	if decode, ok := s.older[env.SchemaVersion]; ok {
+		return decode(env.Data)
+	}
+	return s.decode(env.Data)
+}
+
+// Event types.
+const (
+	CustomerCreatedType     = "customer.created"
+	ProductPriceChangedType = "product.price_changed"
+	OrderCreatedType        = "order.created"
+	OrderStatusChangedType  = "order.status_changed"
+)
+
+type CustomerCreated struct {
+	CustomerID uuid.UUID `json:"customer_id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+}
+
+func (e CustomerCreated) EventType() string      { return CustomerCreatedType }
+func (e CustomerCreated) AggregateID() uuid.UUID { return e.CustomerID }
+
+type ProductPriceChanged struct {
+	ProductID     uuid.UUID   `json:"product_id"`
+	PreviousPrice money.Money `json:"previous_price"`
+	Price         money.Money `json:"price"`
+}
+
+func (e ProductPriceChanged) EventType() string      { return ProductPriceChangedType }
+func (e ProductPriceChanged) AggregateID() uuid.UUID { return e.ProductID }
+
+type OrderCreated struct {
+	OrderID    uuid.UUID          `json:"order_id"`
+	CustomerID uuid.UUID          `json:"customer_id"`
+	Status     string             `json:"status"`
+	Total      money.Money        `json:"total"`
+	Items      []OrderCreatedItem `json:"items"`
+}
+
+type OrderCreatedItem struct {
+	ProductID uuid.UUID `json:"product_id"`
+	Quantity  float32   `json:"quantity"`
+}
+
+func (e OrderCreated) EventType() string      { return OrderCreatedType }
+func (e OrderCreated) AggregateID() uuid.UUID { return e.OrderID }
+
+type OrderStatusChanged struct {
+	OrderID        uuid.UUID `json:"order_id"`
+	CustomerID     uuid.UUID `json:"customer_id"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status"`
+}
+
+func (e OrderStatusChanged) EventType() string      { return OrderStatusChangedType }
+func (e OrderStatusChanged) AggregateID() uuid.UUID { return e.OrderID }
+
+// Version 1 of ProductPriceChanged and OrderCreated had float64 amounts, which were in the
+// default currency.
+
+func decodeProductPriceChangedV1(data json.RawMessage) (Event, error) {
+	var v1 struct {
+		ProductID     uuid.UUID `json:"product_id"`
+		PreviousPrice float64   `json:"previous_price"`
+		Price         float64   `json:"price"`
+	}
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return nil, err
+	}
+	return ProductPriceChanged{ProductID: v1.ProductID, PreviousPrice: fromFloat(v1.PreviousPrice), Price: fromFloat(v1.Price)}, nil
+}
+
+func decodeOrderCreatedV1(data json.RawMessage) (Event, error) {
+	var v1 struct {
+		OrderCreated
+		Total float64 `json:"total"`
+	}
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return nil, err
+	}
+	e := v1.OrderCreated
+	e.Total = fromFloat(v1.Total)
+	return e, nil
+}
+
+// fromFloat converts the two-decimal amounts of version 1 exactly.
+func fromFloat(amount float64) money.Money {
+	return money.New(int64(math.Round(amount*100)), money.DefaultCurrency)
+}
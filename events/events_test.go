@@ -0,0 +1,168 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/romanWienicke/go-app-test/foundation/money"
+)
+
+func TestEnvelope(t *testing.T) {
+	e := OrderStatusChanged{OrderID: uuid.New(), CustomerID: uuid.New(), Status: "shipped", PreviousStatus: "pending"}
+	env, err := NewEnvelope(e)
+	if err != nil {
+		t.Fatalf("NewEnvelope: %v", err)
+	}
+	if env.Type != OrderStatusChangedType || env.SchemaVersion != 1 || env.AggregateID != e.OrderID {
+		t.Errorf("unexpected envelope %+v", env)
+	}
+
+	encoded, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received Envelope
+	if err := json.Unmarshal(encoded, &received); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := received.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if decoded != e {
+		t.Errorf("expected %+v, got %+v", e, decoded)
+	}
+
+	received.SchemaVersion = 2
+	if _, err := received.Decode(); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected an unsupported version, got %v", err)
+	}
+	received.Type = "order.deleted"
+	if _, err := received.Decode(); !errors.Is(err, ErrUnknownEventType) {
+		t.Errorf("expected an unknown type, got %v", err)
+	}
+}
+
+func TestDecodeVersion1(t *testing.T) {
+	productID := uuid.New()
+	env := Envelope{
+		Type:          ProductPriceChangedType,
+		SchemaVersion: 1,
+		Data:          json.RawMessage(`{"product_id":"` + productID.String() + `","previous_price":19.99,"price":29.99}`),
+	}
+	decoded, err := env.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	want := ProductPriceChanged{ProductID: productID, PreviousPrice: money.New(1999, money.DefaultCurrency), Price: money.New(2999, money.DefaultCurrency)}
+	if decoded != want {
+		t.Errorf("expected %+v, got %+v", want, decoded)
+	}
+
+	orderID := uuid.New()
+	env = Envelope{
+		Type:          OrderCreatedType,
+		SchemaVersion: 1,
+		Data:          json.RawMessage(`{"order_id":"` + orderID.String() + `","status":"pending","total":49.98,"items":[]}`),
+	}
+	decoded, err = env.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if created := decoded.(OrderCreated); created.OrderID != orderID || created.Total != money.New(4998, money.DefaultCurrency) {
+		t.Errorf("unexpected order %+v", created)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	received := make(chan Envelope, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Subscribe(ctx, func(ctx context.Context, env Envelope) error {
+			received <- env
+			return errors.New("stop")
+		})
+	}()
+
+	// publish until the subscription is running
+	e := CustomerCreated{CustomerID: uuid.New(), Name: "Bob", Email: "bob@example.com"}
+	var env Envelope
+	for ok := false; !ok; {
+		if err := m.Publish(ctx, e); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		select {
+		case env = <-received:
+			ok = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if env.AggregateID != e.CustomerID {
+		t.Errorf("unexpected envelope %+v", env)
+	}
+	if err := <-done; err == nil || err.Error() != "stop" {
+		t.Errorf("expected the handler error to end the subscription, got %v", err)
+	}
+	if len(m.Published()) == 0 {
+		t.Error("expected the published envelopes to be kept")
+	}
+}
+
+func TestMemoryLaggingSubscriber(t *testing.T) {
+	m := NewMemory()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	subCtx, stop := context.WithCancel(ctx)
+	started := make(chan struct{}, 1)
+	go func() {
+		_ = m.Subscribe(subCtx, func(ctx context.Context, env Envelope) error {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			return nil
+		})
+	}()
+	e := CustomerCreated{CustomerID: uuid.New(), Name: "Bob", Email: "bob@example.com"}
+	for ok := false; !ok; {
+		if err := m.Publish(ctx, e); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		select {
+		case <-started:
+			ok = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// fill the buffer of the blocked subscriber, the next publish waits for it
+	published := make(chan error, 1)
+	go func() {
+		for range 100 {
+			if err := m.Publish(ctx, e); err != nil {
+				published <- err
+				return
+			}
+		}
+		published <- nil
+	}()
+
+	// the waiting publisher holds no lock, and it stops waiting once the subscription ended
+	for len(m.Published()) < 60 {
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+	if err := <-published; err != nil {
+		t.Fatalf("expected the publisher to go on after the subscription ended, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers of a Kafka message, so consumers can route events without decoding them.
+const (
+	HeaderEventType     = "event-type"
+	HeaderSchemaVersion = "schema-version"
+	HeaderTenant        = "tenant-id"
+)
+
+// KafkaConfig configures the Kafka adapter.
+type KafkaConfig struct {
+	Brokers []string
+	// Topic receives all domain events, "domain-events" by default.
+	Topic string
+	// GroupID is the consumer group of a Subscriber, required to subscribe.
+	GroupID string
+	// WriteTimeout bounds a publish, 10s by default.
+	WriteTimeout time.Duration
+}
+
+func (cfg KafkaConfig) withDefaults() KafkaConfig {
+	if cfg.Topic == "" {
+		cfg.Topic = "domain-events"
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 10 * time.Second
+	}
+	return cfg
+}
+
+// KafkaPublisher writes events to a topic, keyed by aggregate ID. Publish waits until all
+// in-sync replicas have the events.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaPublisher(cfg KafkaConfig) (*KafkaPublisher, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("kafka: no brokers")
+	}
+	cfg = cfg.withDefaults()
+	return &KafkaPublisher{writer: &kafka.Writer{
+		Addr:  kafka.TCP(cfg.Brokers...),
+		Topic: cfg.Topic,
+		// the same key always lands on the same partition
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		WriteTimeout:           cfg.WriteTimeout,
+		AllowAutoTopicCreation: true,
+		BatchTimeout:           10 * time.Millisecond,
+	}}, nil
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, events ...Event) error {
+	envelopes, err := NewEnvelopes(events...)
+	if err != nil {
+		return err
+	}
+	return p.PublishEnvelopes(ctx, envelopes...)
+}
+
+func (p *KafkaPublisher) PublishEnvelopes(ctx context.Context, envelopes ...Envelope) error {
+	messages := make([]kafka.Message, len(envelopes))
+	for i, env := range envelopes {
+		var err error
+		if messages[i], err = envelopeMessage(env); err != nil {
+			return err
+		}
+	}
+	return p.writer.WriteMessages(ctx, messages...)
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
+}
+
+func envelopeMessage(env Envelope) (kafka.Message, error) {
+	value, err := json.Marshal(env)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	headers := []kafka.Header{
+		{Key: HeaderEventType, Value: []byte(env.Type)},
+		{Key: HeaderSchemaVersion, Value: []byte(strconv.Itoa(env.SchemaVersion))},
+	}
+	if env.TenantID != "" {
+		headers = append(headers, kafka.Header{Key: HeaderTenant, Value: []byte(env.TenantID)})
+	}
+	return kafka.Message{
+		Key:     []byte(env.AggregateID.String()),
+		Value:   value,
+		Time:    env.OccurredAt,
+		Headers: headers,
+	}, nil
+}
+
+// KafkaSubscriber consumes the topic in a consumer group. Offsets are committed after the
+// handler succeeded, so every event is handled at least once.
+type KafkaSubscriber struct {
+	reader *kafka.Reader
+	log    *zerolog.Logger
+}
+
+func NewKafkaSubscriber(cfg KafkaConfig, log *zerolog.Logger) (*KafkaSubscriber, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("kafka: no brokers")
+	}
+	if cfg.GroupID == "" {
+		return nil, errors.New("kafka: no consumer group")
+	}
+	cfg = cfg.withDefaults()
+	return &KafkaSubscriber{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     cfg.Brokers,
+			Topic:       cfg.Topic,
+			GroupID:     cfg.GroupID,
+			StartOffset: kafka.FirstOffset,
+		}),
+		log: log,
+	}, nil
+}
+
+func (s *KafkaSubscriber) Subscribe(ctx context.Context, handler Handler) error {
+	for {
+		msg, err := s.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var env Envelope
+		if err := json.Unmarshal(msg.Value, &env); err != nil {
+			// a message that is no envelope never will be, skip it instead of blocking the partition
+			s.log.Error().Err(err).Int("partition", msg.Partition).Int64("offset", msg.Offset).
+				Msg("Skipping malformed event")
+		} else if err := handler(ctx, env); err != nil {
+			return fmt.Errorf("handle %s event %s: %w", env.Type, env.ID, err)
+		}
+
+		if err := s.reader.CommitMessages(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (s *KafkaSubscriber) Close() error {
+	return s.reader.Close()
+}
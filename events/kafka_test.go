@@ -0,0 +1,76 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/romanWienicke/go-app-test/foundation/money"
+	test "github.com/romanWienicke/go-app-test/foundation/testing"
+	"github.com/rs/zerolog"
+)
+
+func TestKafka(t *testing.T) {
+	dc := test.DockerComposeUp(t, "../docker-compose.yaml", "kafka")
+	t.Cleanup(func() {
+		t.Helper()
+		test.DockerComposeDown(t, "../docker-compose.yaml")
+	})
+
+	cfg := KafkaConfig{
+		Brokers: []string{"localhost:" + dc["kafka"].HostPorts["9092"]},
+		Topic:   "test-" + uuid.NewString(),
+		GroupID: "test",
+	}
+	publisher, err := NewKafkaPublisher(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create publisher: %v", err)
+	}
+	defer func() { _ = publisher.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	created := OrderCreated{OrderID: uuid.New(), CustomerID: uuid.New(), Status: "pending", Total: money.New(950, "EUR")}
+	changed := OrderStatusChanged{OrderID: created.OrderID, CustomerID: created.CustomerID, Status: "shipped", PreviousStatus: "pending"}
+	// the first write creates the topic, which may take a few attempts
+	for {
+		err := publisher.Publish(ctx, created, changed)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	log := zerolog.Nop()
+	subscriber, err := NewKafkaSubscriber(cfg, &log)
+	if err != nil {
+		t.Fatalf("Failed to create subscriber: %v", err)
+	}
+	defer func() { _ = subscriber.Close() }()
+
+	var received []Event
+	errDone := errors.New("done")
+	err = subscriber.Subscribe(ctx, func(ctx context.Context, env Envelope) error {
+		e, err := env.Decode()
+		if err != nil {
+			return err
+		}
+		received = append(received, e)
+		if len(received) == 2 {
+			return errDone
+		}
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("Subscription failed: %v", err)
+	}
+	// both events share the order ID as key, so they keep their order
+	if received[0].EventType() != OrderCreatedType || received[1] != changed {
+		t.Errorf("Unexpected events %+v", received)
+	}
+}
@@ -0,0 +1,89 @@
+package events
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Memory is an in-process Publisher and Subscriber for tests. It keeps every published envelope
+// and passes it to the subscribers running at that time.
+type Memory struct {
+	mu          sync.Mutex
+	published   []Envelope
+	subscribers map[*memorySubscriber]struct{}
+}
+
+type memorySubscriber struct {
+	envelopes chan Envelope
+	// done is closed when the subscription ended, so publishers stop waiting for it
+	done chan struct{}
+}
+
+func NewMemory() *Memory {
+	return &Memory{subscribers: map[*memorySubscriber]struct{}{}}
+}
+
+func (m *Memory) Publish(ctx context.Context, events ...Event) error {
+	envelopes, err := NewEnvelopes(events...)
+	if err != nil {
+		return err
+	}
+	return m.PublishEnvelopes(ctx, envelopes...)
+}
+
+// PublishEnvelopes waits for subscribers that lag behind, but not while holding the lock, so
+// subscriptions can end and others can publish in the meantime.
+func (m *Memory) PublishEnvelopes(ctx context.Context, envelopes ...Envelope) error {
+	m.mu.Lock()
+	m.published = append(m.published, envelopes...)
+	subscribers := slices.Collect(maps.Keys(m.subscribers))
+	m.mu.Unlock()
+
+	for _, s := range subscribers {
+	send:
+		for _, env := range envelopes {
+			select {
+			case s.envelopes <- env:
+			case <-s.done:
+				break send
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// Published returns the envelopes published so far, oldest first.
+func (m *Memory) Published() []Envelope {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.published)
+}
+
+// Subscribe passes the envelopes published from now on to the handler.
+func (m *Memory) Subscribe(ctx context.Context, handler Handler) error {
+	s := &memorySubscriber{envelopes: make(chan Envelope, 64), done: make(chan struct{})}
+	m.mu.Lock()
+	m.subscribers[s] = struct{}{}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.subscribers, s)
+		m.mu.Unlock()
+		close(s.done)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case env := <-s.envelopes:
+			if err := handler(ctx, env); err != nil {
+				return err
+			}
+		}
+	}
+}
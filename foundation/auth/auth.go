@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoKeys       = errors.New("no JWT secret or JWKS file configured")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Config describes the keys and expectations used to verify bearer tokens.
+type Config struct {
+	// Secret is the shared secret for HS256 signed tokens.
+	Secret string
+	// JWKSFile is a local JWKS document holding the public RS256 and EdDSA keys.
+	JWKSFile string
+	// PrivateKeyFile is a PEM encoded PKCS#8 RSA or Ed25519 key used to issue tokens, KeyID names
+	// its public counterpart in the JWKS document. Without it tokens are issued with Secret.
+	PrivateKeyFile string
+	KeyID          string
+	// Issuer and Audience are checked when set.
+	Issuer   string
+	Audience string
+}
+
+// Claims are the JWT claims understood by the application.
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+	// Scopes grant permissions directly, e.g. to API keys.
+	Scopes []Permission `json:"scopes,omitempty"`
+	// Tenant is the tenant the token is valid for.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Verifier validates signed bearer tokens.
+type Verifier struct {
+	secret  []byte
+	keys    *KeySet
+	options []jwt.ParserOption
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	v := &Verifier{}
+	var methods []string
+
+	if cfg.Secret != "" {
+		v.secret = []byte(cfg.Secret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	if cfg.JWKSFile != "" {
+		keys, err := LoadKeySet(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+		methods = append(methods, keys.Algorithms()...)
+	}
+
+	if len(methods) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	v.options = []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if cfg.Issuer != "" {
+		v.options = append(v.options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		v.options = append(v.options, jwt.WithAudience(cfg.Audience))
+	}
+
+	return v, nil
+}
+
+// Verify checks signature, expiry, issuer and audience of the token and returns its claims.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, v.key, v.options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+func (v *Verifier) key(token *jwt.Token) (any, error) {
+	if token.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		return v.secret, nil
+	}
+	if v.keys == nil {
+		return nil, fmt.Errorf("no key for algorithm %s", token.Method.Alg())
+	}
+	kid, _ := token.Header["kid"].(string)
+	return v.keys.Lookup(kid, token.Method.Alg())
+}
+
+// Signer issues tokens.
+type Signer struct {
+	method jwt.SigningMethod
+	key    any
+	kid    string
+}
+
+// NewHS256Signer signs tokens with the shared secret.
+func NewHS256Signer(secret string) *Signer {
+	return &Signer{method: jwt.SigningMethodHS256, key: []byte(secret)}
+}
+
+// NewSigner signs tokens with a private key of the given method, e.g. jwt.SigningMethodRS256 with
+// an *rsa.PrivateKey or jwt.SigningMethodEdDSA with an ed25519.PrivateKey. kid names the matching
+// public key in the JWKS document.
+func NewSigner(method jwt.SigningMethod, key any, kid string) *Signer {
+	return &Signer{method: method, key: key, kid: kid}
+}
+
+// NewSignerFromConfig returns the signer matching the configured keys, preferring the private key.
+func NewSignerFromConfig(cfg Config) (*Signer, error) {
+	if cfg.PrivateKeyFile != "" {
+		return LoadSigner(cfg.PrivateKeyFile, cfg.KeyID)
+	}
+	if cfg.Secret != "" {
+		return NewHS256Signer(cfg.Secret), nil
+	}
+	return nil, ErrNoKeys
+}
+
+// LoadSigner reads a PEM encoded PKCS#8 private key and signs with RS256 or EdDSA accordingly.
+func LoadSigner(path, kid string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return NewSigner(jwt.SigningMethodRS256, k, kid), nil
+	case ed25519.PrivateKey:
+		return NewSigner(jwt.SigningMethodEdDSA, k, kid), nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+func (s *Signer) Sign(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(s.method, claims)
+	if s.kid != "" {
+		token.Header["kid"] = s.kid
+	}
+	return token.SignedString(s.key)
+}
+
+type claimsKey struct{}
+
+// ContextWithClaims returns a copy of ctx carrying the claims of the authenticated caller.
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims of the authenticated caller, if any.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
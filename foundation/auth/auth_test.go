@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func claimsFor(subject string, expiresIn time.Duration) Claims {
+	return Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   subject,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+	}}
+}
+
+func writeJWKS(t *testing.T, rsaKey *rsa.PublicKey, edKey ed25519.PublicKey) string {
+	t.Helper()
+	doc := map[string]any{"keys": []map[string]string{
+		{
+			"kty": "RSA", "kid": "rsa-1", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+		{
+			"kty": "OKP", "kid": "ed-1", "crv": "Ed25519",
+			"x": base64.RawURLEncoding.EncodeToString(edKey),
+		},
+	}}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Failed to marshal JWKS: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+	return path
+}
+
+func TestVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+
+	verifier, err := NewVerifier(Config{Secret: "secret", JWKSFile: writeJWKS(t, &rsaKey.PublicKey, edPublic)})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	tests := map[string]struct {
+		signer  *Signer
+		claims  Claims
+		wantErr bool
+	}{
+		"HS256":          {signer: NewHS256Signer("secret"), claims: claimsFor("alice", time.Hour)},
+		"RS256":          {signer: NewSigner(jwt.SigningMethodRS256, rsaKey, "rsa-1"), claims: claimsFor("alice", time.Hour)},
+		"EdDSA":          {signer: NewSigner(jwt.SigningMethodEdDSA, edPrivate, "ed-1"), claims: claimsFor("alice", time.Hour)},
+		"wrong secret":   {signer: NewHS256Signer("other"), claims: claimsFor("alice", time.Hour), wantErr: true},
+		"unknown kid":    {signer: NewSigner(jwt.SigningMethodRS256, rsaKey, "rsa-2"), claims: claimsFor("alice", time.Hour), wantErr: true},
+		"expired":        {signer: NewHS256Signer("secret"), claims: claimsFor("alice", -time.Minute), wantErr: true},
+		"missing expiry": {signer: NewHS256Signer("secret"), claims: Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "alice"}}, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			token, err := tt.signer.Sign(tt.claims)
+			if err != nil {
+				t.Fatalf("Failed to sign token: %v", err)
+			}
+
+			claims, err := verifier.Verify(token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("Expected ErrInvalidToken, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to verify token: %v", err)
+			}
+			if claims.Subject != "alice" {
+				t.Errorf("Expected subject alice, got %s", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestNewVerifierWithoutKeys(t *testing.T) {
+	if _, err := NewVerifier(Config{}); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("Expected ErrNoKeys, got %v", err)
+	}
+}
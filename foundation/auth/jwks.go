@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jsonWebKey is the subset of RFC 7517 needed for RSA and Ed25519 public keys.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+}
+
+type publicKey struct {
+	kid string
+	alg string
+	key any
+}
+
+// KeySet holds the public keys of a JWKS document.
+type KeySet struct {
+	keys []publicKey
+}
+
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS file: %w", err)
+	}
+	return ParseKeySet(data)
+}
+
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+
+	set := &KeySet{}
+	for _, jwk := range doc.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: %w", jwk.Kid, err)
+		}
+		set.keys = append(set.keys, key)
+	}
+	if len(set.keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no keys")
+	}
+	return set, nil
+}
+
+func (k jsonWebKey) publicKey() (publicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return publicKey{}, fmt.Errorf("modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return publicKey{}, fmt.Errorf("exponent: %w", err)
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return publicKey{kid: k.Kid, alg: jwt.SigningMethodRS256.Alg(), key: key}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return publicKey{}, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return publicKey{}, fmt.Errorf("x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return publicKey{}, fmt.Errorf("invalid Ed25519 key size %d", len(x))
+		}
+		return publicKey{kid: k.Kid, alg: jwt.SigningMethodEdDSA.Alg(), key: ed25519.PublicKey(x)}, nil
+	default:
+		return publicKey{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// Algorithms returns the signing algorithms covered by the key set.
+func (s *KeySet) Algorithms() []string {
+	var algs []string
+	seen := map[string]bool{}
+	for _, k := range s.keys {
+		if !seen[k.alg] {
+			seen[k.alg] = true
+			algs = append(algs, k.alg)
+		}
+	}
+	return algs
+}
+
+// Lookup returns the key with the given kid. Without a kid the only key of the algorithm is used.
+func (s *KeySet) Lookup(kid, alg string) (any, error) {
+	var candidates []publicKey
+	for _, k := range s.keys {
+		if k.alg != alg {
+			continue
+		}
+		if kid != "" && k.kid == kid {
+			return k.key, nil
+		}
+		candidates = append(candidates, k)
+	}
+	if kid == "" && len(candidates) == 1 {
+		return candidates[0].key, nil
+	}
+	return nil, fmt.Errorf("no %s key with kid %q", alg, kid)
+}
@@ -0,0 +1,90 @@
+package auth
+
+import "slices"
+
+// Permission names an action on a resource, e.g. order:write.
+type Permission string
+
+const (
+	PermUserRead       Permission = "user:read"
+	PermUserWrite      Permission = "user:write"
+	PermRoleManage     Permission = "role:manage"
+	PermCustomerRead   Permission = "customer:read"
+	PermCustomerWrite  Permission = "customer:write"
+	PermCustomerDelete Permission = "customer:delete"
+	PermProductRead    Permission = "product:read"
+	PermProductWrite   Permission = "product:write"
+	PermProductDelete  Permission = "product:delete"
+	PermOrderRead      Permission = "order:read"
+	PermOrderWrite     Permission = "order:write"
+	PermOrderDelete    Permission = "order:delete"
+	PermAPIKeyManage   Permission = "apikey:manage"
+	PermWebhookManage  Permission = "webhook:manage"
+)
+
+var permissions = []Permission{
+	PermUserRead, PermUserWrite, PermRoleManage,
+	PermCustomerRead, PermCustomerWrite, PermCustomerDelete,
+	PermProductRead, PermProductWrite, PermProductDelete,
+	PermOrderRead, PermOrderWrite, PermOrderDelete,
+	PermAPIKeyManage, PermWebhookManage,
+}
+
+// IsPermission reports whether p is a known permission.
+func IsPermission(p Permission) bool {
+	return slices.Contains(permissions, p)
+}
+
+const (
+	RoleAdmin    = "admin"
+	RoleSupport  = "support"
+	RoleCustomer = "customer"
+)
+
+// rolePermissions grants permissions to roles. Admins may do anything.
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: nil,
+	RoleSupport: {
+		PermUserRead,
+		PermCustomerRead, PermCustomerWrite,
+		PermProductRead,
+		PermOrderRead, PermOrderWrite,
+	},
+	RoleCustomer: {
+		PermCustomerRead,
+		PermProductRead,
+		PermOrderRead, PermOrderWrite,
+	},
+}
+
+// Roles returns the known role names.
+func Roles() []string {
+	return []string{RoleAdmin, RoleSupport, RoleCustomer}
+}
+
+// IsRole reports whether name is a known role.
+func IsRole(name string) bool {
+	_, ok := rolePermissions[name]
+	return ok
+}
+
+// RoleHas reports whether the role grants the permission.
+func RoleHas(role string, p Permission) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	return slices.Contains(rolePermissions[role], p)
+}
+
+// Can reports whether the caller was granted the permission as scope or by any of its roles.
+func (c *Claims) Can(p Permission) bool {
+	if slices.Contains(c.Scopes, p) {
+		return true
+	}
+	for _, role := range c.Roles {
+		if RoleHas(role, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces the values of redacted fields.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactedFields are the log fields that carry personal data or credentials.
+var DefaultRedactedFields = []string{
+	"email", "name", "password", "token", "access_token", "refresh_token", "authorization", "api_key",
+}
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// RedactingWriter removes personal data from JSON log lines before passing them on: the values
+// of the configured fields are replaced at any depth, and e-mail addresses are masked wherever
+// they appear, e.g. inside error messages. Lines that are not JSON only get the e-mail masking.
+// Fields keep their order and lines without anything to redact are passed on as they are.
+type RedactingWriter struct {
+	out    io.Writer
+	fields map[string]bool
+	// keys matches lines that may contain one of the fields as a key
+	keys *regexp.Regexp
+}
+
+// NewRedactingWriter wraps out, fields are matched case-insensitively.
+func NewRedactingWriter(out io.Writer, fields ...string) *RedactingWriter {
+	w := &RedactingWriter{out: out, fields: make(map[string]bool, len(fields))}
+	quoted := make([]string, 0, len(fields))
+	for _, f := range fields {
+		w.fields[strings.ToLower(f)] = true
+		quoted = append(quoted, regexp.QuoteMeta(f))
+	}
+	if len(quoted) > 0 {
+		w.keys = regexp.MustCompile(`(?i)"(?:` + strings.Join(quoted, "|") + `)"\s*:`)
+	}
+	return w
+}
+
+var redactBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// Write redacts a single log line, zerolog writes every event with one call.
+func (w *RedactingWriter) Write(p []byte) (int, error) {
+	if !w.needsRedaction(p) {
+		return w.out.Write(p)
+	}
+
+	buf := redactBuffers.Get().(*bytes.Buffer)
+	defer redactBuffers.Put(buf)
+	buf.Reset()
+	if err := w.redactTo(buf, p); err != nil {
+		buf.Reset()
+		buf.Write(emailPattern.ReplaceAll(p, []byte(Redacted)))
+	}
+	if _, err := w.out.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Redact returns the redacted form of a log line.
+func (w *RedactingWriter) Redact(line []byte) []byte {
+	if !w.needsRedaction(line) {
+		return line
+	}
+	var buf bytes.Buffer
+	if err := w.redactTo(&buf, line); err != nil {
+		return emailPattern.ReplaceAll(line, []byte(Redacted))
+	}
+	return buf.Bytes()
+}
+
+func (w *RedactingWriter) needsRedaction(line []byte) bool {
+	return bytes.IndexByte(line, '@') >= 0 || (w.keys != nil && w.keys.Match(line))
+}
+
+// redactFrame is an object or array the rewrite is inside of.
+type redactFrame struct {
+	object bool
+	// key is set in an object when the next token is a key
+	key bool
+	n   int
+}
+
+// redactTo rewrites a JSON line token by token, so the fields keep their order and strings are
+// only re-encoded, not HTML-escaped like json.Marshal does.
+func (w *RedactingWriter) redactTo(buf *bytes.Buffer, line []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	writeString := func(s string) error {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+		buf.Truncate(buf.Len() - 1) // Encode terminates with a newline
+		return nil
+	}
+
+	var stack []redactFrame
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var top *redactFrame
+		if len(stack) > 0 {
+			top = &stack[len(stack)-1]
+		}
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			buf.WriteByte(byte(delim))
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 {
+				stack[len(stack)-1].value()
+			}
+			continue
+		}
+
+		if top != nil && top.object && top.key {
+			key := tok.(string)
+			if top.n > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeString(key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			top.key = false
+			if w.fields[strings.ToLower(key)] {
+				var skipped json.RawMessage
+				if err := dec.Decode(&skipped); err != nil {
+					return err
+				}
+				if err := writeString(Redacted); err != nil {
+					return err
+				}
+				top.value()
+			}
+			continue
+		}
+
+		if top != nil && !top.object && top.n > 0 {
+			buf.WriteByte(',')
+		}
+		switch v := tok.(type) {
+		case json.Delim:
+			buf.WriteByte(byte(v))
+			stack = append(stack, redactFrame{object: v == '{', key: v == '{'})
+			continue
+		case string:
+			err = writeString(emailPattern.ReplaceAllString(v, Redacted))
+		case json.Number:
+			buf.WriteString(v.String())
+		case bool:
+			if v {
+				buf.WriteString("true")
+			} else {
+				buf.WriteString("false")
+			}
+		case nil:
+			buf.WriteString("null")
+		}
+		if err != nil {
+			return err
+		}
+		if top != nil {
+			top.value()
+		}
+	}
+	buf.WriteByte('\n')
+	return nil
+}
+
+// value records that a value of the frame was written.
+func (f *redactFrame) value() {
+	f.n++
+	if f.object {
+		f.key = true
+	}
+}
@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRedactingWriter(t *testing.T) {
+	tests := map[string]struct {
+		log      func(l zerolog.Logger)
+		want     []string
+		wantGone []string
+	}{
+		"fields": {
+			log: func(l zerolog.Logger) {
+				l.Info().Str("email", "jane@example.com").Str("Name", "Jane Doe").Str("status", "open").Msg("Customer created")
+			},
+			want:     []string{`"email":"[REDACTED]"`, `"Name":"[REDACTED]"`, `"status":"open"`},
+			wantGone: []string{"jane@example.com", "Jane Doe"},
+		},
+		"nested fields": {
+			log: func(l zerolog.Logger) {
+				l.Info().Interface("customer", map[string]any{"name": "Jane Doe", "tags": []any{map[string]any{"name": "vip"}}}).Msg("Imported")
+			},
+			wantGone: []string{"Jane Doe", "vip"},
+		},
+		"e-mail inside a message": {
+			log: func(l zerolog.Logger) {
+				l.Error().Err(errors.New(`duplicate key value (email)=(jane@example.com)`)).Msg("Insert failed")
+			},
+			want:     []string{"duplicate key value"},
+			wantGone: []string{"jane@example.com"},
+		},
+		"numbers keep their precision": {
+			log: func(l zerolog.Logger) {
+				l.Info().Int64("rows", 9007199254740993).Msg("Export done")
+			},
+			want: []string{`"rows":9007199254740993`},
+		},
+		"fields keep their order and html": {
+			log: func(l zerolog.Logger) {
+				l.Info().Str("query", "a<b && c>d").Str("token", "secret").Int("rows", 2).Msg("Search")
+			},
+			want:     []string{`{"level":"info","query":"a<b && c>d","token":"[REDACTED]","rows":2,"message":"Search"}`},
+			wantGone: []string{"secret"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tc.log(zerolog.New(NewRedactingWriter(&buf, DefaultRedactedFields...)))
+
+			line := buf.String()
+			if !strings.HasSuffix(line, "\n") {
+				t.Errorf("expected a terminated line, got %q", line)
+			}
+			for _, s := range tc.want {
+				if !strings.Contains(line, s) {
+					t.Errorf("expected %q in %s", s, line)
+				}
+			}
+			for _, s := range tc.wantGone {
+				if strings.Contains(line, s) {
+					t.Errorf("expected %q to be redacted in %s", s, line)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactingWriterPlainText(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewRedactingWriter(&buf, DefaultRedactedFields...)
+	if _, err := w.Write([]byte("login failed for jane@example.com\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "login failed for [REDACTED]\n" {
+		t.Errorf("unexpected line %q", got)
+	}
+}
+
+func TestRedactingWriterPassesCleanLinesOn(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewRedactingWriter(&buf, DefaultRedactedFields...)
+	line := []byte(`{"level":"info","status":"open","html":"<b>","message":"Order created"}` + "\n")
+	if _, err := w.Write(line); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(line) {
+		t.Errorf("expected the line unchanged, got %q", got)
+	}
+}
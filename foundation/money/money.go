@@ -0,0 +1,378 @@
+// Package money provides an exact decimal amount of a currency. Amounts have two decimal places,
+// like the NUMERIC(10,2) columns they are stored in, and are kept as an integer count of
+// hundredths, so sums don't drift the way float64 does. This holds for every currency: amounts of
+// currencies without minor units, like JPY, have to be whole, and currencies with more than two
+// decimal places, like KWD, are not supported. Only the JSON minor unit format follows the ISO 4217
+// exponent of the currency, see FormatMinorUnits.
+package money
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultCurrency is the currency of the amounts stored before currencies were recorded.
+const DefaultCurrency = "EUR"
+
+var (
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrInvalidCurrency  = errors.New("invalid currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// IsInvalid reports whether err is one of the validation errors of this package.
+func IsInvalid(err error) bool {
+	return errors.Is(err, ErrInvalidAmount) || errors.Is(err, ErrInvalidCurrency) || errors.Is(err, ErrCurrencyMismatch)
+}
+
+// MaxCents bounds amounts to what the NUMERIC(10,2) columns hold, 99999999.99.
+const MaxCents = 1e10 - 1
+
+var amountPattern = regexp.MustCompile(`^(-)?(\d{1,16})(?:\.(\d+))?$`)
+
+// Money is an amount of a currency. It is stored as the amount in a NUMERIC column, see Scan and
+// Value; the currency has a column of its own, mapped with sqlx as "<field>.currency".
+type Money struct {
+	// Cents is the amount in hundredths of the currency unit.
+	Cents    int64
+	Currency string `db:"currency"`
+}
+
+// New returns the amount of cents hundredths of the currency.
+func New(cents int64, currency string) Money {
+	return Money{Cents: cents, Currency: currency}
+}
+
+// ParseAmount parses a decimal amount like "19.99" of the currency. More than two decimal
+// places are only accepted if they are zero, amounts are never rounded.
+func ParseAmount(amount, currency string) (Money, error) {
+	m := amountPattern.FindStringSubmatch(amount)
+	if m == nil {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidAmount, amount)
+	}
+	fraction := m[3]
+	if len(fraction) > 2 {
+		if strings.Trim(fraction[2:], "0") != "" {
+			return Money{}, fmt.Errorf("%w %q: more than two decimal places", ErrInvalidAmount, amount)
+		}
+		fraction = fraction[:2]
+	}
+	units, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w %q", ErrInvalidAmount, amount)
+	}
+	cents := units * 100
+	if fraction != "" {
+		f, _ := strconv.ParseInt(fraction, 10, 64)
+		if len(fraction) == 1 {
+			f *= 10
+		}
+		cents += f
+	}
+	if m[1] == "-" {
+		cents = -cents
+	}
+	return Money{Cents: cents, Currency: currency}, nil
+}
+
+// Parse parses the text form of String, like "19.99 EUR".
+func Parse(s string) (Money, error) {
+	amount, currency, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return Money{}, fmt.Errorf("%w in %q", ErrInvalidCurrency, s)
+	}
+	m, err := ParseAmount(amount, strings.TrimSpace(currency))
+	if err != nil {
+		return Money{}, err
+	}
+	return m, m.Validate()
+}
+
+// Amount returns the decimal amount without currency, like "19.99".
+func (m Money) Amount() string {
+	cents := m.Cents
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// String returns the amount followed by the currency, like "19.99 EUR".
+func (m Money) String() string {
+	return m.Amount() + " " + m.Currency
+}
+
+// Validate checks that the currency is an ISO 4217 code amounts can be kept in hundredths of,
+// and that the amount can be stored.
+func (m Money) Validate() error {
+	units, ok := MinorUnits(m.Currency)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrInvalidCurrency, m.Currency)
+	}
+	if units > 2 {
+		return fmt.Errorf("%w %q: %d decimal places are not supported", ErrInvalidCurrency, m.Currency, units)
+	}
+	if err := checkBounds(m.Cents); err != nil {
+		return err
+	}
+	if units == 0 && m.Cents%100 != 0 {
+		return fmt.Errorf("%w %s: %s has no minor units", ErrInvalidAmount, m.Amount(), m.Currency)
+	}
+	return nil
+}
+
+// IsPositive reports whether the amount is greater than zero.
+func (m Money) IsPositive() bool {
+	return m.Cents > 0
+}
+
+// Add returns the sum of two amounts of the same currency. Sums beyond MaxCents fail with
+// ErrInvalidAmount, they could not be stored.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	if err := checkBounds(m.Cents, other.Cents); err != nil {
+		return Money{}, err
+	}
+	sum := Money{Cents: m.Cents + other.Cents, Currency: m.Currency}
+	if err := checkBounds(sum.Cents); err != nil {
+		return Money{}, err
+	}
+	return sum, nil
+}
+
+// Mul returns the amount multiplied by n, e.g. the price of n items. Products beyond MaxCents fail
+// with ErrInvalidAmount.
+func (m Money) Mul(n int64) (Money, error) {
+	if err := checkBounds(m.Cents); err != nil {
+		return Money{}, err
+	}
+	if n != 0 && (n > MaxCents || n < -MaxCents || abs(m.Cents) > MaxCents/abs(n)) {
+		return Money{}, fmt.Errorf("%w: %s times %d exceeds %s", ErrInvalidAmount, m.Amount(), n, New(MaxCents, m.Currency).Amount())
+	}
+	return Money{Cents: m.Cents * n, Currency: m.Currency}, nil
+}
+
+// checkBounds fails with ErrInvalidAmount if one of the amounts exceeds MaxCents, which also keeps
+// sums and products of them within int64.
+func checkBounds(cents ...int64) error {
+	for _, c := range cents {
+		if c > MaxCents || c < -MaxCents {
+			return fmt.Errorf("%w %s: exceeds %s", ErrInvalidAmount, New(c, "").Amount(), New(MaxCents, "").Amount())
+		}
+	}
+	return nil
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Sum adds up amounts of the same currency; the sum of none is zero without currency.
+func Sum(amounts ...Money) (Money, error) {
+	if len(amounts) == 0 {
+		return Money{}, nil
+	}
+	sum := amounts[0]
+	for _, m := range amounts[1:] {
+		var err error
+		if sum, err = sum.Add(m); err != nil {
+			return Money{}, err
+		}
+	}
+	return sum, nil
+}
+
+// Format is the JSON representation of amounts.
+type Format int32
+
+const (
+	// FormatDecimal renders amounts as decimal strings, {"amount":"19.99","currency":"EUR"}.
+	FormatDecimal Format = iota
+	// FormatMinorUnits renders amounts as an integer count of the currency's ISO 4217 minor unit,
+	// {"amount":1999,"currency":"EUR"} but {"amount":500,"currency":"JPY"} for 500 yen.
+	FormatMinorUnits
+)
+
+var jsonFormat atomic.Int32
+
+// SetJSONFormat sets how amounts are rendered as JSON, FormatDecimal by default. Both formats are
+// accepted when decoding.
+func SetJSONFormat(f Format) {
+	jsonFormat.Store(int32(f))
+}
+
+// ParseFormat parses "decimal" or "minor"; an empty string is FormatDecimal.
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "", "decimal":
+		return FormatDecimal, nil
+	case "minor":
+		return FormatMinorUnits, nil
+	}
+	return 0, fmt.Errorf("unknown money format %q", s)
+}
+
+type jsonMoney struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	amount := strconv.Quote(m.Amount())
+	if Format(jsonFormat.Load()) == FormatMinorUnits {
+		minor, err := m.minorUnits()
+		if err != nil {
+			return nil, err
+		}
+		amount = strconv.FormatInt(minor, 10)
+	}
+	return json.Marshal(jsonMoney{Amount: json.RawMessage(amount), Currency: m.Currency})
+}
+
+// UnmarshalJSON accepts the amount as decimal string or as integer count of the currency's minor
+// unit.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var v jsonMoney
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if len(v.Amount) == 0 {
+		return fmt.Errorf("%w: missing", ErrInvalidAmount)
+	}
+	if v.Amount[0] == '"' {
+		var amount string
+		if err := json.Unmarshal(v.Amount, &amount); err != nil {
+			return err
+		}
+		parsed, err := ParseAmount(amount, v.Currency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+	minor, err := strconv.ParseInt(string(v.Amount), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w %s: minor units have to be an integer", ErrInvalidAmount, v.Amount)
+	}
+	parsed, err := fromMinorUnits(minor, v.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// exponent returns the ISO 4217 exponent of the currency, 2 for unknown codes, which Validate
+// rejects anyway.
+func exponent(currency string) int {
+	if units, ok := MinorUnits(currency); ok {
+		return units
+	}
+	return 2
+}
+
+// minorUnits returns the amount as a count of the currency's minor unit.
+func (m Money) minorUnits() (int64, error) {
+	switch exp := exponent(m.Currency); {
+	case exp < 2:
+		scale := pow10(2 - exp)
+		if m.Cents%scale != 0 {
+			return 0, fmt.Errorf("%w %s: %s has %d decimal places", ErrInvalidAmount, m.Amount(), m.Currency, exp)
+		}
+		return m.Cents / scale, nil
+	case exp > 2:
+		scale := pow10(exp - 2)
+		if m.Cents > math.MaxInt64/scale || m.Cents < math.MinInt64/scale {
+			return 0, fmt.Errorf("%w %s: too large", ErrInvalidAmount, m.Amount())
+		}
+		return m.Cents * scale, nil
+	}
+	return m.Cents, nil
+}
+
+// fromMinorUnits returns the amount of minor units of the currency.
+func fromMinorUnits(minor int64, currency string) (Money, error) {
+	switch exp := exponent(currency); {
+	case exp < 2:
+		scale := pow10(2 - exp)
+		if minor > math.MaxInt64/scale || minor < math.MinInt64/scale {
+			return Money{}, fmt.Errorf("%w %d: too large", ErrInvalidAmount, minor)
+		}
+		return Money{Cents: minor * scale, Currency: currency}, nil
+	case exp > 2:
+		scale := pow10(exp - 2)
+		if minor%scale != 0 {
+			return Money{}, fmt.Errorf("%w %d: more than two decimal places of %s", ErrInvalidAmount, minor, currency)
+		}
+		return Money{Cents: minor / scale, Currency: currency}, nil
+	}
+	return Money{Cents: minor, Currency: currency}, nil
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for range n {
+		p *= 10
+	}
+	return p
+}
+
+// MarshalText renders the text form of String, used for XML, CSV and MessagePack.
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads the amount from a NUMERIC column, the currency is left as it is.
+func (m *Money) Scan(src any) error {
+	var amount string
+	switch v := src.(type) {
+	case []byte:
+		amount = string(v)
+	case string:
+		amount = v
+	case int64:
+		m.Cents = v * 100
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money", src)
+	}
+	parsed, err := ParseAmount(amount, m.Currency)
+	if err != nil {
+		return err
+	}
+	m.Cents = parsed.Cents
+	return nil
+}
+
+// Value writes the amount to a NUMERIC column; the currency has to be written separately.
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount(), nil
+}
@@ -0,0 +1,227 @@
+package money
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := map[string]struct {
+		amount string
+		cents  int64
+		err    error
+	}{
+		"cents":           {amount: "29.99", cents: 2999},
+		"units":           {amount: "30", cents: 3000},
+		"one place":       {amount: "0.5", cents: 50},
+		"negative":        {amount: "-1.05", cents: -105},
+		"trailing zeros":  {amount: "1.2500", cents: 125},
+		"three places":    {amount: "1.255", err: ErrInvalidAmount},
+		"float notation":  {amount: "1e3", err: ErrInvalidAmount},
+		"empty":           {amount: "", err: ErrInvalidAmount},
+		"missing integer": {amount: ".5", err: ErrInvalidAmount},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := ParseAmount(tt.amount, "EUR")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if err == nil && (m.Cents != tt.cents || m.Currency != "EUR") {
+				t.Errorf("Expected %d EUR cents, got %+v", tt.cents, m)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	for cents, want := range map[int64]string{2999: "29.99 EUR", 5: "0.05 EUR", -105: "-1.05 EUR", 0: "0.00 EUR"} {
+		m := New(cents, "EUR")
+		if got := m.String(); got != want {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		parsed, err := Parse(want)
+		if err != nil || parsed != m {
+			t.Errorf("Expected %s to parse to %+v, got %+v, %v", want, m, parsed, err)
+		}
+	}
+	if _, err := Parse("29.99 euro"); !errors.Is(err, ErrInvalidCurrency) {
+		t.Errorf("Expected ErrInvalidCurrency, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		money Money
+		err   error
+	}{
+		"euro":                    {money: New(2999, "EUR")},
+		"largest amount":          {money: New(MaxCents, "EUR")},
+		"largest negative amount": {money: New(-MaxCents, "EUR")},
+		"too large":               {money: New(MaxCents+1, "EUR"), err: ErrInvalidAmount},
+		"too small":               {money: New(-MaxCents-1, "EUR"), err: ErrInvalidAmount},
+		"unassigned code":         {money: New(100, "ABC"), err: ErrInvalidCurrency},
+		"lowercase code":          {money: New(100, "eur"), err: ErrInvalidCurrency},
+		"whole yen":               {money: New(150000, "JPY")},
+		"fraction of a yen":       {money: New(150050, "JPY"), err: ErrInvalidAmount},
+		"three decimal places":    {money: New(1000, "KWD"), err: ErrInvalidCurrency},
+		"without currency":        {money: New(100, ""), err: ErrInvalidCurrency},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := tt.money.Validate(); !errors.Is(err, tt.err) {
+				t.Errorf("Expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestSum(t *testing.T) {
+	// 0.1 + 0.2 and ten times 2.999 are the classic float64 artifacts
+	items, err := New(2999, "EUR").Mul(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := Sum(New(10, "EUR"), New(20, "EUR"), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.String() != "300.20 EUR" {
+		t.Errorf("Expected 300.20 EUR, got %s", sum)
+	}
+
+	if _, err := Sum(New(100, "EUR"), New(100, "USD")); !errors.Is(err, ErrCurrencyMismatch) || !IsInvalid(err) {
+		t.Errorf("Expected ErrCurrencyMismatch, got %v", err)
+	}
+	if sum, err := Sum(); err != nil || sum != (Money{}) {
+		t.Errorf("Expected zero, got %+v, %v", sum, err)
+	}
+
+	// totals that could not be stored fail instead of overflowing
+	if _, err := Sum(New(MaxCents, "EUR"), New(1, "EUR")); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Expected ErrInvalidAmount for a sum above MaxCents, got %v", err)
+	}
+	for _, n := range []int64{100000000, math.MaxInt64, math.MinInt64} {
+		if _, err := New(100, "EUR").Mul(n); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Expected ErrInvalidAmount for 1.00 times %d, got %v", n, err)
+		}
+	}
+	if m, err := New(-100, "EUR").Mul(99999999); err != nil || m.Cents != -MaxCents+99 {
+		t.Errorf("Expected -99999999.00, got %+v, %v", m, err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	defer SetJSONFormat(FormatDecimal)
+	m := New(2999, "USD")
+
+	for format, want := range map[Format]string{
+		FormatDecimal:    `{"amount":"29.99","currency":"USD"}`,
+		FormatMinorUnits: `{"amount":2999,"currency":"USD"}`,
+	} {
+		SetJSONFormat(format)
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("Expected %s, got %s", want, data)
+		}
+		// both formats decode whatever the configured format
+		var decoded Money
+		for _, in := range []string{`{"amount":"29.99","currency":"USD"}`, `{"amount":2999,"currency":"USD"}`} {
+			if err := json.Unmarshal([]byte(in), &decoded); err != nil || decoded != m {
+				t.Errorf("Expected %s to decode to %+v, got %+v, %v", in, m, decoded, err)
+			}
+		}
+	}
+
+	var decoded Money
+	for _, in := range []string{`{"amount":29.99,"currency":"USD"}`, `{"currency":"USD"}`, `{"amount":"29.999","currency":"USD"}`} {
+		if err := json.Unmarshal([]byte(in), &decoded); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Expected ErrInvalidAmount for %s, got %v", in, err)
+		}
+	}
+}
+
+func TestJSONMinorUnits(t *testing.T) {
+	defer SetJSONFormat(FormatDecimal)
+	SetJSONFormat(FormatMinorUnits)
+
+	// minor units follow the ISO 4217 exponent of the currency
+	tests := map[string]struct {
+		money Money
+		json  string
+	}{
+		"hundredths":       {money: New(2999, "USD"), json: `{"amount":2999,"currency":"USD"}`},
+		"no minor units":   {money: New(50000, "JPY"), json: `{"amount":500,"currency":"JPY"}`},
+		"negative yen":     {money: New(-50000, "KRW"), json: `{"amount":-500,"currency":"KRW"}`},
+		"thousandths":      {money: New(150, "BHD"), json: `{"amount":1500,"currency":"BHD"}`},
+		"unknown currency": {money: New(2999, "XXX"), json: `{"amount":2999,"currency":"XXX"}`},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(tc.money)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tc.json {
+				t.Errorf("Expected %s, got %s", tc.json, data)
+			}
+			var decoded Money
+			if err := json.Unmarshal(data, &decoded); err != nil || decoded != tc.money {
+				t.Errorf("Expected %s to decode to %+v, got %+v, %v", data, tc.money, decoded, err)
+			}
+		})
+	}
+
+	var decoded Money
+	if err := json.Unmarshal([]byte(`{"amount":"500","currency":"JPY"}`), &decoded); err != nil || decoded != New(50000, "JPY") {
+		t.Errorf("Expected the decimal 500 to be 500 yen, got %+v, %v", decoded, err)
+	}
+	for _, in := range []string{`{"amount":1505,"currency":"BHD"}`, `{"amount":9223372036854775807,"currency":"JPY"}`} {
+		if err := json.Unmarshal([]byte(in), &decoded); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Expected ErrInvalidAmount for %s, got %v", in, err)
+		}
+	}
+	if _, err := json.Marshal(New(50050, "JPY")); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Expected fractions of yen not to marshal, got %v", err)
+	}
+}
+
+func TestXML(t *testing.T) {
+	type product struct {
+		Price Money `xml:"price"`
+	}
+	data, err := xml.Marshal(product{Price: New(1999, "EUR")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "<product><price>19.99 EUR</price></product>" {
+		t.Errorf("Unexpected XML %s", data)
+	}
+	var decoded product
+	if err := xml.Unmarshal(data, &decoded); err != nil || decoded.Price != New(1999, "EUR") {
+		t.Errorf("Expected 19.99 EUR, got %+v, %v", decoded.Price, err)
+	}
+}
+
+func TestScanValue(t *testing.T) {
+	m := Money{Currency: "EUR"}
+	if err := m.Scan([]byte("29.99")); err != nil {
+		t.Fatal(err)
+	}
+	if m != New(2999, "EUR") {
+		t.Errorf("Expected 29.99 EUR, got %+v", m)
+	}
+	v, err := m.Value()
+	if err != nil || v != "29.99" {
+		t.Errorf("Expected 29.99, got %v, %v", v, err)
+	}
+	if err := m.Scan(nil); err == nil {
+		t.Error("Expected NULL not to scan")
+	}
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// maxParameters is the number of bind parameters Postgres accepts per statement.
+const maxParameters = 65535
+
+// InsertRows inserts the rows with multi-row insert statements, as few as the parameter limit of
+// Postgres allows. Every row has to provide a value per column.
+func InsertRows(ctx context.Context, db sqlx.ExecerContext, table string, columns []string, rows [][]any) error {
+	perStatement := maxParameters / len(columns)
+	for len(rows) > 0 {
+		n := min(len(rows), perStatement)
+		if err := insertRows(ctx, db, table, columns, rows[:n]); err != nil {
+			return err
+		}
+		rows = rows[n:]
+	}
+	return nil
+}
+
+func insertRows(ctx context.Context, db sqlx.ExecerContext, table string, columns []string, rows [][]any) error {
+	var query strings.Builder
+	fmt.Fprintf(&query, "insert into %s (%s) values ", table, strings.Join(columns, ", "))
+	args := make([]any, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return fmt.Errorf("insert into %s: row %d has %d values for %d columns", table, i, len(row), len(columns))
+		}
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteByte('(')
+		for j, value := range row {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			args = append(args, value)
+			fmt.Fprintf(&query, "$%d", len(args))
+		}
+		query.WriteByte(')')
+	}
+
+	_, err := db.ExecContext(ctx, query.String(), args...)
+	return err
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultFetchSize is the number of rows fetched from a cursor per round trip.
+const DefaultFetchSize = 500
+
+// StreamRows runs the query with a server-side cursor inside tx and calls fn for every row,
+// fetching fetchSize rows at a time, so memory stays flat for large results. Returning an error
+// from fn or cancelling ctx stops the stream.
+func StreamRows[T any](ctx context.Context, tx *sqlx.Tx, fetchSize int, fn func(T) error, query string, args ...any) error {
+	if fetchSize <= 0 {
+		fetchSize = DefaultFetchSize
+	}
+
+	if _, err := tx.ExecContext(ctx, "declare stream_cursor no scroll cursor for "+query, args...); err != nil {
+		return fmt.Errorf("declare cursor: %w", err)
+	}
+
+	fetch := fmt.Sprintf("fetch forward %d from stream_cursor", fetchSize)
+	for {
+		n, err := fetchRows(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		if n < fetchSize {
+			break
+		}
+	}
+	_, err := tx.ExecContext(ctx, "close stream_cursor")
+	return err
+}
+
+func fetchRows[T any](ctx context.Context, tx *sqlx.Tx, fetch string, fn func(T) error) (int, error) {
+	rows, err := tx.QueryxContext(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	n := 0
+	for rows.Next() {
+		var row T
+		if err := rows.StructScan(&row); err != nil {
+			return n, err
+		}
+		n++
+		if err := fn(row); err != nil {
+			return n, err
+		}
+	}
+	return n, errors.Join(rows.Err(), ctx.Err())
+}
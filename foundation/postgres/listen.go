@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Notification is a NOTIFY received by Listen.
+type Notification struct {
+	Channel string
+	Payload string
+	// Reconnected is set instead of a payload after the connection was lost and re-established.
+	// Notifications sent in between are lost, so listeners should reload what they cache.
+	Reconnected bool
+}
+
+// Change is the payload the change triggers of the tables send, see Notification.Change.
+type Change struct {
+	TenantID string `json:"tenant_id"`
+	ID       string `json:"id"`
+}
+
+// Change decodes the payload of a change notification. The channels are shared by all tenants;
+// listeners act on the changes of the tenants they serve.
+func (n Notification) Change() (Change, error) {
+	var c Change
+	if err := json.Unmarshal([]byte(n.Payload), &c); err != nil {
+		return Change{}, fmt.Errorf("invalid change notification %q: %w", n.Payload, err)
+	}
+	return c, nil
+}
+
+const (
+	listenMinReconnect = time.Second
+	listenMaxReconnect = time.Minute
+	// listenPingInterval detects connections that died silently.
+	listenPingInterval = 90 * time.Second
+)
+
+// Listen subscribes to a NOTIFY channel on a dedicated connection and delivers its notifications
+// until ctx is done, then closes the returned channel. A lost connection is re-established and the
+// channel subscribed again. Listen blocks until the subscription is acknowledged.
+func (p *Db) Listen(ctx context.Context, channel string) (<-chan Notification, error) {
+	listener := pq.NewListener(p.connString(), listenMinReconnect, listenMaxReconnect, nil)
+	// Close ends a Listen waiting for the database, and the loop below
+	stop := context.AfterFunc(ctx, func() { _ = listener.Close() })
+	if err := listener.Listen(channel); err != nil {
+		stop()
+		_ = listener.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("listen %s: %w", channel, err)
+	}
+
+	notifications := make(chan Notification, 32)
+	go func() {
+		defer close(notifications)
+		defer stop()
+		defer func() { _ = listener.Close() }()
+
+		ping := time.NewTicker(listenPingInterval)
+		defer ping.Stop()
+		for {
+			var n Notification
+			select {
+			case <-ctx.Done():
+				return
+			case <-ping.C:
+				// a failed ping makes the listener reconnect
+				_ = listener.Ping()
+				continue
+			case pn, ok := <-listener.Notify:
+				if !ok {
+					return
+				}
+				if pn == nil {
+					n = Notification{Channel: channel, Reconnected: true}
+				} else {
+					n = Notification{Channel: pn.Channel, Payload: pn.Extra}
+				}
+			}
+			select {
+			case notifications <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return notifications, nil
+}
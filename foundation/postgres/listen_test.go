@@ -0,0 +1,122 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	test "github.com/romanWienicke/go-app-test/foundation/testing"
+)
+
+func TestPostgresListen(t *testing.T) {
+	test.SetEnv(t, "../../.env")
+	dc := test.DockerComposeUp(t, "../../docker-compose.yaml", "postgres")
+	test.SetupDatabaseEnv(t, dc["postgres"])
+	db := test.InitPostgres(t, "../../migrations")
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Failed to close db: %v", err)
+		}
+	}()
+
+	t.Cleanup(func() {
+		t.Helper()
+		test.DockerComposeDown(t, "../../docker-compose.yaml")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := db.Listen(ctx, "customers_changed")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	next := func() postgres.Notification {
+		t.Helper()
+		select {
+		case n := <-changes:
+			return n
+		case <-time.After(10 * time.Second):
+			t.Fatal("No notification received")
+			return postgres.Notification{}
+		}
+	}
+	insert := func() uuid.UUID {
+		t.Helper()
+		id := uuid.New()
+		if _, err := db.GetDB().ExecContext(ctx, "insert into customers (id, name, email, tenant_id) values ($1, 'Bob', $2, 'default');",
+			id, id.String()+"@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	change := func(n postgres.Notification) postgres.Change {
+		t.Helper()
+		c, err := n.Change()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	id := insert()
+	if n := next(); n.Channel != "customers_changed" || change(n) != (postgres.Change{TenantID: "default", ID: id.String()}) {
+		t.Errorf("Expected customers_changed with %s of the default tenant, got %+v", id, n)
+	}
+
+	// the listener reconnects and listens again after losing its connection
+	if _, err := db.GetDB().ExecContext(ctx,
+		"select pg_terminate_backend(pid) from pg_stat_activity where query like 'LISTEN%';"); err != nil {
+		t.Fatal(err)
+	}
+	if n := next(); !n.Reconnected {
+		t.Errorf("Expected a reconnect, got %+v", n)
+	}
+	id = insert()
+	if n := next(); change(n).ID != id.String() {
+		t.Errorf("Expected %s after the reconnect, got %+v", id, n)
+	}
+
+	// the items of an order notify once per statement, not once per row
+	orders, err := db.Listen(ctx, "orders_changed")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	productID, orderID := uuid.New(), uuid.New()
+	for _, stmt := range []struct {
+		query string
+		args  []any
+	}{
+		{"insert into products (id, name, price, currency, tenant_id) values ($1, 'Bolt', 1, 'EUR', 'default');", []any{productID}},
+		{"insert into orders (id, customer_id, status, total, currency, tenant_id) values ($1, $2, 'pending', 3, 'EUR', 'default');", []any{orderID, id}},
+		{"insert into order_items (id, order_id, product_id, quantity, tenant_id) select gen_random_uuid(), $1, $2, 1, 'default' from generate_series(1, 3);", []any{orderID, productID}},
+	} {
+		if _, err := db.GetDB().ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := postgres.Change{TenantID: "default", ID: orderID.String()}
+	for range 2 {
+		select {
+		case n := <-orders:
+			if change(n) != want {
+				t.Errorf("Expected %+v, got %+v", want, n)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("No order notification received")
+		}
+	}
+	select {
+	case n := <-orders:
+		t.Errorf("Expected a single notification for the items, got another %+v", n)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	cancel()
+	for range changes {
+	}
+	for range orders {
+	}
+}
@@ -32,10 +32,13 @@ func NewPostgres(config Config) (*Db, error) {
 	return pg, nil
 }
 
-func (p *Db) connect() error {
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+func (p *Db) connString() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		p.config.Host, p.config.Port, p.config.User, p.config.Password, p.config.DBName)
-	db, err := sqlx.Connect("postgres", connStr)
+}
+
+func (p *Db) connect() error {
+	db, err := sqlx.Connect("postgres", p.connString())
 	if err != nil {
 		return err
 	}
@@ -63,17 +66,17 @@ func (p *Db) Close() error {
 	return p.db.Close()
 }
 
-// QueryList is a generic function that retrieves a list of T from the database using the provided query and args.
-func QueryList[T any](ctx context.Context, db *sqlx.DB, query string, args ...any) ([]T, error) {
+// QueryList is a generic function that retrieves a list of T from the database or a transaction using the provided query and args.
+func QueryList[T any](ctx context.Context, db sqlx.QueryerContext, query string, args ...any) ([]T, error) {
 	var results []T
-	err := db.SelectContext(ctx, &results, query, args...)
+	err := sqlx.SelectContext(ctx, db, &results, query, args...)
 	return results, err
 }
 
-// QueryOne is a generic function that retrieves a single T from the database using the provided query and args.
-func QueryOne[T any](ctx context.Context, db *sqlx.DB, query string, args ...any) (*T, error) {
+// QueryOne is a generic function that retrieves a single T from the database or a transaction using the provided query and args.
+func QueryOne[T any](ctx context.Context, db sqlx.QueryerContext, query string, args ...any) (*T, error) {
 	var result T
-	err := db.GetContext(ctx, &result, query, args...)
+	err := sqlx.GetContext(ctx, db, &result, query, args...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNoRows
@@ -84,6 +87,6 @@ func QueryOne[T any](ctx context.Context, db *sqlx.DB, query string, args ...any
 }
 
 // ExecQuery is a generic function that executes a query with the provided args.
-func ExecQuery(ctx context.Context, db *sqlx.DB, query string, args ...any) (sql.Result, error) {
+func ExecQuery(ctx context.Context, db sqlx.ExecerContext, query string, args ...any) (sql.Result, error) {
 	return db.ExecContext(ctx, query, args...)
 }
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TenantRole is the role tenant transactions run as. Row-level security restricts it to the rows
+// of the transaction's tenant; the owner of the tables, which the application connects as,
+// bypasses it, e.g. for migrations and background workers.
+const TenantRole = "app_tenant"
+
+// ErrNoTenant is returned for tenant transactions without tenant in the context.
+var ErrNoTenant = errors.New("no tenant")
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx whose tenant transactions are scoped to tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set with WithTenant, if any.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant, tenant != ""
+}
+
+// BeginTenantTx begins a transaction scoped to the tenant of ctx. It runs as TenantRole with
+// app.tenant_id set to the tenant (SET LOCAL), so row-level security hides the rows of other
+// tenants, current_tenant() returns the tenant and inserted rows get its tenant_id.
+func (p *Db) BeginTenantTx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	tx, err := p.db.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, "set local role "+TenantRole); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	// set_config with is_local is SET LOCAL with a bind parameter
+	if _, err := tx.ExecContext(ctx, "select set_config('app.tenant_id', $1, true)", tenant); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// InTenant runs fn in a tenant transaction, see BeginTenantTx, and commits it if fn succeeds.
+func (p *Db) InTenant(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := p.BeginTenantTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// InTenantResult is InTenant for functions returning a result.
+func InTenantResult[T any](ctx context.Context, db *Db, fn func(tx *sqlx.Tx) (T, error)) (T, error) {
+	var result T
+	err := db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = fn(tx)
+		return err
+	})
+	return result, err
+}
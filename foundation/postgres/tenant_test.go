@@ -0,0 +1,103 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	test "github.com/romanWienicke/go-app-test/foundation/testing"
+)
+
+func TestPostgresTenantIsolation(t *testing.T) {
+	test.SetEnv(t, "../../.env")
+	dc := test.DockerComposeUp(t, "../../docker-compose.yaml", "postgres")
+	test.SetupDatabaseEnv(t, dc["postgres"])
+	db := test.InitPostgres(t, "../../migrations")
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Failed to close db: %v", err)
+		}
+	}()
+
+	t.Cleanup(func() {
+		t.Helper()
+		test.DockerComposeDown(t, "../../docker-compose.yaml")
+	})
+	ctx := context.Background()
+	if _, err := db.GetDB().ExecContext(ctx, "insert into tenants (id, name) values ('a', 'A'), ('b', 'B');"); err != nil {
+		t.Fatal(err)
+	}
+	a := postgres.WithTenant(ctx, "a")
+	b := postgres.WithTenant(ctx, "b")
+
+	if _, err := db.BeginTenantTx(ctx, nil); !errors.Is(err, postgres.ErrNoTenant) {
+		t.Errorf("Expected ErrNoTenant without tenant, got %v", err)
+	}
+
+	// the tenant_id of inserted rows defaults to the tenant of the transaction
+	customerID := uuid.New()
+	err := db.InTenant(a, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(a, "insert into customers (id, name, email) values ($1, 'Alice', 'alice@example.com');", customerID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert customer: %v", err)
+	}
+	tenant, err := postgres.QueryOne[string](ctx, db.GetDB(), "select tenant_id from customers where id=$1", customerID)
+	if err != nil || *tenant != "a" {
+		t.Fatalf("Expected the customer in tenant a, got %v, %v", tenant, err)
+	}
+
+	count := func(ctx context.Context) int {
+		t.Helper()
+		n, err := postgres.InTenantResult(ctx, db, func(tx *sqlx.Tx) (int, error) {
+			// no tenant predicate: row-level security alone has to hide the rows of other tenants
+			var n int
+			err := tx.GetContext(ctx, &n, "select count(*) from customers where id=$1", customerID)
+			return n, err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(a); n != 1 {
+		t.Errorf("Expected tenant a to see its customer, got %d rows", n)
+	}
+	if n := count(b); n != 0 {
+		t.Errorf("Expected tenant b not to see the customer of tenant a, got %d rows", n)
+	}
+
+	err = db.InTenant(b, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(b, "update customers set name='Mallory' where id=$1;", customerID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n != 0 {
+			t.Errorf("Expected tenant b not to update the customer of tenant a, updated %d rows", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rows of other tenants can neither be inserted nor referenced
+	err = db.InTenant(b, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(b, "insert into customers (id, name, email, tenant_id) values ($1, 'Eve', 'eve@example.com', 'a');", uuid.New())
+		return err
+	})
+	if err == nil {
+		t.Error("Expected tenant b not to insert customers of tenant a")
+	}
+	err = db.InTenant(b, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(b, "insert into orders (id, customer_id, status, total) values ($1, $2, 'pending', 1);", uuid.New(), customerID)
+		return err
+	})
+	if err == nil {
+		t.Error("Expected tenant b not to order for the customer of tenant a")
+	}
+}
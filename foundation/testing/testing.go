@@ -3,9 +3,12 @@ package testing
 import (
 	"os"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
 	"github.com/romanWienicke/go-app-test/docker"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
 	"github.com/romanWienicke/go-app-test/foundation/postgres"
 )
 
@@ -61,3 +64,31 @@ func InitPostgres(t *testing.T, migrationFile string) *postgres.Db {
 
 	return db
 }
+
+// MintToken returns an HS256 bearer token for the subject with the given roles, signed with
+// JWT_SECRET and valid for one hour.
+func MintToken(t *testing.T, subject string, roles ...string) string {
+	t.Helper()
+
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		t.Fatalf("JWT_SECRET is not set")
+	}
+
+	now := time.Now()
+	claims := auth.Claims{Roles: roles, RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   subject,
+		Issuer:    os.Getenv("JWT_ISSUER"),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+	}}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+
+	token, err := auth.NewHS256Signer(secret).Sign(claims)
+	if err != nil {
+		t.Fatalf("Failed to mint token: %v", err)
+	}
+	return token
+}
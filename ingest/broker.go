@@ -0,0 +1,107 @@
+// Package ingest consumes orders our partners put on a message broker. The broker is hidden
+// behind Reader and Writer, implemented for Kafka and by FakeBroker for tests.
+package ingest
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Message is a message read from or written to a topic.
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+}
+
+// Reader reads the messages of a consumer group.
+type Reader interface {
+	// Fetch blocks until the next message arrives or ctx is done.
+	Fetch(ctx context.Context) (Message, error)
+	// Commit marks the message and the ones before it in its partition as consumed.
+	Commit(ctx context.Context, msg Message) error
+	// Close leaves the consumer group, so its partitions are handed to the other members.
+	Close() error
+}
+
+// Writer writes messages to a topic.
+type Writer interface {
+	Write(ctx context.Context, msgs ...Message) error
+	Close() error
+}
+
+// FakeBroker is an in-memory Reader and Writer for tests. Produced messages are fetched in order,
+// committed and written messages are recorded.
+type FakeBroker struct {
+	messages chan Message
+
+	mu        sync.Mutex
+	offsets   map[string]int64
+	committed []Message
+	written   []Message
+	// WriteErr, if set, fails every write.
+	WriteErr error
+}
+
+func NewFakeBroker() *FakeBroker {
+	return &FakeBroker{messages: make(chan Message, 1024), offsets: map[string]int64{}}
+}
+
+// Produce queues messages for Fetch and assigns their offsets.
+func (b *FakeBroker) Produce(msgs ...Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, msg := range msgs {
+		msg.Offset = b.offsets[msg.Topic]
+		b.offsets[msg.Topic]++
+		b.messages <- msg
+	}
+}
+
+func (b *FakeBroker) Fetch(ctx context.Context) (Message, error) {
+	select {
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case msg := <-b.messages:
+		return msg, nil
+	}
+}
+
+func (b *FakeBroker) Commit(ctx context.Context, msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.committed = append(b.committed, msg)
+	return nil
+}
+
+func (b *FakeBroker) Write(ctx context.Context, msgs ...Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.WriteErr != nil {
+		return b.WriteErr
+	}
+	b.written = append(b.written, msgs...)
+	return nil
+}
+
+func (b *FakeBroker) Close() error {
+	return nil
+}
+
+// Committed returns the committed messages in commit order.
+func (b *FakeBroker) Committed() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.committed)
+}
+
+// Written returns the written messages in write order.
+func (b *FakeBroker) Written() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.written)
+}
@@ -0,0 +1,90 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaReader reads a topic in a consumer group and commits offsets synchronously.
+type KafkaReader struct {
+	reader *kafka.Reader
+}
+
+func NewKafkaReader(brokers []string, topic, groupID string) (*KafkaReader, error) {
+	if len(brokers) == 0 || topic == "" || groupID == "" {
+		return nil, errors.New("kafka: brokers, topic and consumer group are required")
+	}
+	return &KafkaReader{reader: kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		GroupID:     groupID,
+		StartOffset: kafka.FirstOffset,
+		// commit when asked, not in the background
+		CommitInterval: 0,
+	})}, nil
+}
+
+func (r *KafkaReader) Fetch(ctx context.Context) (Message, error) {
+	msg, err := r.reader.FetchMessage(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	return Message{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   headers,
+	}, nil
+}
+
+func (r *KafkaReader) Commit(ctx context.Context, msg Message) error {
+	return r.reader.CommitMessages(ctx, kafka.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset})
+}
+
+func (r *KafkaReader) Close() error {
+	return r.reader.Close()
+}
+
+// KafkaWriter writes to a topic, keyed messages keep their order.
+type KafkaWriter struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaWriter(brokers []string, topic string) (*KafkaWriter, error) {
+	if len(brokers) == 0 || topic == "" {
+		return nil, errors.New("kafka: brokers and topic are required")
+	}
+	return &KafkaWriter{writer: &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+		BatchTimeout:           10 * time.Millisecond,
+	}}, nil
+}
+
+func (w *KafkaWriter) Write(ctx context.Context, msgs ...Message) error {
+	messages := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		headers := make([]kafka.Header, 0, len(msg.Headers))
+		for k, v := range msg.Headers {
+			headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+		messages[i] = kafka.Message{Key: msg.Key, Value: msg.Value, Headers: headers}
+	}
+	return w.writer.WriteMessages(ctx, messages...)
+}
+
+func (w *KafkaWriter) Close() error {
+	return w.writer.Close()
+}
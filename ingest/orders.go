@@ -0,0 +1,236 @@
+package ingest
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/romanWienicke/go-app-test/foundation/money"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/service/order"
+	"github.com/rs/zerolog"
+)
+
+// HeaderTenant names the tenant a message's order belongs to, one of Config.Tenants.
+const HeaderTenant = "tenant-id"
+
+// ErrTenantNotAllowed is returned for messages naming a tenant the topic may not write to.
+var ErrTenantNotAllowed = errors.New("tenant not allowed")
+
+// Headers added to dead letters.
+const (
+	HeaderError             = "x-error"
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderFailedAt          = "x-failed-at"
+)
+
+// maxKeyLength is the length of order_idempotency_keys.key.
+const maxKeyLength = 255
+
+// OrderCreator creates orders once per key, like order.OrderService.
+type OrderCreator interface {
+	CreateOrderOnce(ctx context.Context, key string, o order.Order) (uuid.UUID, bool, error)
+}
+
+// Config configures the order consumer.
+type Config struct {
+	// RetryWait is the wait before retrying a transient failure, doubled for every further retry
+	// up to MaxRetryWait. 500ms and 30s by default.
+	RetryWait    time.Duration
+	MaxRetryWait time.Duration
+	// ProcessTimeout bounds the handling of a message, 30s by default.
+	ProcessTimeout time.Duration
+	// Tenant is the tenant of messages without tenant header; such messages are dead-lettered
+	// when it is empty.
+	Tenant string
+	// Tenants are the tenants messages may name with the tenant header besides Tenant. Anyone
+	// writing to the topic could name any tenant otherwise, so messages naming another tenant
+	// are dead-lettered.
+	Tenants []string
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.RetryWait <= 0 {
+		cfg.RetryWait = 500 * time.Millisecond
+	}
+	if cfg.MaxRetryWait <= 0 {
+		cfg.MaxRetryWait = 30 * time.Second
+	}
+	if cfg.ProcessTimeout <= 0 {
+		cfg.ProcessTimeout = 30 * time.Second
+	}
+	return cfg
+}
+
+// OrderConsumer creates an order for every message of the partner topic. A message is committed
+// once its order exists, so it is processed at least once; its key makes the creation idempotent.
+// Poison messages, which fail the same way however often they are retried, go to the dead-letter
+// topic; other failures are retried until they succeed.
+type OrderConsumer struct {
+	reader      Reader
+	deadLetters Writer
+	orders      OrderCreator
+	log         *zerolog.Logger
+	cfg         Config
+}
+
+func NewOrderConsumer(reader Reader, deadLetters Writer, orders OrderCreator, log *zerolog.Logger, cfg Config) *OrderConsumer {
+	return &OrderConsumer{reader: reader, deadLetters: deadLetters, orders: orders, log: log, cfg: cfg.withDefaults()}
+}
+
+// Run consumes messages until ctx is done or the broker fails. A message being processed when ctx
+// is done is finished and committed, so closing the reader afterwards hands the partitions over
+// without redelivering it; a message still waiting for a retry is redelivered.
+func (c *OrderConsumer) Run(ctx context.Context) error {
+	for {
+		msg, err := c.reader.Fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := c.handle(ctx, msg); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// handle processes a message until it succeeds or is dead-lettered, then commits it. It gives up
+// without commit when ctx is done while waiting for a retry.
+func (c *OrderConsumer) handle(ctx context.Context, msg Message) error {
+	for attempt := 0; ; attempt++ {
+		err := c.process(ctx, msg)
+		if err != nil && poison(err) {
+			err = c.deadLetter(ctx, msg, err)
+		}
+		if err == nil {
+			return c.commit(ctx, msg)
+		}
+
+		wait := c.cfg.RetryWait << attempt
+		if wait <= 0 || wait > c.cfg.MaxRetryWait {
+			wait = c.cfg.MaxRetryWait
+		}
+		c.log.Warn().Err(err).Str("topic", msg.Topic).Int("partition", msg.Partition).Int64("offset", msg.Offset).
+			Int("attempt", attempt+1).Dur("retry_in", wait).Msg("Failed to ingest order, retrying")
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// process creates the order of a message. It runs to the end even when ctx is done, bounded by
+// the process timeout.
+func (c *OrderConsumer) process(ctx context.Context, msg Message) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.cfg.ProcessTimeout)
+	defer cancel()
+
+	var o order.Order
+	if err := json.Unmarshal(msg.Value, &o); err != nil {
+		return poisonError{fmt.Errorf("decode order: %w", err)}
+	}
+	key := messageKey(msg)
+	if len(key) > maxKeyLength {
+		return poisonError{fmt.Errorf("message key longer than %d bytes", maxKeyLength)}
+	}
+	// an unknown tenant fails the foreign key of the order, which is poison as well
+	tenant := cmp.Or(msg.Headers[HeaderTenant], c.cfg.Tenant)
+	if tenant == "" {
+		return poisonError{postgres.ErrNoTenant}
+	}
+	if tenant != c.cfg.Tenant && !slices.Contains(c.cfg.Tenants, tenant) {
+		return poisonError{fmt.Errorf("%w: %q", ErrTenantNotAllowed, tenant)}
+	}
+	ctx = postgres.WithTenant(ctx, tenant)
+
+	id, created, err := c.orders.CreateOrderOnce(ctx, key, o)
+	if err != nil {
+		return err
+	}
+	if created {
+		c.log.Info().Str("order_id", id.String()).Str("tenant", tenant).Str("key", key).Msg("Ingested order")
+	} else {
+		c.log.Info().Str("order_id", id.String()).Str("tenant", tenant).Str("key", key).Msg("Skipped duplicate order")
+	}
+	return nil
+}
+
+// messageKey is the idempotency key of a message: its key, or its position for keyless messages,
+// prefixed with the topic.
+func messageKey(msg Message) string {
+	if len(msg.Key) == 0 {
+		return fmt.Sprintf("%s:%d:%d", msg.Topic, msg.Partition, msg.Offset)
+	}
+	return msg.Topic + ":" + string(msg.Key)
+}
+
+func (c *OrderConsumer) deadLetter(ctx context.Context, msg Message, cause error) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.cfg.ProcessTimeout)
+	defer cancel()
+
+	headers := make(map[string]string, len(msg.Headers)+5)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderError] = cause.Error()
+	headers[HeaderOriginalTopic] = msg.Topic
+	headers[HeaderOriginalPartition] = strconv.Itoa(msg.Partition)
+	headers[HeaderOriginalOffset] = strconv.FormatInt(msg.Offset, 10)
+	headers[HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	if err := c.deadLetters.Write(ctx, Message{Key: msg.Key, Value: msg.Value, Headers: headers}); err != nil {
+		return fmt.Errorf("write dead letter: %w", err)
+	}
+	c.log.Error().Err(cause).Str("topic", msg.Topic).Int("partition", msg.Partition).Int64("offset", msg.Offset).
+		Msg("Moved poison order message to the dead-letter topic")
+	return nil
+}
+
+func (c *OrderConsumer) commit(ctx context.Context, msg Message) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.cfg.ProcessTimeout)
+	defer cancel()
+	return c.reader.Commit(ctx, msg)
+}
+
+// poisonError marks a message that can never be processed.
+type poisonError struct {
+	err error
+}
+
+func (e poisonError) Error() string { return e.err.Error() }
+func (e poisonError) Unwrap() error { return e.err }
+
+// poison reports whether err fails a message for good: it can't be decoded, the order is invalid
+// or the database rejects its data, e.g. for an unknown customer.
+func poison(err error) bool {
+	var pe poisonError
+	var validationErrors validator.ValidationErrors
+	var pqErr *pq.Error
+	switch {
+	case errors.As(err, &pe), errors.As(err, &validationErrors), money.IsInvalid(err):
+		return true
+	case errors.As(err, &pqErr):
+		// data exceptions and integrity constraint violations
+		class := pqErr.Code.Class()
+		return class == "22" || class == "23"
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/service/order"
+	"github.com/rs/zerolog"
+)
+
+// fakeOrders creates orders once per key and fails the first failures calls.
+type fakeOrders struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	orders   map[string]uuid.UUID
+	err      error
+	tenants  []string
+}
+
+func (f *fakeOrders) CreateOrderOnce(ctx context.Context, key string, _ order.Order) (uuid.UUID, bool, error) {
+	tenant, _ := postgres.TenantFromContext(ctx)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return uuid.Nil, false, errors.New("connection refused")
+	}
+	if f.err != nil {
+		return uuid.Nil, false, f.err
+	}
+	if id, ok := f.orders[key]; ok {
+		return id, false, nil
+	}
+	id := uuid.New()
+	f.orders[key] = id
+	f.tenants = append(f.tenants, tenant)
+	return id, true, nil
+}
+
+func (f *fakeOrders) created() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.orders)
+}
+
+// consume runs a consumer with the given default and allowed tenants until all produced messages
+// are committed.
+func consume(t *testing.T, broker *FakeBroker, orders *fakeOrders, tenant string, want int, tenants ...string) {
+	t.Helper()
+	log := zerolog.Nop()
+	c := NewOrderConsumer(broker, broker, orders, &log, Config{RetryWait: time.Millisecond, MaxRetryWait: 5 * time.Millisecond,
+		Tenant: tenant, Tenants: tenants})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(broker.Committed()) < want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Consumer failed: %v", err)
+	}
+	if got := len(broker.Committed()); got != want {
+		t.Fatalf("Expected %d committed messages, got %d", want, got)
+	}
+}
+
+func orderMessage(t *testing.T, key string) Message {
+	t.Helper()
+	value, err := json.Marshal(order.Order{CustomerID: uuid.New(), Status: "pending"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Message{Topic: "partner-orders", Key: []byte(key), Value: value}
+}
+
+func TestConsumeOrders(t *testing.T) {
+	broker := NewFakeBroker()
+	orders := &fakeOrders{orders: map[string]uuid.UUID{}, failures: 2}
+	// a redelivered message creates no second order
+	broker.Produce(orderMessage(t, "a"), orderMessage(t, "b"), orderMessage(t, "a"))
+
+	consume(t, broker, orders, "default", 3)
+	if n := orders.created(); n != 2 {
+		t.Errorf("Expected 2 orders, got %d", n)
+	}
+	if written := broker.Written(); len(written) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(written))
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	broker := NewFakeBroker()
+	orders := &fakeOrders{orders: map[string]uuid.UUID{}}
+	broker.Produce(Message{Topic: "partner-orders", Key: []byte("bad"), Value: []byte("{not json"), Headers: map[string]string{"source": "acme"}})
+	broker.Produce(orderMessage(t, "good"))
+
+	consume(t, broker, orders, "default", 2)
+	written := broker.Written()
+	if len(written) != 1 {
+		t.Fatalf("Expected 1 dead letter, got %d", len(written))
+	}
+	dl := written[0]
+	if string(dl.Key) != "bad" || string(dl.Value) != "{not json" {
+		t.Errorf("Expected the original message, got %s: %s", dl.Key, dl.Value)
+	}
+	if dl.Headers[HeaderError] == "" || dl.Headers[HeaderOriginalTopic] != "partner-orders" ||
+		dl.Headers[HeaderOriginalOffset] != "0" || dl.Headers["source"] != "acme" {
+		t.Errorf("Unexpected dead letter headers %v", dl.Headers)
+	}
+	if n := orders.created(); n != 1 {
+		t.Errorf("Expected 1 order, got %d", n)
+	}
+}
+
+func TestRejectedOrderIsDeadLettered(t *testing.T) {
+	broker := NewFakeBroker()
+	orders := &fakeOrders{orders: map[string]uuid.UUID{}, err: &pq.Error{Code: "23503", Message: "violates foreign key constraint"}}
+	broker.Produce(orderMessage(t, "unknown-customer"))
+
+	consume(t, broker, orders, "default", 1)
+	if written := broker.Written(); len(written) != 1 {
+		t.Errorf("Expected 1 dead letter, got %d", len(written))
+	}
+}
+
+func TestNoCommitWhileDeadLetterTopicIsDown(t *testing.T) {
+	broker := NewFakeBroker()
+	broker.WriteErr = errors.New("broker down")
+	orders := &fakeOrders{orders: map[string]uuid.UUID{}}
+	broker.Produce(Message{Topic: "partner-orders", Value: []byte("{not json")})
+
+	consume(t, broker, orders, "default", 0)
+}
+
+func TestMessageTenant(t *testing.T) {
+	broker := NewFakeBroker()
+	orders := &fakeOrders{orders: map[string]uuid.UUID{}}
+	acme := orderMessage(t, "a")
+	acme.Headers = map[string]string{HeaderTenant: "acme"}
+	other := orderMessage(t, "c")
+	other.Headers = map[string]string{HeaderTenant: "other"}
+	broker.Produce(acme, orderMessage(t, "b"), other)
+
+	consume(t, broker, orders, "default", 3, "acme")
+	if len(orders.tenants) != 2 || orders.tenants[0] != "acme" || orders.tenants[1] != "default" {
+		t.Errorf("Expected orders of acme and default, got %v", orders.tenants)
+	}
+	if written := broker.Written(); len(written) != 1 || written[0].Headers[HeaderTenant] != "other" {
+		t.Errorf("Expected the order of a tenant not allowed to be dead-lettered, got %v", written)
+	}
+}
+
+func TestMissingTenantIsDeadLettered(t *testing.T) {
+	broker := NewFakeBroker()
+	orders := &fakeOrders{orders: map[string]uuid.UUID{}}
+	broker.Produce(orderMessage(t, "a"))
+
+	consume(t, broker, orders, "", 1)
+	if written := broker.Written(); len(written) != 1 {
+		t.Errorf("Expected 1 dead letter, got %d", len(written))
+	}
+	if n := orders.created(); n != 0 {
+		t.Errorf("Expected no orders, got %d", n)
+	}
+}
+
+func TestMessageKey(t *testing.T) {
+	if key := messageKey(Message{Topic: "t", Key: []byte("k")}); key != "t:k" {
+		t.Errorf("Expected t:k, got %s", key)
+	}
+	if key := messageKey(Message{Topic: "t", Partition: 2, Offset: 7}); key != "t:2:7" {
+		t.Errorf("Expected t:2:7, got %s", key)
+	}
+}
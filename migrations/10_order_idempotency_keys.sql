@@ -0,0 +1,10 @@
+-- +goose Up
+-- keys of created orders, e.g. the message keys of ingested partner orders; they outlive the order
+CREATE TABLE order_idempotency_keys (
+    key VARCHAR(255) PRIMARY KEY,
+    order_id uuid NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS order_idempotency_keys;
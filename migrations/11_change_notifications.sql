@@ -0,0 +1,33 @@
+-- +goose Up
+-- notify_change(channel [, column]) sends the changed row's column, id by default, on channel
+-- +goose StatementBegin
+CREATE FUNCTION notify_change() RETURNS trigger AS $$
+DECLARE
+    row_data jsonb;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row_data := to_jsonb(OLD);
+    ELSE
+        row_data := to_jsonb(NEW);
+    END IF;
+    PERFORM pg_notify(TG_ARGV[0], row_data->>coalesce(TG_ARGV[1], 'id'));
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER customers_notify_change AFTER INSERT OR UPDATE OR DELETE ON customers
+    FOR EACH ROW EXECUTE FUNCTION notify_change('customers_changed');
+CREATE TRIGGER products_notify_change AFTER INSERT OR UPDATE OR DELETE ON products
+    FOR EACH ROW EXECUTE FUNCTION notify_change('products_changed');
+CREATE TRIGGER orders_notify_change AFTER INSERT OR UPDATE OR DELETE ON orders
+    FOR EACH ROW EXECUTE FUNCTION notify_change('orders_changed');
+CREATE TRIGGER order_items_notify_change AFTER INSERT OR UPDATE OR DELETE ON order_items
+    FOR EACH ROW EXECUTE FUNCTION notify_change('orders_changed', 'order_id');
+
+-- +goose Down
+DROP TRIGGER IF EXISTS order_items_notify_change ON order_items;
+DROP TRIGGER IF EXISTS orders_notify_change ON orders;
+DROP TRIGGER IF EXISTS products_notify_change ON products;
+DROP TRIGGER IF EXISTS customers_notify_change ON customers;
+DROP FUNCTION IF EXISTS notify_change();
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- names weigh more than descriptions in the ranking
+ALTER TABLE products ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B')
+) STORED;
+
+CREATE INDEX products_search_idx ON products USING GIN (search_vector);
+-- typo tolerant matching of names
+CREATE INDEX products_name_trgm_idx ON products USING GIN (name gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS products_name_trgm_idx;
+DROP INDEX IF EXISTS products_search_idx;
+ALTER TABLE products DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,181 @@
+-- +goose Up
+CREATE TABLE tenants (
+    id VARCHAR(63) PRIMARY KEY CHECK (id ~ '^[a-z0-9]([a-z0-9-]*[a-z0-9])?$'),
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- the data of the single tenant deployments so far
+INSERT INTO tenants (id, name) VALUES ('default', 'Default');
+
+-- current_tenant is the tenant of the transaction, set with SET LOCAL app.tenant_id; NULL without
+-- one, so nothing matches and inserts fail
+-- +goose StatementBegin
+CREATE FUNCTION current_tenant() RETURNS VARCHAR AS $$
+    SELECT nullif(current_setting('app.tenant_id', true), '')
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- existing rows belong to the default tenant, new rows to the tenant of the transaction
+ALTER TABLE customers ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+ALTER TABLE products ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+ALTER TABLE orders ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+ALTER TABLE order_items ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+ALTER TABLE order_events ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+ALTER TABLE order_idempotency_keys ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+ALTER TABLE users ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+ALTER TABLE webhooks ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+ALTER TABLE customers ALTER COLUMN tenant_id SET DEFAULT current_tenant();
+ALTER TABLE products ALTER COLUMN tenant_id SET DEFAULT current_tenant();
+ALTER TABLE orders ALTER COLUMN tenant_id SET DEFAULT current_tenant();
+ALTER TABLE order_items ALTER COLUMN tenant_id SET DEFAULT current_tenant();
+ALTER TABLE order_events ALTER COLUMN tenant_id SET DEFAULT current_tenant();
+ALTER TABLE order_idempotency_keys ALTER COLUMN tenant_id SET DEFAULT current_tenant();
+ALTER TABLE users ALTER COLUMN tenant_id SET DEFAULT current_tenant();
+ALTER TABLE api_keys ALTER COLUMN tenant_id SET DEFAULT current_tenant();
+ALTER TABLE webhooks ALTER COLUMN tenant_id SET DEFAULT current_tenant();
+
+-- unique per tenant
+ALTER TABLE customers DROP CONSTRAINT customers_email_key;
+ALTER TABLE customers ADD CONSTRAINT customers_tenant_email_key UNIQUE (tenant_id, email);
+DROP INDEX users_email_key;
+CREATE UNIQUE INDEX users_tenant_email_key ON users (tenant_id, lower(email));
+ALTER TABLE order_idempotency_keys DROP CONSTRAINT order_idempotency_keys_pkey;
+ALTER TABLE order_idempotency_keys ADD PRIMARY KEY (tenant_id, key);
+
+-- references stay within a tenant, even where row-level security doesn't apply to foreign keys
+ALTER TABLE customers ADD CONSTRAINT customers_id_tenant_key UNIQUE (id, tenant_id);
+ALTER TABLE products ADD CONSTRAINT products_id_tenant_key UNIQUE (id, tenant_id);
+ALTER TABLE orders ADD CONSTRAINT orders_id_tenant_key UNIQUE (id, tenant_id);
+ALTER TABLE orders DROP CONSTRAINT orders_customer_id_fkey;
+ALTER TABLE orders ADD CONSTRAINT orders_customer_id_fkey
+    FOREIGN KEY (customer_id, tenant_id) REFERENCES customers(id, tenant_id) ON DELETE CASCADE;
+ALTER TABLE order_items DROP CONSTRAINT order_items_order_id_fkey;
+ALTER TABLE order_items ADD CONSTRAINT order_items_order_id_fkey
+    FOREIGN KEY (order_id, tenant_id) REFERENCES orders(id, tenant_id) ON DELETE CASCADE;
+ALTER TABLE order_items DROP CONSTRAINT order_items_product_id_fkey;
+ALTER TABLE order_items ADD CONSTRAINT order_items_product_id_fkey
+    FOREIGN KEY (product_id, tenant_id) REFERENCES products(id, tenant_id);
+
+CREATE INDEX products_tenant_idx ON products (tenant_id);
+CREATE INDEX orders_tenant_order_date_idx ON orders (tenant_id, order_date, id);
+CREATE INDEX order_events_tenant_idx ON order_events (tenant_id, id);
+
+-- app_tenant is the role of tenant transactions (SET LOCAL ROLE); unlike the owner of the tables,
+-- which migrations and background workers use, it is subject to row-level security
+-- +goose StatementBegin
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'app_tenant') THEN
+        CREATE ROLE app_tenant NOLOGIN;
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+GRANT app_tenant TO CURRENT_USER;
+GRANT USAGE ON SCHEMA public TO app_tenant;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO app_tenant;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO app_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO app_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO app_tenant;
+
+ALTER TABLE customers ENABLE ROW LEVEL SECURITY;
+ALTER TABLE products ENABLE ROW LEVEL SECURITY;
+ALTER TABLE orders ENABLE ROW LEVEL SECURITY;
+ALTER TABLE order_items ENABLE ROW LEVEL SECURITY;
+ALTER TABLE order_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE order_idempotency_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE user_roles ENABLE ROW LEVEL SECURITY;
+ALTER TABLE api_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhooks ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_attempts ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON customers USING (tenant_id = current_tenant());
+CREATE POLICY tenant_isolation ON products USING (tenant_id = current_tenant());
+CREATE POLICY tenant_isolation ON orders USING (tenant_id = current_tenant());
+CREATE POLICY tenant_isolation ON order_items USING (tenant_id = current_tenant());
+CREATE POLICY tenant_isolation ON order_events USING (tenant_id = current_tenant());
+CREATE POLICY tenant_isolation ON order_idempotency_keys USING (tenant_id = current_tenant());
+CREATE POLICY tenant_isolation ON users USING (tenant_id = current_tenant());
+CREATE POLICY tenant_isolation ON api_keys USING (tenant_id = current_tenant());
+CREATE POLICY tenant_isolation ON webhooks USING (tenant_id = current_tenant());
+-- rows without tenant_id belong to the tenant of their parent, which row-level security of the
+-- subquery restricts to the current tenant
+CREATE POLICY tenant_isolation ON user_roles
+    USING (EXISTS (SELECT 1 FROM users u WHERE u.id = user_id));
+CREATE POLICY tenant_isolation ON webhook_deliveries
+    USING (EXISTS (SELECT 1 FROM webhooks w WHERE w.id = webhook_id));
+CREATE POLICY tenant_isolation ON webhook_attempts
+    USING (EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.id = delivery_id));
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation ON webhook_attempts;
+DROP POLICY IF EXISTS tenant_isolation ON webhook_deliveries;
+DROP POLICY IF EXISTS tenant_isolation ON user_roles;
+DROP POLICY IF EXISTS tenant_isolation ON webhooks;
+DROP POLICY IF EXISTS tenant_isolation ON api_keys;
+DROP POLICY IF EXISTS tenant_isolation ON users;
+DROP POLICY IF EXISTS tenant_isolation ON order_idempotency_keys;
+DROP POLICY IF EXISTS tenant_isolation ON order_events;
+DROP POLICY IF EXISTS tenant_isolation ON order_items;
+DROP POLICY IF EXISTS tenant_isolation ON orders;
+DROP POLICY IF EXISTS tenant_isolation ON products;
+DROP POLICY IF EXISTS tenant_isolation ON customers;
+ALTER TABLE webhook_attempts DISABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries DISABLE ROW LEVEL SECURITY;
+ALTER TABLE webhooks DISABLE ROW LEVEL SECURITY;
+ALTER TABLE api_keys DISABLE ROW LEVEL SECURITY;
+ALTER TABLE user_roles DISABLE ROW LEVEL SECURITY;
+ALTER TABLE users DISABLE ROW LEVEL SECURITY;
+ALTER TABLE order_idempotency_keys DISABLE ROW LEVEL SECURITY;
+ALTER TABLE order_events DISABLE ROW LEVEL SECURITY;
+ALTER TABLE order_items DISABLE ROW LEVEL SECURITY;
+ALTER TABLE orders DISABLE ROW LEVEL SECURITY;
+ALTER TABLE products DISABLE ROW LEVEL SECURITY;
+ALTER TABLE customers DISABLE ROW LEVEL SECURITY;
+
+-- the role is shared by the databases of the cluster, only its privileges here are dropped
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE ALL ON SEQUENCES FROM app_tenant;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE ALL ON TABLES FROM app_tenant;
+REVOKE ALL ON ALL SEQUENCES IN SCHEMA public FROM app_tenant;
+REVOKE ALL ON ALL TABLES IN SCHEMA public FROM app_tenant;
+REVOKE USAGE ON SCHEMA public FROM app_tenant;
+
+DROP INDEX IF EXISTS order_events_tenant_idx;
+DROP INDEX IF EXISTS orders_tenant_order_date_idx;
+DROP INDEX IF EXISTS products_tenant_idx;
+
+ALTER TABLE order_items DROP CONSTRAINT order_items_product_id_fkey;
+ALTER TABLE order_items ADD CONSTRAINT order_items_product_id_fkey
+    FOREIGN KEY (product_id) REFERENCES products(id);
+ALTER TABLE order_items DROP CONSTRAINT order_items_order_id_fkey;
+ALTER TABLE order_items ADD CONSTRAINT order_items_order_id_fkey
+    FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE;
+ALTER TABLE orders DROP CONSTRAINT orders_customer_id_fkey;
+ALTER TABLE orders ADD CONSTRAINT orders_customer_id_fkey
+    FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE;
+ALTER TABLE orders DROP CONSTRAINT orders_id_tenant_key;
+ALTER TABLE products DROP CONSTRAINT products_id_tenant_key;
+ALTER TABLE customers DROP CONSTRAINT customers_id_tenant_key;
+
+ALTER TABLE order_idempotency_keys DROP CONSTRAINT order_idempotency_keys_pkey;
+ALTER TABLE order_idempotency_keys ADD PRIMARY KEY (key);
+DROP INDEX users_tenant_email_key;
+CREATE UNIQUE INDEX users_email_key ON users (lower(email));
+ALTER TABLE customers DROP CONSTRAINT customers_tenant_email_key;
+ALTER TABLE customers ADD CONSTRAINT customers_email_key UNIQUE (email);
+
+ALTER TABLE webhooks DROP COLUMN tenant_id;
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+ALTER TABLE users DROP COLUMN tenant_id;
+ALTER TABLE order_idempotency_keys DROP COLUMN tenant_id;
+ALTER TABLE order_events DROP COLUMN tenant_id;
+ALTER TABLE order_items DROP COLUMN tenant_id;
+ALTER TABLE orders DROP COLUMN tenant_id;
+ALTER TABLE products DROP COLUMN tenant_id;
+ALTER TABLE customers DROP COLUMN tenant_id;
+
+DROP FUNCTION IF EXISTS current_tenant();
+DROP TABLE IF EXISTS tenants;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- amounts stored so far are in the default currency, new rows always name theirs
+ALTER TABLE products ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'EUR' CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE orders ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'EUR' CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE products ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE orders ALTER COLUMN currency DROP DEFAULT;
+
+-- +goose Down
+ALTER TABLE orders DROP COLUMN currency;
+ALTER TABLE products DROP COLUMN currency;
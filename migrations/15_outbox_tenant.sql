@@ -0,0 +1,13 @@
+-- +goose Up
+-- events stored so far belong to the default tenant, new ones to the tenant of the transaction
+ALTER TABLE outbox ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES tenants(id);
+ALTER TABLE outbox ALTER COLUMN tenant_id SET DEFAULT current_tenant();
+
+-- tenant transactions only store events, the relay runs as owner
+ALTER TABLE outbox ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON outbox USING (tenant_id = current_tenant());
+
+-- +goose Down
+DROP POLICY IF EXISTS tenant_isolation ON outbox;
+ALTER TABLE outbox DISABLE ROW LEVEL SECURITY;
+ALTER TABLE outbox DROP COLUMN tenant_id;
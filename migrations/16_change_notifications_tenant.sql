@@ -0,0 +1,74 @@
+-- +goose Up
+-- the channels are shared by all tenants, so the payload names the tenant of the changed row:
+-- {"tenant_id":"default","id":"..."}; listeners filter by it
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_change() RETURNS trigger AS $$
+DECLARE
+    row_data jsonb;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row_data := to_jsonb(OLD);
+    ELSE
+        row_data := to_jsonb(NEW);
+    END IF;
+    PERFORM pg_notify(TG_ARGV[0], json_build_object(
+        'tenant_id', row_data->>'tenant_id',
+        'id', row_data->>coalesce(TG_ARGV[1], 'id'))::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- notify_changes(channel, column) is the statement level variant reading the transition table
+-- changed_rows, it notifies every distinct value of column once, e.g. once per order of a bulk
+-- import of order items
+-- +goose StatementBegin
+CREATE FUNCTION notify_changes() RETURNS trigger AS $$
+DECLARE
+    changed record;
+BEGIN
+    FOR changed IN
+        SELECT DISTINCT row_data->>'tenant_id' AS tenant_id, row_data->>TG_ARGV[1] AS id
+        FROM (SELECT to_jsonb(r) AS row_data FROM changed_rows r) rows
+    LOOP
+        PERFORM pg_notify(TG_ARGV[0], json_build_object('tenant_id', changed.tenant_id, 'id', changed.id)::text);
+    END LOOP;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- transition tables allow a single event per trigger
+DROP TRIGGER order_items_notify_change ON order_items;
+CREATE TRIGGER order_items_notify_insert AFTER INSERT ON order_items
+    REFERENCING NEW TABLE AS changed_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_changes('orders_changed', 'order_id');
+CREATE TRIGGER order_items_notify_update AFTER UPDATE ON order_items
+    REFERENCING NEW TABLE AS changed_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_changes('orders_changed', 'order_id');
+CREATE TRIGGER order_items_notify_delete AFTER DELETE ON order_items
+    REFERENCING OLD TABLE AS changed_rows
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_changes('orders_changed', 'order_id');
+
+-- +goose Down
+DROP TRIGGER IF EXISTS order_items_notify_delete ON order_items;
+DROP TRIGGER IF EXISTS order_items_notify_update ON order_items;
+DROP TRIGGER IF EXISTS order_items_notify_insert ON order_items;
+DROP FUNCTION IF EXISTS notify_changes();
+CREATE TRIGGER order_items_notify_change AFTER INSERT OR UPDATE OR DELETE ON order_items
+    FOR EACH ROW EXECUTE FUNCTION notify_change('orders_changed', 'order_id');
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_change() RETURNS trigger AS $$
+DECLARE
+    row_data jsonb;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row_data := to_jsonb(OLD);
+    ELSE
+        row_data := to_jsonb(NEW);
+    END IF;
+    PERFORM pg_notify(TG_ARGV[0], row_data->>coalesce(TG_ARGV[1], 'id'));
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
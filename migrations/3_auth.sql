@@ -0,0 +1,29 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN password_hash TEXT,
+    ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until TIMESTAMP WITH TIME ZONE;
+
+CREATE UNIQUE INDEX users_email_key ON users (lower(email));
+
+CREATE TABLE refresh_tokens (
+    id uuid PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    family_id uuid NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    replaced_by uuid
+);
+
+CREATE INDEX refresh_tokens_family_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_idx ON refresh_tokens (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS refresh_tokens;
+DROP INDEX IF EXISTS users_email_key;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS password_hash,
+    DROP COLUMN IF EXISTS failed_logins,
+    DROP COLUMN IF EXISTS locked_until;
@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE user_roles (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(50) NOT NULL CHECK (role IN ('admin', 'support', 'customer')),
+    PRIMARY KEY (user_id, role)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_roles;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE order_events (
+    id BIGSERIAL PRIMARY KEY,
+    order_id uuid NOT NULL,
+    customer_id uuid NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    previous_status VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX order_events_order_id_idx ON order_events (order_id, id);
+CREATE INDEX order_events_customer_id_idx ON order_events (customer_id, id);
+
+-- +goose Down
+DROP TABLE IF EXISTS order_events;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id uuid NOT NULL UNIQUE,
+    event_type VARCHAR(100) NOT NULL,
+    aggregate_id uuid NOT NULL,
+    envelope JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+-- the relay reads unsent rows in insert order, the cleanup finds old sent rows
+CREATE INDEX outbox_unsent_idx ON outbox (id) WHERE sent_at IS NULL;
+CREATE INDEX outbox_unsent_aggregate_idx ON outbox (aggregate_id, id) WHERE sent_at IS NULL;
+CREATE INDEX outbox_sent_at_idx ON outbox (sent_at) WHERE sent_at IS NOT NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS outbox;
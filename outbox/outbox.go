@@ -0,0 +1,251 @@
+// Package outbox publishes domain events reliably: services store events in the outbox table in
+// the transaction of the domain change, and a relay publishes the stored events afterwards. An
+// event is published at least once, even if the broker is down or the process crashes after the
+// commit.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/romanWienicke/go-app-test/events"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/rs/zerolog"
+)
+
+// metrics are published on the admin server's /debug/vars.
+var (
+	metrics = expvar.NewMap("outbox")
+	// pending is the number of unsent events, lagSeconds the age of the oldest one.
+	pending    = new(expvar.Int)
+	lagSeconds = new(expvar.Float)
+	published  = new(expvar.Int)
+	failures   = new(expvar.Int)
+	deleted    = new(expvar.Int)
+)
+
+func init() {
+	metrics.Set("pending", pending)
+	metrics.Set("lag_seconds", lagSeconds)
+	metrics.Set("published_total", published)
+	metrics.Set("failures_total", failures)
+	metrics.Set("deleted_total", deleted)
+}
+
+// Config configures the relay.
+type Config struct {
+	// PollInterval is how often unsent events are looked for, 1s by default.
+	PollInterval time.Duration
+	// BatchSize is the number of events published at once, 100 by default.
+	BatchSize int
+	// Retention is how long sent events are kept, 24h by default.
+	Retention time.Duration
+	// CleanupInterval is how often sent events past the retention are deleted, 10m by default.
+	CleanupInterval time.Duration
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 24 * time.Hour
+	}
+	if cfg.CleanupInterval <= 0 {
+		cfg.CleanupInterval = 10 * time.Minute
+	}
+	return cfg
+}
+
+type Outbox struct {
+	db  *postgres.Db
+	log *zerolog.Logger
+	cfg Config
+	// wake shortens the wait of the relay when events were stored
+	wake chan struct{}
+}
+
+func NewOutbox(db *postgres.Db, log *zerolog.Logger, cfg Config) *Outbox {
+	return &Outbox{db: db, log: log, cfg: cfg.withDefaults(), wake: make(chan struct{}, 1)}
+}
+
+// Add stores events in the transaction tx; they are published with the tenant of tx once tx is
+// committed. A nil outbox stores nothing, so services call Add whether events are configured or
+// not.
+func (o *Outbox) Add(ctx context.Context, tx sqlx.ExecerContext, evs ...events.Event) error {
+	if o == nil || len(evs) == 0 {
+		return nil
+	}
+	envelopes, err := events.NewEnvelopes(evs...)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]any, len(envelopes))
+	for i, env := range envelopes {
+		encoded, err := json.Marshal(env)
+		if err != nil {
+			return err
+		}
+		// lib/pq sends []byte as bytea, jsonb takes the text
+		rows[i] = []any{env.ID, env.Type, env.AggregateID, string(encoded)}
+	}
+	if err := postgres.InsertRows(ctx, tx, "outbox", []string{"event_id", "event_type", "aggregate_id", "envelope"}, rows); err != nil {
+		return err
+	}
+
+	// the relay may look before the commit and find nothing, it catches up on its next poll
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run relays stored events to the publisher and deletes old sent events until ctx is done.
+func (o *Outbox) Run(ctx context.Context, publisher events.EnvelopePublisher) {
+	poll := time.NewTicker(o.cfg.PollInterval)
+	defer poll.Stop()
+	cleanup := time.NewTicker(o.cfg.CleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		for {
+			n, err := o.Relay(ctx, publisher)
+			if err != nil && ctx.Err() == nil {
+				failures.Add(1)
+				o.log.Error().Err(err).Msg("Failed to relay outbox events")
+			}
+			if err != nil || n < o.cfg.BatchSize {
+				break
+			}
+		}
+		if err := o.updateLag(ctx); err != nil && ctx.Err() == nil {
+			o.log.Error().Err(err).Msg("Failed to measure outbox lag")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		case <-o.wake:
+		case <-cleanup.C:
+			n, err := o.Cleanup(ctx)
+			if err != nil && ctx.Err() == nil {
+				o.log.Error().Err(err).Msg("Failed to clean up the outbox")
+			}
+			deleted.Add(n)
+		}
+	}
+}
+
+type claimedEvent struct {
+	ID       int64  `db:"id"`
+	TenantID string `db:"tenant_id"`
+	Envelope []byte `db:"envelope"`
+}
+
+// Relay publishes a batch of unsent events, oldest first, and returns the number of claimed
+// events. The rows stay locked until they are marked sent, so concurrent relays skip them; an
+// event whose aggregate has an older event claimed by another relay waits for the next batch,
+// which keeps the events of an aggregate in order.
+func (o *Outbox) Relay(ctx context.Context, publisher events.EnvelopePublisher) (int, error) {
+	tx, err := o.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var claimed []claimedEvent
+	if err := tx.SelectContext(ctx, &claimed, `
+		with claimed as materialized (
+			select id, aggregate_id, tenant_id, envelope from outbox
+			where sent_at is null
+			order by id
+			limit $1
+			for update skip locked
+		)
+		select c.id, c.tenant_id, c.envelope from claimed c
+		where not exists (
+			select 1 from outbox o
+			where o.aggregate_id = c.aggregate_id and o.sent_at is null and o.id < c.id
+			and o.id not in (select id from claimed)
+		)
+		order by c.id`, o.cfg.BatchSize); err != nil {
+		return 0, err
+	}
+	if len(claimed) == 0 {
+		return 0, nil
+	}
+
+	envelopes := make([]events.Envelope, len(claimed))
+	ids := make([]int64, len(claimed))
+	for i, row := range claimed {
+		if err := json.Unmarshal(row.Envelope, &envelopes[i]); err != nil {
+			return 0, err
+		}
+		envelopes[i].TenantID = row.TenantID
+		ids[i] = row.ID
+	}
+	if err := publisher.PublishEnvelopes(ctx, envelopes...); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "update outbox set sent_at=now() where id = any($1);", pq.Array(ids)); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	published.Add(int64(len(claimed)))
+	return len(claimed), nil
+}
+
+// Cleanup deletes the sent events past the retention and returns their number.
+func (o *Outbox) Cleanup(ctx context.Context) (int64, error) {
+	res, err := o.db.GetDB().ExecContext(ctx,
+		"delete from outbox where sent_at < now() - make_interval(secs => $1);", o.cfg.Retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Stats is the backlog of the outbox.
+type Stats struct {
+	// Pending is the number of unsent events.
+	Pending int64 `db:"pending" json:"pending"`
+	// Lag is the age of the oldest unsent event, zero without unsent events.
+	Lag time.Duration `db:"-" json:"lag"`
+	// LagSeconds is Lag as read from the database.
+	LagSeconds float64 `db:"lag_seconds" json:"-"`
+}
+
+func (o *Outbox) Stats(ctx context.Context) (*Stats, error) {
+	stats, err := postgres.QueryOne[Stats](ctx, o.db.GetDB(), `
+		select count(*) as pending,
+		coalesce(extract(epoch from now() - min(created_at)), 0)::float8 as lag_seconds
+		from outbox where sent_at is null`)
+	if err != nil {
+		return nil, err
+	}
+	stats.Lag = time.Duration(stats.LagSeconds * float64(time.Second))
+	return stats, nil
+}
+
+func (o *Outbox) updateLag(ctx context.Context) error {
+	stats, err := o.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	pending.Set(stats.Pending)
+	lagSeconds.Set(stats.LagSeconds)
+	return nil
+}
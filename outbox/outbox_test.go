@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/romanWienicke/go-app-test/events"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	test "github.com/romanWienicke/go-app-test/foundation/testing"
+	"github.com/rs/zerolog"
+)
+
+// failingPublisher stands in for a broker that is down.
+type failingPublisher struct{}
+
+func (failingPublisher) PublishEnvelopes(context.Context, ...events.Envelope) error {
+	return errors.New("broker down")
+}
+
+func TestRelay(t *testing.T) {
+	test.SetEnv(t, "../.env")
+	dc := test.DockerComposeUp(t, "../docker-compose.yaml", "postgres")
+	test.SetupDatabaseEnv(t, dc["postgres"])
+	db := test.InitPostgres(t, "../migrations")
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Failed to close db: %v", err)
+		}
+	}()
+
+	t.Cleanup(func() {
+		t.Helper()
+		test.DockerComposeDown(t, "../docker-compose.yaml")
+	})
+	log := zerolog.Nop()
+	ctx := postgres.WithTenant(context.Background(), "default")
+	o := NewOutbox(db, &log, Config{BatchSize: 2})
+
+	orderID := uuid.New()
+	stored := []events.Event{
+		events.OrderCreated{OrderID: orderID, Status: "pending"},
+		events.CustomerCreated{CustomerID: uuid.New(), Name: "Bob"},
+		events.OrderStatusChanged{OrderID: orderID, Status: "shipped", PreviousStatus: "pending"},
+	}
+	tx, err := db.BeginTenantTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Add(ctx, tx, stored...); err != nil {
+		t.Fatalf("Failed to add events: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is marked sent while the broker is down
+	if _, err := o.Relay(ctx, failingPublisher{}); err == nil {
+		t.Fatal("Expected the relay to fail")
+	}
+	stats, err := o.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Failed to read stats: %v", err)
+	}
+	if stats.Pending != 3 || stats.Lag <= 0 {
+		t.Errorf("Expected 3 pending events with lag, got %+v", stats)
+	}
+
+	publisher := events.NewMemory()
+	for {
+		n, err := o.Relay(ctx, publisher)
+		if err != nil {
+			t.Fatalf("Failed to relay: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+	published := publisher.Published()
+	if len(published) != len(stored) {
+		t.Fatalf("Expected %d events, got %d", len(stored), len(published))
+	}
+	for i, env := range published {
+		if env.Type != stored[i].EventType() || env.AggregateID != stored[i].AggregateID() {
+			t.Errorf("Event %d: expected %s of %s, got %s of %s", i, stored[i].EventType(), stored[i].AggregateID(), env.Type, env.AggregateID)
+		}
+		if env.TenantID != "default" {
+			t.Errorf("Event %d: expected the tenant of the transaction, got %q", i, env.TenantID)
+		}
+	}
+
+	if stats, err := o.Stats(ctx); err != nil || stats.Pending != 0 || stats.Lag != 0 {
+		t.Errorf("Expected an empty backlog, got %+v, %v", stats, err)
+	}
+	if _, err := db.GetDB().ExecContext(ctx, "update outbox set sent_at = now() - interval '2 days'"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := o.Cleanup(ctx); err != nil || n != int64(len(stored)) {
+		t.Errorf("Expected the sent events to be deleted, got %d, %v", n, err)
+	}
+}
+
+func TestAddWithoutOutbox(t *testing.T) {
+	var o *Outbox
+	if err := o.Add(context.Background(), nil, events.CustomerCreated{}); err != nil {
+		t.Errorf("Expected a nil outbox to store nothing: %v", err)
+	}
+}
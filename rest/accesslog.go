@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+// requestIDKey is the context key of the request ID.
+const requestIDKey = "request_id"
+
+// AccessLogConfig configures the access log.
+type AccessLogConfig struct {
+	// SampleRate is the share of successful requests that are logged, between 0 and 1. Requests
+	// failing with 4xx or 5xx are always logged.
+	SampleRate float64
+}
+
+// RequestID takes the request ID from the X-Request-Id header or generates one, stores it in the
+// context and echoes it in the response.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if id == "" || len(id) > 128 {
+				id = uuid.NewString()
+			}
+			c.Set(requestIDKey, id)
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			return next(c)
+		}
+	}
+}
+
+// GetRequestID returns the ID set by RequestID, or an empty string.
+func GetRequestID(c echo.Context) string {
+	id, _ := c.Get(requestIDKey).(string)
+	return id
+}
+
+// AccessLog logs a line per request with method, route template, status, latency, bytes, client
+// and request ID. The client is the IP the server's IPExtractor derives, so clients can't put an
+// address of their choice into the log. It has to run outermost: errors are handed to the error
+// handler here, so the logged status is the one the client received.
+func AccessLog(cfg AccessLogConfig, log *zerolog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			req, res := c.Request(), c.Response()
+			var event *zerolog.Event
+			switch {
+			case res.Status >= http.StatusInternalServerError:
+				event = log.Error()
+			case res.Status >= http.StatusBadRequest:
+				event = log.Warn()
+			case rand.Float64() < cfg.SampleRate:
+				event = log.Info()
+			default:
+				return nil
+			}
+			event.Str("method", req.Method).
+				Str("route", routePath(c)).
+				Int("status", res.Status).
+				Dur("latency", time.Since(start)).
+				Int64("bytes_in", max(req.ContentLength, 0)).
+				Int64("bytes_out", res.Size).
+				Str("client", c.RealIP()).
+				Str("request_id", GetRequestID(c)).
+				Msg("Request")
+			return nil
+		}
+	}
+}
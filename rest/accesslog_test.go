@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := map[string]struct {
+		path       string
+		requestID  string
+		sampleRate float64
+		wantLogged bool
+		wantLevel  string
+		wantStatus int
+	}{
+		"success":                 {path: "/customer/42", sampleRate: 1, wantLogged: true, wantLevel: "info", wantStatus: http.StatusOK},
+		"success not sampled":     {path: "/customer/42", sampleRate: 0},
+		"client error":            {path: "/missing", sampleRate: 0, wantLogged: true, wantLevel: "warn", wantStatus: http.StatusNotFound},
+		"server errors always":    {path: "/fail", sampleRate: 0, wantLogged: true, wantLevel: "error", wantStatus: http.StatusInternalServerError},
+		"panics have status 500":  {path: "/panic", sampleRate: 0, wantLogged: true, wantLevel: "error", wantStatus: http.StatusInternalServerError},
+		"request ID is forwarded": {path: "/customer/42", requestID: "abc-123", sampleRate: 1, wantLogged: true, wantLevel: "info", wantStatus: http.StatusOK},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := zerolog.New(&buf)
+			e := echo.New()
+			e.HTTPErrorHandler = NewErrorHandler(&log)
+			e.Use(RequestID())
+			e.Use(AccessLog(AccessLogConfig{SampleRate: tc.sampleRate}, &log))
+			e.Use(Recover())
+			e.GET("/customer/:id", func(c echo.Context) error { return c.String(http.StatusOK, "customer") })
+			e.GET("/fail", func(c echo.Context) error { return echo.ErrInternalServerError })
+			e.GET("/panic", func(c echo.Context) error { panic("boom") })
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.requestID != "" {
+				req.Header.Set(echo.HeaderXRequestID, tc.requestID)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			requestID := rec.Header().Get(echo.HeaderXRequestID)
+			if requestID == "" || (tc.requestID != "" && requestID != tc.requestID) {
+				t.Errorf("unexpected request ID %q", requestID)
+			}
+
+			var entry map[string]any
+			for line := range strings.Lines(buf.String()) {
+				var event map[string]any
+				if err := json.Unmarshal([]byte(line), &event); err != nil {
+					t.Fatalf("invalid log line %q: %v", line, err)
+				}
+				if event["message"] == "Request" {
+					entry = event
+				}
+			}
+			if !tc.wantLogged {
+				if entry != nil {
+					t.Fatalf("expected no access log, got %v", entry)
+				}
+				return
+			}
+			if entry == nil {
+				t.Fatalf("expected an access log, got %q", buf.String())
+			}
+			if entry["level"] != tc.wantLevel || entry["status"] != float64(tc.wantStatus) {
+				t.Errorf("expected %s with status %d, got %v", tc.wantLevel, tc.wantStatus, entry)
+			}
+			if entry["request_id"] != requestID || entry["method"] != http.MethodGet {
+				t.Errorf("unexpected access log %v", entry)
+			}
+			if tc.path == "/customer/42" && (entry["route"] != "/customer/:id" || entry["bytes_out"] != float64(len("customer"))) {
+				t.Errorf("unexpected route or size in %v", entry)
+			}
+		})
+	}
+}
+
+func TestAccessLogClient(t *testing.T) {
+	tests := map[string]struct {
+		trustedProxies []string
+		remoteAddr     string
+		want           string
+	}{
+		"peer address":            {remoteAddr: "203.0.113.7:1234", want: "203.0.113.7"},
+		"forwarded by proxy":      {trustedProxies: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.1:1234", want: "198.51.100.1"},
+		"untrusted peer forwards": {trustedProxies: []string{"10.0.0.0/8"}, remoteAddr: "203.0.113.7:1234", want: "203.0.113.7"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := zerolog.New(&buf)
+			s, err := NewServer(Config{TrustedProxies: tc.trustedProxies, AccessLog: &AccessLogConfig{SampleRate: 1}}, &log)
+			if err != nil {
+				t.Fatalf("Failed to create server: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, "198.51.100.1")
+			req.Header.Set(echo.HeaderXRealIP, "198.51.100.2")
+			s.Echo().ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("invalid log line %q: %v", buf.String(), err)
+			}
+			if entry["client"] != tc.want {
+				t.Errorf("expected client %s, got %v", tc.want, entry["client"])
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog"
+)
+
+var ErrNoAdminCredential = errors.New("admin server needs a password")
+
+// AdminConfig configures the admin server, which runs on a port of its own.
+type AdminConfig struct {
+	Port string
+	// Username and Password guard every admin route with basic auth.
+	Username string
+	Password string
+	// Config is shown masked on /debug/config.
+	Config map[string]string
+	// DBStats reports the database pool on /debug/db when set.
+	DBStats func() sql.DBStats
+}
+
+// NewAdminServer creates the admin server exposing routes, configuration, pprof, database pool
+// statistics, expvar metrics and build information of the API server.
+func NewAdminServer(cfg AdminConfig, log *zerolog.Logger, api *Server) (*Server, error) {
+	if cfg.Password == "" {
+		return nil, ErrNoAdminCredential
+	}
+	if cfg.Username == "" {
+		cfg.Username = "admin"
+	}
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.HTTPErrorHandler = NewErrorHandler(log)
+	e.Use(Recover())
+	e.Use(middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Realm: "admin",
+		Validator: func(username, password string, _ echo.Context) (bool, error) {
+			userOK := subtle.ConstantTimeCompare([]byte(username), []byte(cfg.Username)) == 1
+			passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(cfg.Password)) == 1
+			return userOK && passwordOK, nil
+		},
+	}))
+
+	e.GET("/debug/routes", func(c echo.Context) error {
+		routes := api.echo.Routes()
+		sort.Slice(routes, func(i, j int) bool {
+			if routes[i].Path == routes[j].Path {
+				return routes[i].Method < routes[j].Method
+			}
+			return routes[i].Path < routes[j].Path
+		})
+		return c.JSON(http.StatusOK, routes)
+	})
+
+	e.GET("/debug/config", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, MaskConfig(cfg.Config))
+	})
+
+	e.GET("/debug/db", func(c echo.Context) error {
+		if cfg.DBStats == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "No database configured")
+		}
+		return c.JSON(http.StatusOK, cfg.DBStats())
+	})
+
+	e.GET("/debug/build", func(c echo.Context) error {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "No build information available")
+		}
+		return c.JSON(http.StatusOK, buildInfo(info))
+	})
+
+	// expvar metrics of the process, like the outbox lag
+	e.GET("/debug/vars", echo.WrapHandler(expvar.Handler()))
+
+	e.GET("/debug/pprof/*", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	e.GET("/debug/pprof/cmdline", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	e.GET("/debug/pprof/profile", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	e.GET("/debug/pprof/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	e.POST("/debug/pprof/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	e.GET("/debug/pprof/trace", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+
+	return &Server{
+		echo: e,
+		// no write timeout, CPU profiles and traces stream for as long as requested
+		http: &http.Server{Addr: ":" + cfg.Port, Handler: e, ReadHeaderTimeout: api.http.ReadHeaderTimeout},
+	}, nil
+}
+
+// MaskConfig hides the values of secrets, recognized by their key.
+func MaskConfig(config map[string]string) map[string]string {
+	masked := make(map[string]string, len(config))
+	for key, value := range config {
+		upper := strings.ToUpper(key)
+		secret := strings.Contains(upper, "PASSWORD") || strings.Contains(upper, "SECRET") || strings.Contains(upper, "TOKEN")
+		if secret && value != "" {
+			value = "********"
+		}
+		masked[key] = value
+	}
+	return masked
+}
+
+type buildInformation struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Version   string            `json:"version"`
+	Settings  map[string]string `json:"settings"`
+}
+
+func buildInfo(info *debug.BuildInfo) buildInformation {
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		if strings.HasPrefix(s.Key, "vcs.") || s.Key == "GOOS" || s.Key == "GOARCH" || s.Key == "CGO_ENABLED" {
+			settings[s.Key] = s.Value
+		}
+	}
+	return buildInformation{
+		GoVersion: info.GoVersion,
+		Path:      info.Main.Path,
+		Version:   info.Main.Version,
+		Settings:  settings,
+	}
+}
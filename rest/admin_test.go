@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+func TestAdminServer(t *testing.T) {
+	log := zerolog.Nop()
+	api, err := NewServer(Config{Port: "0"}, &log, func(e *echo.Echo) {
+		e.GET("/customer/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	if _, err := NewAdminServer(AdminConfig{}, &log, api); err != ErrNoAdminCredential {
+		t.Fatalf("expected ErrNoAdminCredential, got %v", err)
+	}
+
+	admin, err := NewAdminServer(AdminConfig{
+		Password: "secret",
+		Config:   map[string]string{"DB_PASSWORD": "postgres", "HTTP_PORT": "8080"},
+		DBStats:  func() sql.DBStats { return sql.DBStats{OpenConnections: 3} },
+	}, &log, api)
+	if err != nil {
+		t.Fatalf("NewAdminServer: %v", err)
+	}
+
+	tests := map[string]struct {
+		path     string
+		user     string
+		password string
+		wantCode int
+		wantBody string
+	}{
+		"no credentials":    {path: "/debug/routes", wantCode: http.StatusUnauthorized},
+		"wrong password":    {path: "/debug/routes", user: "admin", password: "wrong", wantCode: http.StatusUnauthorized},
+		"routes":            {path: "/debug/routes", user: "admin", password: "secret", wantCode: http.StatusOK, wantBody: `"path":"/customer/:id"`},
+		"config is masked":  {path: "/debug/config", user: "admin", password: "secret", wantCode: http.StatusOK, wantBody: `"DB_PASSWORD":"********"`},
+		"config is visible": {path: "/debug/config", user: "admin", password: "secret", wantCode: http.StatusOK, wantBody: `"HTTP_PORT":"8080"`},
+		"db stats":          {path: "/debug/db", user: "admin", password: "secret", wantCode: http.StatusOK, wantBody: `"OpenConnections":3`},
+		"pprof index":       {path: "/debug/pprof/", user: "admin", password: "secret", wantCode: http.StatusOK, wantBody: "goroutine"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.user != "" {
+				req.SetBasicAuth(tc.user, tc.password)
+			}
+			rec := httptest.NewRecorder()
+			admin.echo.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tc.wantCode, rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tc.wantBody) {
+				t.Errorf("expected body to contain %s, got %s", tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
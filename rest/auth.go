@@ -0,0 +1,105 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+)
+
+// DefaultPublicRoutes are reachable without a token.
+var DefaultPublicRoutes = []string{"/ping", "/healthz"}
+
+const claimsContextKey = "auth.claims"
+
+// APIKeyAuthenticator resolves the caller of an "Authorization: ApiKey ..." header.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*auth.Claims, error)
+}
+
+// AuthConfig configures bearer token and API key authentication.
+type AuthConfig struct {
+	Verifier *auth.Verifier
+	// APIKeys enables API key authentication when set.
+	APIKeys APIKeyAuthenticator
+	// PublicRoutes lists route paths (as registered, e.g. /customer/:id) that need no token.
+	PublicRoutes []string
+}
+
+// Authenticate returns middleware requiring a valid JWT bearer token or API key on every
+// non-public route. The claims are stored in the echo context and in the request context.
+func Authenticate(cfg AuthConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if slices.Contains(cfg.PublicRoutes, c.Path()) {
+				return next(c)
+			}
+
+			var claims *auth.Claims
+			var err error
+			scheme, credential := credentials(c.Request())
+			switch {
+			case strings.EqualFold(scheme, "Bearer"):
+				claims, err = cfg.Verifier.Verify(credential)
+				if err != nil {
+					return unauthorized(c, "Invalid bearer token").SetInternal(err)
+				}
+			case strings.EqualFold(scheme, "ApiKey") && cfg.APIKeys != nil:
+				claims, err = cfg.APIKeys.AuthenticateAPIKey(c.Request().Context(), credential)
+				if err != nil {
+					return unauthorized(c, "Invalid API key").SetInternal(err)
+				}
+			default:
+				return unauthorized(c, "Missing bearer token")
+			}
+
+			c.Set(claimsContextKey, claims)
+			c.SetRequest(c.Request().WithContext(auth.ContextWithClaims(c.Request().Context(), claims)))
+			return next(c)
+		}
+	}
+}
+
+// Require returns route middleware rejecting callers whose roles don't grant the permission.
+// It is meant to be passed when registering a route, e.g.
+//
+//	e.DELETE("/customer/:id", handler, rest.Require(auth.PermCustomerDelete))
+func Require(p auth.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := ClaimsFrom(c)
+			if !ok {
+				return unauthorized(c, "Missing bearer token")
+			}
+			if !claims.Can(p) {
+				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("Missing permission %s", p))
+			}
+			return next(c)
+		}
+	}
+}
+
+// ClaimsFrom returns the claims of the authenticated caller.
+func ClaimsFrom(c echo.Context) (*auth.Claims, bool) {
+	claims, ok := c.Get(claimsContextKey).(*auth.Claims)
+	return claims, ok
+}
+
+// credentials splits the Authorization header into scheme and credential.
+func credentials(r *http.Request) (string, string) {
+	scheme, credential, found := strings.Cut(r.Header.Get(echo.HeaderAuthorization), " ")
+	credential = strings.TrimSpace(credential)
+	if !found || credential == "" {
+		return "", ""
+	}
+	return scheme, credential
+}
+
+func unauthorized(c echo.Context, message string) *echo.HTTPError {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="api"`)
+	return echo.NewHTTPError(http.StatusUnauthorized, message)
+}
@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+)
+
+func TestAuthenticate(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{Secret: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	token, err := auth.NewHS256Signer("secret").Sign(auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "alice",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}})
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	apiKeys := fakeAPIKeys{"gat_1234_secret": &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "apikey:1"}}}
+
+	e, _ := newTestEcho(t)
+	e.Use(Authenticate(AuthConfig{Verifier: verifier, APIKeys: apiKeys, PublicRoutes: DefaultPublicRoutes}))
+	e.GET("/ping", func(c echo.Context) error { return c.String(http.StatusOK, "pong") })
+	e.GET("/whoami", func(c echo.Context) error {
+		claims, ok := ClaimsFrom(c)
+		if !ok {
+			return c.String(http.StatusInternalServerError, "no claims")
+		}
+		fromCtx, ok := auth.ClaimsFromContext(c.Request().Context())
+		if !ok || fromCtx.Subject != claims.Subject {
+			return c.String(http.StatusInternalServerError, "no claims in request context")
+		}
+		return c.String(http.StatusOK, claims.Subject)
+	})
+
+	tests := map[string]struct {
+		path          string
+		authorization string
+		expectedCode  int
+		expectedBody  string
+	}{
+		"public route":  {path: "/ping", expectedCode: http.StatusOK, expectedBody: "pong"},
+		"missing token": {path: "/whoami", expectedCode: http.StatusUnauthorized, expectedBody: `{"error":"Missing bearer token"}`},
+		"invalid token": {path: "/whoami", authorization: "Bearer nope", expectedCode: http.StatusUnauthorized, expectedBody: `{"error":"Invalid bearer token"}`},
+		"wrong scheme":  {path: "/whoami", authorization: "Basic " + token, expectedCode: http.StatusUnauthorized, expectedBody: `{"error":"Missing bearer token"}`},
+		"valid token":   {path: "/whoami", authorization: "Bearer " + token, expectedCode: http.StatusOK, expectedBody: "alice"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set(echo.HeaderAuthorization, tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("Expected status %d, got %d", tt.expectedCode, rec.Code)
+			}
+			if body := rec.Body.String(); body != tt.expectedBody && body != tt.expectedBody+"\n" {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, body)
+			}
+		})
+	}
+}
+
+type fakeAPIKeys map[string]*auth.Claims
+
+func (f fakeAPIKeys) AuthenticateAPIKey(_ context.Context, key string) (*auth.Claims, error) {
+	claims, ok := f[key]
+	if !ok {
+		return nil, errors.New("unknown key")
+	}
+	return claims, nil
+}
+
+func TestRequire(t *testing.T) {
+	e, _ := newTestEcho(t)
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if role := c.Request().Header.Get("X-Role"); role != "" {
+				c.Set(claimsContextKey, &auth.Claims{Roles: []string{role}})
+			}
+			return next(c)
+		}
+	})
+	e.DELETE("/customer/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, Require(auth.PermCustomerDelete))
+
+	tests := map[string]struct {
+		role         string
+		expectedCode int
+	}{
+		"unauthenticated": {expectedCode: http.StatusUnauthorized},
+		"customer":        {role: auth.RoleCustomer, expectedCode: http.StatusForbidden},
+		"support":         {role: auth.RoleSupport, expectedCode: http.StatusForbidden},
+		"admin":           {role: auth.RoleAdmin, expectedCode: http.StatusNoContent},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/customer/1", nil)
+			req.Header.Set("X-Role", tt.role)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedCode, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
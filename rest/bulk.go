@@ -0,0 +1,305 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/rs/zerolog"
+)
+
+// MIMEApplicationNDJSON is the media type of newline delimited JSON.
+const MIMEApplicationNDJSON = "application/x-ndjson"
+
+const (
+	defaultBulkBatchSize = 500
+	// maxBulkLineSize bounds a single NDJSON line.
+	maxBulkLineSize = 1 << 20
+	// bulkDeadlineExtension is granted to the connection for every batch, so large imports are
+	// not cut off by the server's read and write timeouts.
+	bulkDeadlineExtension = time.Minute
+)
+
+// BulkConfig configures a bulk import of T.
+type BulkConfig[T any] struct {
+	DB *postgres.Db
+	// Validate checks a single decoded line.
+	Validate func(T) error
+	// Insert stores a batch of items within tx and returns their IDs in order.
+	Insert func(ctx context.Context, tx *sqlx.Tx, items []T) ([]uuid.UUID, error)
+	// BatchSize is the number of items inserted per statement, 500 by default.
+	BatchSize int
+}
+
+// BulkResult is streamed back for every non-empty input line.
+type BulkResult struct {
+	Line  int       `json:"line"`
+	ID    uuid.UUID `json:"id,omitzero"`
+	Error string    `json:"error,omitempty"`
+}
+
+// BulkSummary is the last line of a bulk response. IDs of an atomic import are only valid when
+// it was committed.
+type BulkSummary struct {
+	Total     int  `json:"total"`
+	Created   int  `json:"created"`
+	Failed    int  `json:"failed"`
+	Committed bool `json:"committed"`
+}
+
+type bulkItem[T any] struct {
+	line int
+	item T
+}
+
+// Bulk returns a handler importing an NDJSON request body line by line. Valid lines are inserted
+// in batches, every batch in a transaction of its own; with ?atomic=true the whole import runs in a
+// single transaction that is only committed when every line succeeded. The response streams a
+// BulkResult per line in input order followed by a {"summary": BulkSummary} line.
+func Bulk[T any](cfg BulkConfig[T], log *zerolog.Logger) echo.HandlerFunc {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBulkBatchSize
+	}
+
+	return func(c echo.Context) error {
+		mediaType, _, err := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+		if err != nil || mediaType != MIMEApplicationNDJSON {
+			return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Unsupported media type, expected "+MIMEApplicationNDJSON)
+		}
+		atomic := false
+		if value := c.QueryParam("atomic"); value != "" {
+			if atomic, err = strconv.ParseBool(value); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameter atomic")
+			}
+		}
+
+		imp := &bulkImport[T]{cfg: cfg, c: c, atomic: atomic, log: log, rc: http.NewResponseController(c.Response())}
+		if err := imp.begin(); err != nil {
+			return err
+		}
+		defer imp.rollback()
+
+		// results are streamed while the body is still read; an HTTP/1 server would otherwise
+		// close the unread body once the response starts. Writers that can't interleave get the
+		// results after the whole body is read.
+		imp.buffered = imp.rc.EnableFullDuplex() != nil
+		imp.extendDeadlines()
+
+		c.Response().Header().Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+		c.Response().WriteHeader(http.StatusOK)
+
+		if err := imp.run(); err != nil {
+			// the response is already committed, the client sees a truncated stream without summary
+			log.Error().Err(err).Str("path", routePath(c)).Msg("Bulk import aborted")
+			return nil
+		}
+		return nil
+	}
+}
+
+type bulkImport[T any] struct {
+	cfg    BulkConfig[T]
+	c      echo.Context
+	atomic bool
+	log    *zerolog.Logger
+	rc     *http.ResponseController
+
+	tx      *sqlx.Tx
+	summary BulkSummary
+	// results collects the results of the current batch, validation errors included
+	results []BulkResult
+	pending []bulkItem[T]
+	// failed marks an atomic import that will be rolled back
+	failed bool
+	// buffered holds the results back until the body is read, see Bulk
+	buffered bool
+}
+
+func (b *bulkImport[T]) run() error {
+	scanner := bufio.NewScanner(b.c.Request().Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBulkLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		b.summary.Total++
+
+		var item T
+		if err := json.Unmarshal(raw, &item); err != nil {
+			b.fail(BulkResult{Line: line, Error: "Invalid JSON: " + err.Error()})
+		} else if err := b.cfg.Validate(item); err != nil {
+			b.fail(BulkResult{Line: line, Error: err.Error()})
+		} else {
+			b.pending = append(b.pending, bulkItem[T]{line: line, item: item})
+		}
+		// results of invalid lines count too, so a stream of them isn't held in memory
+		if len(b.pending) >= b.cfg.BatchSize || len(b.results) >= b.cfg.BatchSize {
+			if err := b.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	b.buffered = false
+	if err := b.flush(); err != nil {
+		return err
+	}
+
+	if b.atomic && !b.failed {
+		if err := b.tx.Commit(); err != nil {
+			return err
+		}
+		b.summary.Committed = true
+	}
+	if !b.atomic {
+		b.summary.Committed = true
+	}
+	return b.write(map[string]BulkSummary{"summary": b.summary})
+}
+
+func (b *bulkImport[T]) fail(result BulkResult) {
+	b.summary.Failed++
+	b.failed = true
+	b.results = append(b.results, result)
+}
+
+// flush inserts the pending batch and writes the results collected since the last flush, unless
+// they are buffered. When the batch insert fails, the items are retried one by one to find the
+// offending lines.
+func (b *bulkImport[T]) flush() error {
+	ctx := b.c.Request().Context()
+	b.extendDeadlines()
+
+	if len(b.pending) > 0 {
+		items := make([]T, len(b.pending))
+		for i, p := range b.pending {
+			items[i] = p.item
+		}
+
+		ids, err := b.insert(ctx, items)
+		if err == nil {
+			for i, p := range b.pending {
+				b.created(p.line, ids[i])
+			}
+		} else {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			for _, p := range b.pending {
+				ids, err := b.insert(ctx, []T{p.item})
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if err != nil {
+					b.fail(BulkResult{Line: p.line, Error: b.insertError(err)})
+					continue
+				}
+				b.created(p.line, ids[0])
+			}
+		}
+		b.pending = b.pending[:0]
+	}
+
+	if !b.atomic {
+		if err := b.tx.Commit(); err != nil {
+			return err
+		}
+		if err := b.begin(); err != nil {
+			return err
+		}
+	}
+	if b.buffered {
+		return nil
+	}
+
+	sort.Slice(b.results, func(i, j int) bool { return b.results[i].Line < b.results[j].Line })
+	for _, result := range b.results {
+		if err := b.write(result); err != nil {
+			return err
+		}
+	}
+	b.results = b.results[:0]
+	return b.rc.Flush()
+}
+
+func (b *bulkImport[T]) created(line int, id uuid.UUID) {
+	b.summary.Created++
+	b.results = append(b.results, BulkResult{Line: line, ID: id})
+}
+
+// insert runs the insert inside a savepoint, so a failure leaves the transaction usable.
+func (b *bulkImport[T]) insert(ctx context.Context, items []T) ([]uuid.UUID, error) {
+	if _, err := b.tx.ExecContext(ctx, "savepoint bulk_insert"); err != nil {
+		return nil, err
+	}
+	ids, err := b.cfg.Insert(ctx, b.tx, items)
+	if err != nil {
+		if _, rerr := b.tx.ExecContext(ctx, "rollback to savepoint bulk_insert"); rerr != nil {
+			return nil, errors.Join(err, rerr)
+		}
+		return nil, err
+	}
+	_, err = b.tx.ExecContext(ctx, "release savepoint bulk_insert")
+	return ids, err
+}
+
+// insertError describes a failed insert to the client, database constraint violations are
+// passed on, everything else is only logged.
+func (b *bulkImport[T]) insertError(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Message
+	}
+	b.log.Error().Err(err).Str("path", routePath(b.c)).Msg("Bulk insert failed")
+	return "Failed to insert"
+}
+
+func (b *bulkImport[T]) begin() error {
+	// rows are inserted for the tenant of the request
+	tx, err := b.cfg.DB.BeginTenantTx(b.c.Request().Context(), nil)
+	if err != nil {
+		return err
+	}
+	b.tx = tx
+	return nil
+}
+
+func (b *bulkImport[T]) rollback() {
+	if b.tx != nil {
+		_ = b.tx.Rollback()
+	}
+}
+
+func (b *bulkImport[T]) write(v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = b.c.Response().Write(append(line, '\n'))
+	return err
+}
+
+func (b *bulkImport[T]) extendDeadlines() {
+	deadline := time.Now().Add(bulkDeadlineExtension)
+	// not every writer supports deadlines, e.g. httptest.ResponseRecorder
+	_ = b.rc.SetReadDeadline(deadline)
+	_ = b.rc.SetWriteDeadline(deadline)
+}
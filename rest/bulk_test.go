@@ -0,0 +1,250 @@
+package rest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	test "github.com/romanWienicke/go-app-test/foundation/testing"
+	"github.com/rs/zerolog"
+)
+
+type bulkCustomer struct {
+	Name  string `json:"name" validate:"required,min=2"`
+	Email string `json:"email" validate:"required,email"`
+}
+
+func bulkCustomerConfig(db *postgres.Db) BulkConfig[bulkCustomer] {
+	return BulkConfig[bulkCustomer]{
+		DB:        db,
+		BatchSize: 2,
+		Validate:  func(c bulkCustomer) error { return validator.New().Struct(c) },
+		Insert: func(ctx context.Context, tx *sqlx.Tx, customers []bulkCustomer) ([]uuid.UUID, error) {
+			ids := make([]uuid.UUID, len(customers))
+			rows := make([][]any, len(customers))
+			for i, c := range customers {
+				ids[i] = uuid.New()
+				rows[i] = []any{ids[i], c.Name, c.Email}
+			}
+			return ids, postgres.InsertRows(ctx, tx, "customers", []string{"id", "name", "email"}, rows)
+		},
+	}
+}
+
+func TestBulkRejectsOtherMediaTypes(t *testing.T) {
+	log := zerolog.Nop()
+	e := echo.New()
+	e.POST("/customer\\:bulk", Bulk(bulkCustomerConfig(nil), &log))
+
+	req := httptest.NewRequest(http.MethodPost, "/customer:bulk", strings.NewReader(`[{"name":"Bob"}]`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestPostgresBulk(t *testing.T) {
+	test.SetEnv(t, "../.env")
+	dc := test.DockerComposeUp(t, "../docker-compose.yaml", "postgres")
+	test.SetupDatabaseEnv(t, dc["postgres"])
+	db := test.InitPostgres(t, "../migrations")
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Failed to close db: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		t.Helper()
+		test.DockerComposeDown(t, "../docker-compose.yaml")
+	})
+
+	log := zerolog.Nop()
+	e := echo.New()
+	e.Use(Tenant(TenantConfig{Default: "default"}))
+	e.POST("/customer\\:bulk", Bulk(bulkCustomerConfig(db), &log))
+
+	body := func(prefix string) string {
+		return strings.Join([]string{
+			`{"name":"Ann","email":"ann` + prefix + `@example.com"}`,
+			`{"name":`,
+			``,
+			`{"name":"B","email":"b` + prefix + `@example.com"}`,
+			`{"name":"Cid","email":"ann` + prefix + `@example.com"}`,
+			`{"name":"Dan","email":"dan` + prefix + `@example.com"}`,
+		}, "\n")
+	}
+
+	tests := map[string]struct {
+		query     string
+		prefix    string
+		wantLines []string
+		wantRows  int
+	}{
+		"per line": {
+			prefix: "1",
+			wantLines: []string{
+				`{"line":1,"id":"`,
+				`{"line":2,"error":"Invalid JSON`,
+				`{"line":4,"error":"Key: 'bulkCustomer.Name'`,
+				`{"line":5,"error":"duplicate key value violates unique constraint`,
+				`{"line":6,"id":"`,
+				`{"summary":{"total":5,"created":2,"failed":3,"committed":true}}`,
+			},
+			wantRows: 2,
+		},
+		"atomic": {
+			query:  "?atomic=true",
+			prefix: "2",
+			wantLines: []string{
+				`{"line":1,"id":"`,
+				`{"line":2,"error":"Invalid JSON`,
+				`{"line":4,"error":"Key: 'bulkCustomer.Name'`,
+				`{"line":5,"error":"duplicate key value violates unique constraint`,
+				`{"line":6,"id":"`,
+				`{"summary":{"total":5,"created":2,"failed":3,"committed":false}}`,
+			},
+			wantRows: 0,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/customer:bulk"+tc.query, strings.NewReader(body(tc.prefix)))
+			req.Header.Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+			if len(lines) != len(tc.wantLines) {
+				t.Fatalf("expected %d lines, got %s", len(tc.wantLines), rec.Body.String())
+			}
+			for i, want := range tc.wantLines {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("line %d: expected prefix %s, got %s", i, want, lines[i])
+				}
+			}
+
+			var rows int
+			if err := db.GetDB().Get(&rows, "select count(*) from customers where email like '%' || $1 || '@example.com'", tc.prefix); err != nil {
+				t.Fatalf("Failed to count customers: %v", err)
+			}
+			if rows != tc.wantRows {
+				t.Errorf("expected %d stored customers, got %d", tc.wantRows, rows)
+			}
+		})
+	}
+
+	t.Run("invalid lines are streamed", func(t *testing.T) {
+		// the results of invalid lines are written once a batch of them is collected, not only
+		// with the next insert or at the end of the body
+		e := echo.New()
+		e.Use(Tenant(TenantConfig{Default: "default"}))
+		e.POST("/customer\\:bulk", Bulk(bulkCustomerConfig(db), &log))
+		server := httptest.NewServer(e)
+		defer server.Close()
+
+		pr, pw := io.Pipe()
+		defer func() { _ = pw.Close() }()
+		go func() {
+			_, _ = io.WriteString(pw, "{\"name\":\"Invalid\"}\n{\"name\":\"Invalid\"}\n")
+		}()
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/customer:bulk", pr)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+
+		first := make(chan string, 1)
+		go func() {
+			defer close(first)
+			res, err := server.Client().Do(req)
+			if err != nil {
+				return
+			}
+			defer func() { _ = res.Body.Close() }()
+			scanner := bufio.NewScanner(res.Body)
+			if scanner.Scan() {
+				first <- scanner.Text()
+			}
+		}()
+
+		select {
+		case line := <-first:
+			if !strings.HasPrefix(line, `{"line":1,"error":"Key: 'bulkCustomer.Email'`) {
+				t.Errorf("expected the validation error of line 1, got %q", line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected results while the body is still open")
+		}
+	})
+
+	t.Run("chunked upload over a connection", func(t *testing.T) {
+		// the results are streamed while the body is read, which a real HTTP/1 server only allows
+		// with full duplex; the body is larger than what the server drains on its own
+		const customers = 20000
+		cfg := bulkCustomerConfig(db)
+		cfg.BatchSize = 500
+		e := echo.New()
+		e.Use(Tenant(TenantConfig{Default: "default"}))
+		e.POST("/customer\\:bulk", Bulk(cfg, &log))
+		server := httptest.NewServer(e)
+		defer server.Close()
+
+		pr, pw := io.Pipe()
+		go func() {
+			for i := range customers {
+				if _, err := fmt.Fprintf(pw, "{\"name\":\"Customer %d\",\"email\":\"chunked%d@example.com\"}\n", i, i); err != nil {
+					return
+				}
+			}
+			_ = pw.Close()
+		}()
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/customer:bulk", pr)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+		res, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		defer func() { _ = res.Body.Close() }()
+
+		var last string
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			last = scanner.Text()
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		var summary struct {
+			Summary BulkSummary `json:"summary"`
+		}
+		if err := json.Unmarshal([]byte(last), &summary); err != nil {
+			t.Fatalf("expected a summary line, got %s", last)
+		}
+		want := BulkSummary{Total: customers, Created: customers, Committed: true}
+		if summary.Summary != want {
+			t.Errorf("expected summary %+v, got %+v", want, summary.Summary)
+		}
+	})
+}
@@ -0,0 +1,278 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+
+	defaultCompressMinSize = 1024
+)
+
+// CompressConfig configures response compression.
+type CompressConfig struct {
+	// MinSize is the response size in bytes from which on responses are compressed, 1024 by
+	// default. Streamed responses are compressed once they flush.
+	MinSize int
+	// SkipRoutes lists routes as "METHOD /path" whose responses are never compressed.
+	SkipRoutes []string
+}
+
+// encoders holds pooled response encoders by content coding, in order of server preference.
+var encoders = []struct {
+	name string
+	pool *sync.Pool
+}{
+	{encodingZstd, &sync.Pool{New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		return w
+	}}},
+	{encodingGzip, &sync.Pool{New: func() any {
+		return gzip.NewWriter(nil)
+	}}},
+}
+
+func encoderPool(encoding string) *sync.Pool {
+	for _, enc := range encoders {
+		if enc.name == encoding {
+			return enc.pool
+		}
+	}
+	panic("unknown content coding " + encoding)
+}
+
+// resettableWriter is implemented by the gzip and zstd encoders.
+type resettableWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Compress compresses responses with zstd or gzip as negotiated with Accept-Encoding. Responses
+// below the minimum size, responses that already carry a Content-Encoding and skipped routes are
+// sent as they are.
+func Compress(cfg CompressConfig) echo.MiddlewareFunc {
+	if cfg.MinSize <= 0 {
+		cfg.MinSize = defaultCompressMinSize
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			res := c.Response()
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+			if c.Request().Method == http.MethodHead || slices.Contains(cfg.SkipRoutes, routeKey(c)) {
+				return next(c)
+			}
+			encoding := negotiateEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding))
+			if encoding == "" {
+				return next(c)
+			}
+
+			original := res.Writer
+			cw := &compressWriter{ResponseWriter: original, encoding: encoding, minSize: cfg.MinSize}
+			res.Writer = cw
+
+			err := next(c)
+			if err != nil && !cw.wroteHeader {
+				// nothing is written yet, the error handler answers uncompressed
+				res.Writer = original
+				return err
+			}
+			if cerr := cw.close(); err == nil {
+				err = cerr
+			}
+			res.Writer = original
+			return err
+		}
+	}
+}
+
+// negotiateEncoding picks zstd or gzip from an Accept-Encoding header, by quality and then by
+// server preference.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		qualities[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range encoders {
+		q, ok := qualities[enc.name]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc.name, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the response until it reaches the minimum size, then switches to
+// compressed output. Smaller responses are written unchanged when the handler returns.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+	// enc is set once compression started, passthrough once it was ruled out
+	enc         resettableWriter
+	passthrough bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		w.Header().Get(echo.HeaderContentEncoding) != "" {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case w.passthrough:
+		return w.ResponseWriter.Write(b)
+	case w.enc != nil:
+		return w.enc.Write(b)
+	}
+
+	w.buf.Write(b)
+	if w.buf.Len() >= w.minSize {
+		if err := w.startCompression(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush starts compression for streamed responses and flushes the encoder.
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.passthrough && w.enc == nil {
+		if err := w.startCompression(); err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			return
+		}
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *compressWriter) startCompression() error {
+	header := w.Header()
+	header.Set(echo.HeaderContentEncoding, w.encoding)
+	header.Del(echo.HeaderContentLength)
+	w.ResponseWriter.WriteHeader(w.status)
+
+	w.enc = encoderPool(w.encoding).Get().(resettableWriter)
+	w.enc.Reset(w.ResponseWriter)
+	_, err := w.enc.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// close finishes the response: a compressed stream is terminated, a small buffered response is
+// written as it is.
+func (w *compressWriter) close() error {
+	if w.enc != nil {
+		err := w.enc.Close()
+		w.enc.Reset(nil)
+		encoderPool(w.encoding).Put(w.enc)
+		w.enc = nil
+		return err
+	}
+	if w.passthrough || !w.wroteHeader {
+		return nil
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	return err
+}
+
+// Decompress transparently decompresses request bodies sent with Content-Encoding gzip or zstd.
+// It has to run before BodyLimit, so the limit applies to the decompressed size.
+func Decompress() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			encoding := strings.ToLower(strings.TrimSpace(req.Header.Get(echo.HeaderContentEncoding)))
+			var body io.ReadCloser
+			switch encoding {
+			case "", "identity":
+				return next(c)
+			case encodingGzip:
+				zr, err := gzip.NewReader(req.Body)
+				if err != nil {
+					return echo.NewHTTPError(http.StatusBadRequest, "Invalid gzip request body").SetInternal(err)
+				}
+				body = zr
+			case encodingZstd:
+				zr, err := zstd.NewReader(req.Body, zstd.WithDecoderConcurrency(1))
+				if err != nil {
+					return echo.NewHTTPError(http.StatusBadRequest, "Invalid zstd request body").SetInternal(err)
+				}
+				body = zr.IOReadCloser()
+			default:
+				return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Unsupported content encoding "+encoding)
+			}
+			defer func() { _ = body.Close() }()
+
+			req.Body = body
+			req.ContentLength = -1
+			req.Header.Del(echo.HeaderContentEncoding)
+			req.Header.Del(echo.HeaderContentLength)
+			return next(c)
+		}
+	}
+}
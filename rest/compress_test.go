@@ -0,0 +1,161 @@
+package rest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+)
+
+func newCompressingEcho(t *testing.T) *echo.Echo {
+	e, _ := newTestEcho(t)
+	e.Use(Compress(CompressConfig{MinSize: 100, SkipRoutes: []string{"GET /skipped"}}))
+	e.Use(Decompress())
+	e.Use(BodyLimit("1K", nil))
+
+	large := strings.Repeat("compressible ", 50)
+	e.GET("/small", func(c echo.Context) error { return c.String(http.StatusOK, "tiny") })
+	e.GET("/large", func(c echo.Context) error { return c.String(http.StatusOK, large) })
+	e.GET("/skipped", func(c echo.Context) error { return c.String(http.StatusOK, large) })
+	e.GET("/error", func(c echo.Context) error { return echo.NewHTTPError(http.StatusTeapot, large) })
+	e.GET("/stream", func(c echo.Context) error {
+		c.Response().WriteHeader(http.StatusOK)
+		for range 3 {
+			if _, err := c.Response().Write([]byte("chunk\n")); err != nil {
+				return err
+			}
+			c.Response().Flush()
+		}
+		return nil
+	})
+	e.POST("/echo", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(body))
+	})
+	return e
+}
+
+func decode(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("gzip: %v", err)
+		}
+		r = zr
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("zstd: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return string(body)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decompress %s: %v", encoding, err)
+	}
+	return string(plain)
+}
+
+func TestCompress(t *testing.T) {
+	tests := map[string]struct {
+		path           string
+		acceptEncoding string
+		wantCode       int
+		wantEncoding   string
+		wantBody       string
+	}{
+		"below minimum size":     {path: "/small", acceptEncoding: "gzip", wantCode: http.StatusOK, wantBody: "tiny"},
+		"gzip":                   {path: "/large", acceptEncoding: "gzip", wantCode: http.StatusOK, wantEncoding: "gzip", wantBody: "compressible compressible"},
+		"zstd preferred":         {path: "/large", acceptEncoding: "gzip, zstd", wantCode: http.StatusOK, wantEncoding: "zstd", wantBody: "compressible compressible"},
+		"quality wins":           {path: "/large", acceptEncoding: "zstd;q=0.5, gzip", wantCode: http.StatusOK, wantEncoding: "gzip", wantBody: "compressible"},
+		"wildcard":               {path: "/large", acceptEncoding: "*", wantCode: http.StatusOK, wantEncoding: "zstd", wantBody: "compressible"},
+		"excluded":               {path: "/large", acceptEncoding: "gzip;q=0, br", wantCode: http.StatusOK, wantBody: "compressible"},
+		"no accept-encoding":     {path: "/large", wantCode: http.StatusOK, wantBody: "compressible"},
+		"skipped route":          {path: "/skipped", acceptEncoding: "gzip", wantCode: http.StatusOK, wantBody: "compressible"},
+		"errors are sent plain":  {path: "/error", acceptEncoding: "gzip", wantCode: http.StatusTeapot, wantBody: "compressible"},
+		"streams are compressed": {path: "/stream", acceptEncoding: "gzip", wantCode: http.StatusOK, wantEncoding: "gzip", wantBody: "chunk\nchunk\nchunk\n"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := newCompressingEcho(t)
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set(echo.HeaderAcceptEncoding, tc.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d", tc.wantCode, rec.Code)
+			}
+			encoding := rec.Header().Get(echo.HeaderContentEncoding)
+			if encoding != tc.wantEncoding {
+				t.Fatalf("expected content encoding %q, got %q", tc.wantEncoding, encoding)
+			}
+			if !strings.Contains(rec.Header().Get(echo.HeaderVary), echo.HeaderAcceptEncoding) {
+				t.Errorf("expected Vary: Accept-Encoding, got %q", rec.Header().Get(echo.HeaderVary))
+			}
+			if body := decode(t, encoding, rec.Body.Bytes()); !strings.Contains(body, tc.wantBody) {
+				t.Errorf("expected body to contain %q, got %q", tc.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	gzipped := func(s string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write([]byte(s))
+		_ = zw.Close()
+		return buf.Bytes()
+	}
+
+	tests := map[string]struct {
+		encoding string
+		body     []byte
+		wantCode int
+		wantBody string
+	}{
+		"plain":                  {body: []byte("hello"), wantCode: http.StatusOK, wantBody: "hello"},
+		"gzip":                   {encoding: "gzip", body: gzipped("hello"), wantCode: http.StatusOK, wantBody: "hello"},
+		"corrupt gzip":           {encoding: "gzip", body: []byte("hello"), wantCode: http.StatusBadRequest},
+		"limit after decompress": {encoding: "gzip", body: gzipped(strings.Repeat("a", 2048)), wantCode: http.StatusRequestEntityTooLarge},
+		"unsupported encoding":   {encoding: "br", body: []byte("hello"), wantCode: http.StatusUnsupportedMediaType},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := newCompressingEcho(t)
+			req := httptest.NewRequest(http.MethodPost, "/echo", bytes.NewReader(tc.body))
+			if tc.encoding != "" {
+				req.Header.Set(echo.HeaderContentEncoding, tc.encoding)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tc.wantCode, rec.Code, rec.Body.String())
+			}
+			if tc.wantBody != "" && rec.Body.String() != tc.wantBody {
+				t.Errorf("expected body %q, got %q", tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
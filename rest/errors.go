@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/money"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/rs/zerolog"
+)
+
+// ErrorResponse is the body written for every failed request. Server errors carry an ID that is
+// logged along with the cause, so reports can be matched to the logs.
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	ErrorID string `json:"error_id,omitempty"`
+}
+
+// NewErrorHandler returns the central echo error handler. Every error returned by a handler or a
+// middleware is rendered as {"error": "..."}; unexpected errors are logged and reported as 500.
+func NewErrorHandler(log *zerolog.Logger) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		code, message := errorStatus(err)
+
+		response := ErrorResponse{Error: message}
+		if code >= http.StatusInternalServerError {
+			response.ErrorID = uuid.NewString()
+			log.Error().Err(err).Str("error_id", response.ErrorID).Str("request_id", GetRequestID(c)).
+				Str("method", c.Request().Method).Str("path", c.Path()).Msg("Request failed")
+		}
+
+		var werr error
+		if c.Request().Method == http.MethodHead {
+			werr = c.NoContent(code)
+		} else {
+			werr = c.JSON(code, response)
+		}
+		if werr != nil {
+			log.Error().Err(werr).Msg("Failed to write error response")
+		}
+	}
+}
+
+// errorStatus maps an error to its HTTP status and client message, unexpected errors are 500.
+func errorStatus(err error) (int, string) {
+	var he *echo.HTTPError
+	switch {
+	case errors.As(err, &he):
+		if m, ok := he.Message.(string); ok {
+			return he.Code, m
+		}
+		return he.Code, http.StatusText(he.Code)
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable, "Request timed out"
+	}
+	return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+}
+
+// ServiceError maps an error of a service method to the error shared by the REST routes and the
+// RPC methods: validation errors and invalid amounts are 400, postgres.ErrNoRows is 404 with
+// notFound and anything else is 500 with failed. The cause stays attached for the log.
+func ServiceError(err error, notFound, failed string) error {
+	var validationErrors validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrors):
+		return echo.NewHTTPError(http.StatusBadRequest, "Validation failed: "+err.Error()).SetInternal(err)
+	case money.IsInvalid(err):
+		return echo.NewHTTPError(http.StatusBadRequest, "Validation failed: "+err.Error()).SetInternal(err)
+	case notFound != "" && errors.Is(err, postgres.ErrNoRows):
+		return echo.NewHTTPError(http.StatusNotFound, notFound).SetInternal(err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return err
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, failed).SetInternal(err)
+}
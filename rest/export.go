@@ -0,0 +1,217 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// exportFlushRows is the number of rows written between two flushes of an export.
+	exportFlushRows = 100
+	// exportDeadlineExtension is granted to the connection with every flush of an export.
+	exportDeadlineExtension = time.Minute
+)
+
+// ExportLimitConfig bounds the exports running at once. Every export holds a database connection
+// and transaction while the client reads, so slow or parallel readers would otherwise take the
+// connections of all other requests.
+type ExportLimitConfig struct {
+	// Routes lists the export routes, keyed by "METHOD /path" as registered, e.g. "GET /order/export".
+	Routes []string
+	// PerClient caps the concurrent exports of an API key, user or client IP, 2 by default.
+	PerClient int
+	// Total caps the concurrent exports of this instance, 10 by default.
+	Total int
+	// MaxDuration cancels exports running longer, 30 minutes by default.
+	MaxDuration time.Duration
+}
+
+func (cfg ExportLimitConfig) withDefaults() ExportLimitConfig {
+	if cfg.PerClient <= 0 {
+		cfg.PerClient = 2
+	}
+	if cfg.Total <= 0 {
+		cfg.Total = 10
+	}
+	if cfg.MaxDuration <= 0 {
+		cfg.MaxDuration = 30 * time.Minute
+	}
+	return cfg
+}
+
+// LimitExports returns middleware answering 429 to exports beyond the caps of cfg and bounding
+// the duration of the others. It has to run after Authenticate to tell clients apart.
+func LimitExports(cfg ExportLimitConfig) echo.MiddlewareFunc {
+	cfg = cfg.withDefaults()
+	var mu sync.Mutex
+	running := map[string]int{}
+	total := 0
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !slices.Contains(cfg.Routes, routeKey(c)) {
+				return next(c)
+			}
+
+			client := clientIdentity(c)
+			mu.Lock()
+			if total >= cfg.Total || running[client] >= cfg.PerClient {
+				mu.Unlock()
+				return echo.NewHTTPError(http.StatusTooManyRequests, "Too many concurrent exports")
+			}
+			total++
+			running[client]++
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				defer mu.Unlock()
+				total--
+				if running[client]--; running[client] == 0 {
+					delete(running, client)
+				}
+			}()
+
+			ctx, cancel := context.WithTimeout(c.Request().Context(), cfg.MaxDuration)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// ExportFormat negotiates the format of a streamed export from the Accept header: NDJSON by
+// default or CSV. Other types yield a 406.
+func ExportFormat(c echo.Context) (string, error) {
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	if strings.TrimSpace(accept) == "" {
+		return MIMEApplicationNDJSON, nil
+	}
+	for _, r := range acceptRanges(accept) {
+		switch {
+		case r.mediaType == MIMEApplicationNDJSON || r.mediaType == "*/*" || r.mediaType == "application/*":
+			return MIMEApplicationNDJSON, nil
+		case r.mediaType == MIMETextCSV || r.mediaType == "text/*":
+			return MIMETextCSV, nil
+		}
+	}
+	return "", echo.NewHTTPError(http.StatusNotAcceptable, "Not acceptable, supported media types: application/x-ndjson, text/csv")
+}
+
+// Export streams the rows produced by stream in the negotiated format, flushing every 100 rows.
+// Each flush extends the connection's write deadline, so exports may outlast the server's write
+// timeout; the route should be exempt from the handler deadline. A client disconnect cancels the
+// request context and thereby stream.
+func Export[T any](c echo.Context, format string, log *zerolog.Logger, stream func(ctx context.Context, emit func(T) error) error) error {
+	w := &exportWriter[T]{res: c.Response(), rc: http.NewResponseController(c.Response()), format: format}
+
+	err := stream(c.Request().Context(), w.write)
+	if !w.res.Committed {
+		if err != nil {
+			// nothing is sent yet, the error handler can still answer
+			return err
+		}
+		// an empty export still has a CSV header
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		// the status is already sent, the client sees a truncated stream
+		log.Error().Err(err).Str("path", routePath(c)).Int("rows", w.rows).Msg("Export aborted")
+		return nil
+	}
+	return w.flush()
+}
+
+// exportWriter sends the status with the first row and encodes the rows as NDJSON or CSV.
+type exportWriter[T any] struct {
+	res    *echo.Response
+	rc     *http.ResponseController
+	format string
+	rows   int
+	json   *json.Encoder
+	csv    *csvEncoder
+}
+
+func (w *exportWriter[T]) start() error {
+	w.extendDeadline()
+	if w.format == MIMETextCSV {
+		w.res.Header().Set(echo.HeaderContentType, MIMETextCSV+"; charset=UTF-8")
+		w.res.WriteHeader(http.StatusOK)
+		enc, err := newCSVEncoder(w.res, reflect.TypeFor[T]())
+		w.csv = enc
+		return err
+	}
+	w.res.Header().Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+	w.res.WriteHeader(http.StatusOK)
+	w.json = json.NewEncoder(w.res)
+	return nil
+}
+
+func (w *exportWriter[T]) write(row T) error {
+	if !w.res.Committed {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if w.csv != nil {
+		err = w.csv.encode(reflect.ValueOf(row))
+	} else {
+		err = w.json.Encode(row)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.rows++
+	if w.rows%exportFlushRows == 0 {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *exportWriter[T]) flush() error {
+	if w.csv != nil {
+		if err := w.csv.flush(); err != nil {
+			return err
+		}
+	}
+	if err := w.rc.Flush(); err != nil {
+		return err
+	}
+	w.extendDeadline()
+	return nil
+}
+
+// extendDeadline is best effort, not every writer supports deadlines.
+func (w *exportWriter[T]) extendDeadline() {
+	_ = w.rc.SetWriteDeadline(time.Now().Add(exportDeadlineExtension))
+}
+
+// QueryTime parses an optional query parameter given as RFC 3339 timestamp or as date, a missing
+// parameter yields the zero time.
+func QueryTime(c echo.Context, name string) (time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameter "+name+", expected a date or RFC 3339 timestamp")
+	}
+	return t, nil
+}
@@ -0,0 +1,212 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+type exportRow struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestExport(t *testing.T) {
+	rows := func(n int, err error) func(ctx context.Context, emit func(exportRow) error) error {
+		return func(ctx context.Context, emit func(exportRow) error) error {
+			for i := 1; i <= n; i++ {
+				if err := emit(exportRow{ID: i, Name: "row"}); err != nil {
+					return err
+				}
+			}
+			return err
+		}
+	}
+
+	tests := map[string]struct {
+		accept          string
+		stream          func(ctx context.Context, emit func(exportRow) error) error
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		"ndjson by default": {
+			stream: rows(2, nil), wantCode: http.StatusOK, wantContentType: MIMEApplicationNDJSON,
+			wantBody: "{\"id\":1,\"name\":\"row\"}\n{\"id\":2,\"name\":\"row\"}\n",
+		},
+		"csv": {
+			accept: "text/csv", stream: rows(2, nil), wantCode: http.StatusOK, wantContentType: MIMETextCSV,
+			wantBody: "id,name\n1,row\n2,row\n",
+		},
+		"empty csv has a header": {
+			accept: "text/csv", stream: rows(0, nil), wantCode: http.StatusOK, wantContentType: MIMETextCSV,
+			wantBody: "id,name\n",
+		},
+		"more rows than a flush": {
+			stream: rows(250, nil), wantCode: http.StatusOK, wantContentType: MIMEApplicationNDJSON,
+			wantBody: "{\"id\":250,\"name\":\"row\"}\n",
+		},
+		"error before the first row": {
+			stream: rows(0, errors.New("connection refused")), wantCode: http.StatusInternalServerError,
+		},
+		"error after the first row truncates": {
+			stream: rows(1, errors.New("connection reset")), wantCode: http.StatusOK,
+			wantBody: "{\"id\":1,\"name\":\"row\"}\n",
+		},
+		"unsupported type": {
+			accept: "application/xml", stream: rows(1, nil), wantCode: http.StatusNotAcceptable,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, log := newTestEcho(t)
+			e.GET("/export", func(c echo.Context) error {
+				format, err := ExportFormat(c)
+				if err != nil {
+					return err
+				}
+				return Export(c, format, log, tc.stream)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/export", nil)
+			if tc.accept != "" {
+				req.Header.Set(echo.HeaderAccept, tc.accept)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tc.wantCode, rec.Code, rec.Body.String())
+			}
+			if tc.wantContentType != "" && !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), tc.wantContentType) {
+				t.Errorf("expected content type %s, got %s", tc.wantContentType, rec.Header().Get(echo.HeaderContentType))
+			}
+			if tc.wantBody != "" && !strings.HasSuffix(rec.Body.String(), tc.wantBody) {
+				t.Errorf("expected body to end with %q, got %q", tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestExportStopsOnDisconnect(t *testing.T) {
+	log := zerolog.Nop()
+	e := echo.New()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var emitted int
+	e.GET("/export", func(c echo.Context) error {
+		return Export(c, MIMEApplicationNDJSON, &log, func(ctx context.Context, emit func(exportRow) error) error {
+			for i := 0; ; i++ {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if i == 10 {
+					cancel()
+				}
+				if err := emit(exportRow{ID: i}); err != nil {
+					return err
+				}
+				emitted++
+			}
+		})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/export", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if emitted != 11 {
+		t.Errorf("expected the stream to stop after the disconnect, emitted %d rows", emitted)
+	}
+}
+
+func TestLimitExports(t *testing.T) {
+	e, _ := newTestEcho(t)
+	e.Use(LimitExports(ExportLimitConfig{Routes: []string{"GET /export"}, PerClient: 1, Total: 2, MaxDuration: time.Minute}))
+	started, release := make(chan struct{}), make(chan struct{})
+	e.GET("/export", func(c echo.Context) error {
+		if _, ok := c.Request().Context().Deadline(); !ok {
+			t.Error("expected the export to have a deadline")
+		}
+		started <- struct{}{}
+		<-release
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/other", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	do := func(path, ip string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	var wg sync.WaitGroup
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		wg.Go(func() {
+			if code := do("/export", ip); code != http.StatusOK {
+				t.Errorf("expected the export of %s to pass, got %d", ip, code)
+			}
+		})
+		<-started
+	}
+
+	if code := do("/export", "10.0.0.1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for a second export of the client, got %d", code)
+	}
+	if code := do("/export", "10.0.0.3"); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 beyond the total, got %d", code)
+	}
+	if code := do("/other", "10.0.0.1"); code != http.StatusOK {
+		t.Errorf("expected other routes not to be limited, got %d", code)
+	}
+
+	close(release)
+	wg.Wait()
+	go func() { <-started }()
+	if code := do("/export", "10.0.0.1"); code != http.StatusOK {
+		t.Errorf("expected the export to pass once the others finished, got %d", code)
+	}
+}
+
+func TestQueryTime(t *testing.T) {
+	tests := map[string]struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		"missing":   {query: "", want: "0001-01-01T00:00:00Z"},
+		"date":      {query: "from=2024-02-01", want: "2024-02-01T00:00:00Z"},
+		"timestamp": {query: "from=2024-02-01T10:30:00%2B02:00", want: "2024-02-01T10:30:00+02:00"},
+		"invalid":   {query: "from=February", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/?"+tc.query, nil), httptest.NewRecorder())
+			got, err := QueryTime(c, "from")
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("QueryTime: %v", err)
+			}
+			if got.Format("2006-01-02T15:04:05Z07:00") != tc.want {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
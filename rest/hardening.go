@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// routeKey identifies the matched route as "METHOD /path", the form used for per-route settings.
+func routeKey(c echo.Context) string {
+	return c.Request().Method + " " + routePath(c)
+}
+
+// routePath returns the matched route with escaped colons unescaped, e.g. /product:bulk for a
+// route registered as /product\\:bulk.
+func routePath(c echo.Context) string {
+	return strings.ReplaceAll(c.Path(), "\\:", ":")
+}
+
+// Recover turns panics into errors carrying the stack, so the error handler logs them with an
+// error ID and answers 500.
+func Recover() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+			}()
+			return next(c)
+		}
+	}
+}
+
+// SecureHeaders sets HSTS, CSP, nosniff and frame options on every response. HSTS is only sent
+// on TLS connections.
+func SecureHeaders() echo.MiddlewareFunc {
+	return middleware.SecureWithConfig(middleware.SecureConfig{
+		ContentTypeNosniff:    "nosniff",
+		XFrameOptions:         "DENY",
+		HSTSMaxAge:            31536000,
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+		ReferrerPolicy:        "no-referrer",
+	})
+}
+
+// CORS allows browsers on the listed origins to call the API. Without origins no CORS headers
+// are sent and browsers fall back to the same-origin policy.
+func CORS(allowOrigins []string) echo.MiddlewareFunc {
+	if len(allowOrigins) == 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	}
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:  allowOrigins,
+		AllowMethods:  []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete},
+		AllowHeaders:  []string{echo.HeaderAuthorization, echo.HeaderContentType, echo.HeaderAccept, DefaultTenantHeader},
+		ExposeHeaders: []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", echo.HeaderRetryAfter},
+		MaxAge:        600,
+	})
+}
+
+// BodyLimit rejects request bodies larger than limit (e.g. "1M") with 413. routes overrides the
+// limit per route key like "POST /product".
+func BodyLimit(limit string, routes map[string]string) echo.MiddlewareFunc {
+	defaultLimit := middleware.BodyLimit(limit)
+	routeLimits := make(map[string]echo.MiddlewareFunc, len(routes))
+	for route, l := range routes {
+		routeLimits[route] = middleware.BodyLimit(l)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		limited := defaultLimit(next)
+		routeHandlers := make(map[string]echo.HandlerFunc, len(routeLimits))
+		for route, mw := range routeLimits {
+			routeHandlers[route] = mw(next)
+		}
+		return func(c echo.Context) error {
+			if h, ok := routeHandlers[routeKey(c)]; ok {
+				return h(c)
+			}
+			return limited(c)
+		}
+	}
+}
+
+// Deadline bounds the request context, and with it every database call of the handler, by
+// timeout. routes overrides the timeout per route key, zero disables it for the route.
+func Deadline(timeout time.Duration, routes map[string]time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			d := timeout
+			if override, ok := routes[routeKey(c)]; ok {
+				d = override
+			}
+			if d <= 0 {
+				return next(c)
+			}
+
+			ctx, cancel := context.WithTimeout(c.Request().Context(), d)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func newHardenedEcho(t *testing.T) *echo.Echo {
+	e, _ := newTestEcho(t)
+	e.Use(Recover())
+	e.Use(SecureHeaders())
+	e.Use(CORS([]string{"https://shop.example.com"}))
+	e.Use(BodyLimit("10B", map[string]string{"POST /upload": "1K"}))
+	e.Use(Deadline(time.Second, map[string]time.Duration{"GET /slow": 10 * time.Millisecond}))
+
+	e.GET("/panic", func(c echo.Context) error { panic("boom") })
+	e.POST("/small", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+	e.POST("/upload", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+	e.GET("/slow", func(c echo.Context) error {
+		<-c.Request().Context().Done()
+		return c.Request().Context().Err()
+	})
+	e.GET("/deadline", func(c echo.Context) error {
+		deadline, ok := c.Request().Context().Deadline()
+		if !ok || time.Until(deadline) > time.Second {
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+	return e
+}
+
+func TestHardening(t *testing.T) {
+	e := newHardenedEcho(t)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("panic yields 500 with error id", func(t *testing.T) {
+		rec := serve(httptest.NewRequest(http.MethodGet, "/panic", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected 500, got %d", rec.Code)
+		}
+		var body ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode body: %v", err)
+		}
+		if body.ErrorID == "" || strings.Contains(body.Error, "boom") {
+			t.Errorf("Expected an error id and no panic details, got %+v", body)
+		}
+	})
+
+	t.Run("security headers", func(t *testing.T) {
+		rec := serve(httptest.NewRequest(http.MethodGet, "/deadline", nil))
+		if rec.Header().Get("X-Content-Type-Options") != "nosniff" || rec.Header().Get("Content-Security-Policy") == "" {
+			t.Errorf("Missing security headers: %v", rec.Header())
+		}
+	})
+
+	t.Run("CORS allowlist", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/small", nil)
+		req.Header.Set(echo.HeaderOrigin, "https://shop.example.com")
+		req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+		if rec := serve(req); rec.Header().Get(echo.HeaderAccessControlAllowOrigin) != "https://shop.example.com" {
+			t.Errorf("Expected allowed origin, got %v", rec.Header())
+		}
+
+		req = httptest.NewRequest(http.MethodOptions, "/small", nil)
+		req.Header.Set(echo.HeaderOrigin, "https://evil.example.com")
+		req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+		if rec := serve(req); rec.Header().Get(echo.HeaderAccessControlAllowOrigin) != "" {
+			t.Errorf("Expected no CORS headers for unknown origin, got %v", rec.Header())
+		}
+	})
+
+	t.Run("body limit per route", func(t *testing.T) {
+		body := strings.Repeat("x", 100)
+		if rec := serve(httptest.NewRequest(http.MethodPost, "/small", strings.NewReader(body))); rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected 413 on default limit, got %d", rec.Code)
+		}
+		if rec := serve(httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(body))); rec.Code != http.StatusNoContent {
+			t.Errorf("Expected route override to accept body, got %d", rec.Code)
+		}
+	})
+
+	t.Run("handler deadline", func(t *testing.T) {
+		if rec := serve(httptest.NewRequest(http.MethodGet, "/deadline", nil)); rec.Code != http.StatusNoContent {
+			t.Errorf("Expected deadline on request context, got %d", rec.Code)
+		}
+		rec := serve(httptest.NewRequest(http.MethodGet, "/slow", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 on route deadline, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,527 @@
+package rest
+
+import (
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MIMETextCSV is rendered for collections only.
+const MIMETextCSV = "text/csv"
+
+// mediaTypes maps the accepted spellings of a media type to the one that is rendered.
+var mediaTypes = map[string]string{
+	echo.MIMEApplicationJSON:    echo.MIMEApplicationJSON,
+	echo.MIMEApplicationXML:     echo.MIMEApplicationXML,
+	echo.MIMETextXML:            echo.MIMEApplicationXML,
+	MIMETextCSV:                 MIMETextCSV,
+	echo.MIMEApplicationMsgpack: echo.MIMEApplicationMsgpack,
+	"application/x-msgpack":     echo.MIMEApplicationMsgpack,
+	"application/vnd.msgpack":   echo.MIMEApplicationMsgpack,
+}
+
+// offered lists the rendered media types in order of preference for wildcards.
+var offered = []string{echo.MIMEApplicationJSON, echo.MIMEApplicationXML, echo.MIMEApplicationMsgpack, MIMETextCSV}
+
+// Respond renders v in the media type the client asks for with its Accept header. JSON is the
+// default, CSV is only offered for collections. Unsupported types yield a 406.
+func Respond(c echo.Context, code int, v any) error {
+	collection := isCollection(v)
+	mediaType, ok := negotiate(c.Request().Header.Get(echo.HeaderAccept), collection)
+	if !ok {
+		supported := "application/json, application/xml, application/msgpack"
+		if collection {
+			supported += ", text/csv"
+		}
+		return echo.NewHTTPError(http.StatusNotAcceptable, "Not acceptable, supported media types: "+supported)
+	}
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+
+	switch mediaType {
+	case echo.MIMEApplicationXML:
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationXMLCharsetUTF8)
+		c.Response().WriteHeader(code)
+		return encodeXML(c.Response(), v)
+	case echo.MIMEApplicationMsgpack:
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationMsgpack)
+		c.Response().WriteHeader(code)
+		enc := msgpack.NewEncoder(c.Response())
+		enc.SetCustomStructTag("json")
+		return enc.Encode(v)
+	case MIMETextCSV:
+		c.Response().Header().Set(echo.HeaderContentType, MIMETextCSV+"; charset=UTF-8")
+		c.Response().WriteHeader(code)
+		return encodeCSV(c.Response(), v)
+	default:
+		return c.JSON(code, v)
+	}
+}
+
+// Bind decodes the request body into v according to its Content-Type. A missing Content-Type is
+// read as JSON, CSV bodies need a slice. Unsupported types yield a 415, undecodable bodies a 400.
+func Bind(c echo.Context, v any) error {
+	req := c.Request()
+	if req.ContentLength == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: empty body")
+	}
+
+	mediaType := echo.MIMEApplicationJSON
+	if ct := req.Header.Get(echo.HeaderContentType); ct != "" {
+		parsed, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Unsupported media type "+ct)
+		}
+		mediaType = mediaTypes[parsed]
+	}
+
+	var err error
+	switch mediaType {
+	case echo.MIMEApplicationJSON:
+		err = json.NewDecoder(req.Body).Decode(v)
+	case echo.MIMEApplicationXML:
+		err = decodeXML(req.Body, v)
+	case echo.MIMEApplicationMsgpack:
+		dec := msgpack.NewDecoder(req.Body)
+		dec.SetCustomStructTag("json")
+		err = dec.Decode(v)
+	case MIMETextCSV:
+		if !isCollection(v) {
+			return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Unsupported media type text/csv, CSV is only accepted for collections")
+		}
+		err = decodeCSV(req.Body, v)
+	default:
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "Unsupported media type "+req.Header.Get(echo.HeaderContentType))
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error()).SetInternal(err)
+	}
+	return nil
+}
+
+// IsJSON reports whether a Content-Type header denotes JSON, an empty header counts as JSON.
+func IsJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == echo.MIMEApplicationJSON
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// acceptRanges parses an Accept header into its media ranges ordered by quality, ranges with a
+// quality of 0 are dropped.
+func acceptRanges(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	return ranges
+}
+
+// negotiate picks the media type to render for an Accept header.
+func negotiate(accept string, collection bool) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return echo.MIMEApplicationJSON, true
+	}
+
+	for _, r := range acceptRanges(accept) {
+		if mediaType, ok := mediaTypes[r.mediaType]; ok {
+			if mediaType == MIMETextCSV && !collection {
+				continue
+			}
+			return mediaType, true
+		}
+		for _, mediaType := range offered {
+			if mediaType == MIMETextCSV && !collection {
+				continue
+			}
+			if r.mediaType == "*/*" || strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(r.mediaType, "*")) {
+				return mediaType, true
+			}
+		}
+	}
+	return "", false
+}
+
+func isCollection(v any) bool {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+// elementName derives an XML element name from a Go type, e.g. OrderItem becomes orderItem.
+func elementName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	name := t.Name()
+	if name == "" {
+		return "item"
+	}
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
+
+// encodeXML writes single values as <product>…</product> and collections as
+// <items><product>…</product>…</items>.
+func encodeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if !isCollection(v) {
+		if err := enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: elementName(value.Type())}}); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	root := xml.StartElement{Name: xml.Name{Local: "items"}}
+	if err := enc.EncodeToken(root); err != nil {
+		return err
+	}
+	item := xml.StartElement{Name: xml.Name{Local: elementName(value.Type())}}
+	for i := 0; i < value.Len(); i++ {
+		if err := enc.EncodeElement(value.Index(i).Interface(), item); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeToken(root.End()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// decodeXML reads the layout written by encodeXML.
+func decodeXML(r io.Reader, v any) error {
+	dec := xml.NewDecoder(r)
+	if !isCollection(v) {
+		return dec.Decode(v)
+	}
+
+	slice := reflect.ValueOf(v).Elem()
+	depth := 0
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				depth++
+				continue
+			}
+			item := reflect.New(slice.Type().Elem())
+			if err := dec.DecodeElement(item.Interface(), &t); err != nil {
+				return err
+			}
+			slice.Set(reflect.Append(slice, item.Elem()))
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// csvColumn is a field of a struct that can be written to a CSV cell.
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+var textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+
+// csvColumns returns the scalar fields of a struct named by their JSON tags, nested collections
+// and structs are left out.
+func csvColumns(t reflect.Type) []csvColumn {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return []csvColumn{{name: "value"}}
+	}
+
+	var columns []csvColumn
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if !csvScalar(f.Type) {
+			continue
+		}
+		columns = append(columns, csvColumn{name: name, index: f.Index})
+	}
+	return columns
+}
+
+func csvScalar(t reflect.Type) bool {
+	if t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return csvScalar(t.Elem())
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// encodeCSV writes a header row followed by a row per element.
+func encodeCSV(w io.Writer, v any) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	enc, err := newCSVEncoder(w, value.Type().Elem())
+	if err != nil {
+		return err
+	}
+	for i := 0; i < value.Len(); i++ {
+		if err := enc.encode(value.Index(i)); err != nil {
+			return err
+		}
+	}
+	return enc.flush()
+}
+
+// csvEncoder writes values of a single type as CSV rows.
+type csvEncoder struct {
+	cw      *csv.Writer
+	columns []csvColumn
+	row     []string
+}
+
+// newCSVEncoder writes the header row for the columns of t.
+func newCSVEncoder(w io.Writer, t reflect.Type) (*csvEncoder, error) {
+	enc := &csvEncoder{cw: csv.NewWriter(w), columns: csvColumns(t)}
+	header := make([]string, len(enc.columns))
+	for i, col := range enc.columns {
+		header[i] = col.name
+	}
+	enc.row = make([]string, len(enc.columns))
+	return enc, enc.cw.Write(header)
+}
+
+func (e *csvEncoder) encode(v reflect.Value) error {
+	item := reflect.Indirect(v)
+	for j, col := range e.columns {
+		field := item
+		if col.index != nil {
+			var err error
+			if field, err = item.FieldByIndexErr(col.index); err != nil {
+				e.row[j] = ""
+				continue
+			}
+		}
+		cell, err := formatCell(field)
+		if err != nil {
+			return err
+		}
+		e.row[j] = cell
+	}
+	return e.cw.Write(e.row)
+}
+
+func (e *csvEncoder) flush() error {
+	e.cw.Flush()
+	return e.cw.Error()
+}
+
+func formatCell(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		return escapeFormula(string(text)), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return escapeFormula(v.String()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	case reflect.Slice:
+		values := make([]string, v.Len())
+		for i := range values {
+			values[i] = v.Index(i).String()
+		}
+		return escapeFormula(strings.Join(values, ";")), nil
+	}
+	return "", fmt.Errorf("csv: unsupported type %s", v.Type())
+}
+
+// formulaPrefixes start cells that spreadsheets evaluate as formulas.
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeFormula prefixes text that starts like a formula with ', so spreadsheets opening an export
+// show it as text instead of evaluating it (CSV injection). Numbers are formatted without it.
+func escapeFormula(s string) string {
+	if s != "" && strings.IndexByte(formulaPrefixes, s[0]) >= 0 {
+		return "'" + s
+	}
+	return s
+}
+
+// unescapeFormula reverses escapeFormula, so exports can be imported again.
+func unescapeFormula(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.IndexByte(formulaPrefixes, s[1]) >= 0 {
+		return s[1:]
+	}
+	return s
+}
+
+// decodeCSV reads a header row and a row per element into a slice of structs, the columns are
+// matched by the JSON names of the fields.
+func decodeCSV(r io.Reader, v any) error {
+	slice := reflect.ValueOf(v).Elem()
+	elemType := slice.Type().Elem()
+	columns := map[string]csvColumn{}
+	for _, col := range csvColumns(elemType) {
+		columns[col.name] = col
+	}
+
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	for _, name := range header {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("csv: unknown column %q", name)
+		}
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		item := reflect.New(elemType).Elem()
+		for i, cell := range record {
+			col := columns[header[i]]
+			field := item
+			if col.index != nil {
+				if field, err = item.FieldByIndexErr(col.index); err != nil {
+					return err
+				}
+			}
+			if err := parseCell(field, cell); err != nil {
+				return fmt.Errorf("csv: line %d, column %q: %w", slice.Len()+2, header[i], err)
+			}
+		}
+		slice.Set(reflect.Append(slice, item))
+	}
+}
+
+func parseCell(v reflect.Value, cell string) error {
+	cell = unescapeFormula(cell)
+	if v.Kind() == reflect.Pointer {
+		if cell == "" {
+			return nil
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(cell))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(cell)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(cell, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(cell, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(cell, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if cell == "" {
+			return nil
+		}
+		parts := strings.Split(cell, ";")
+		values := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			values.Index(i).SetString(part)
+		}
+		v.Set(values)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
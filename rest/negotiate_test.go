@@ -0,0 +1,160 @@
+package rest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type testItem struct {
+	ID      int        `json:"id" xml:"id"`
+	Name    string     `json:"name" xml:"name"`
+	Price   float64    `json:"price" xml:"price"`
+	Tags    []string   `json:"tags" xml:"tags>tag"`
+	Created *time.Time `json:"created,omitempty" xml:"created,omitempty"`
+	Nested  []testItem `json:"nested,omitempty" xml:"nested,omitempty"`
+}
+
+func TestRespond(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	item := testItem{ID: 1, Name: "Desk, oak", Price: 99.5, Tags: []string{"a", "b"}, Created: &created}
+	items := []testItem{item, {ID: 2, Name: "Chair", Price: 20}}
+
+	tests := map[string]struct {
+		accept          string
+		value           any
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		"default json":          {value: item, wantCode: http.StatusOK, wantContentType: echo.MIMEApplicationJSON, wantBody: `"name":"Desk, oak"`},
+		"xml":                   {accept: "application/xml", value: item, wantCode: http.StatusOK, wantContentType: echo.MIMEApplicationXML, wantBody: "<testItem><id>1</id><name>Desk, oak</name><price>99.5</price><tags><tag>a</tag><tag>b</tag></tags>"},
+		"xml collection":        {accept: "text/xml", value: items, wantCode: http.StatusOK, wantContentType: echo.MIMEApplicationXML, wantBody: "<items><testItem><id>1</id>"},
+		"csv collection":        {accept: "text/csv", value: items, wantCode: http.StatusOK, wantContentType: MIMETextCSV, wantBody: "id,name,price,tags,created\n1,\"Desk, oak\",99.5,a;b,2024-05-01T12:00:00Z\n2,Chair,20,,\n"},
+		"csv formula":           {accept: "text/csv", value: []testItem{{ID: -1, Name: "=HYPERLINK(\"x\")", Price: -2.5, Tags: []string{"@a"}}}, wantCode: http.StatusOK, wantContentType: MIMETextCSV, wantBody: "id,name,price,tags,created\n-1,\"'=HYPERLINK(\"\"x\"\")\",-2.5,'@a,\n"},
+		"csv single value":      {accept: "text/csv", value: item, wantCode: http.StatusNotAcceptable},
+		"csv falls back":        {accept: "text/csv, application/json;q=0.5", value: item, wantCode: http.StatusOK, wantContentType: echo.MIMEApplicationJSON},
+		"quality order":         {accept: "application/json;q=0.1, application/xml", value: item, wantCode: http.StatusOK, wantContentType: echo.MIMEApplicationXML},
+		"wildcard":              {accept: "*/*", value: item, wantCode: http.StatusOK, wantContentType: echo.MIMEApplicationJSON},
+		"text wildcard":         {accept: "text/*", value: items, wantCode: http.StatusOK, wantContentType: MIMETextCSV},
+		"unsupported":           {accept: "application/pdf", value: item, wantCode: http.StatusNotAcceptable},
+		"excluded by quality 0": {accept: "application/json;q=0", value: item, wantCode: http.StatusNotAcceptable},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.accept != "" {
+				req.Header.Set(echo.HeaderAccept, tc.accept)
+			}
+			rec := httptest.NewRecorder()
+			err := Respond(e.NewContext(req, rec), http.StatusOK, tc.value)
+			if err != nil {
+				e.DefaultHTTPErrorHandler(err, e.NewContext(req, rec))
+			}
+
+			if rec.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tc.wantCode, rec.Code, rec.Body.String())
+			}
+			if tc.wantContentType != "" && !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), tc.wantContentType) {
+				t.Errorf("expected content type %s, got %s", tc.wantContentType, rec.Header().Get(echo.HeaderContentType))
+			}
+			if !strings.Contains(rec.Body.String(), tc.wantBody) {
+				t.Errorf("expected body to contain %q, got %q", tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRespondMsgpack(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAccept, "application/x-msgpack")
+	rec := httptest.NewRecorder()
+	if err := Respond(e.NewContext(req, rec), http.StatusOK, testItem{ID: 7, Name: "Lamp"}); err != nil {
+		t.Fatalf("Respond: %v", err)
+	}
+
+	var got map[string]any
+	if err := msgpack.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got["name"] != "Lamp" {
+		t.Errorf("expected the JSON field names, got %v", got)
+	}
+}
+
+func TestBind(t *testing.T) {
+	packed, err := msgpack.Marshal(map[string]any{"id": 3, "name": "Shelf", "price": 45.0})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	tests := map[string]struct {
+		contentType string
+		body        []byte
+		collection  bool
+		wantCode    int
+		wantNames   []string
+	}{
+		"json":                {contentType: "application/json; charset=UTF-8", body: []byte(`{"id":1,"name":"Desk"}`), wantNames: []string{"Desk"}},
+		"no content type":     {body: []byte(`{"id":1,"name":"Desk"}`), wantNames: []string{"Desk"}},
+		"xml":                 {contentType: "application/xml", body: []byte(`<product><id>1</id><name>Desk</name><tags><tag>a</tag></tags></product>`), wantNames: []string{"Desk"}},
+		"xml collection":      {contentType: "text/xml", body: []byte(`<items><product><name>Desk</name></product><product><name>Chair</name></product></items>`), collection: true, wantNames: []string{"Desk", "Chair"}},
+		"msgpack":             {contentType: "application/msgpack", body: packed, wantNames: []string{"Shelf"}},
+		"csv collection":      {contentType: "text/csv", body: []byte("name,price,tags\nDesk,10,a;b\nChair,5,\n"), collection: true, wantNames: []string{"Desk", "Chair"}},
+		"csv escaped formula": {contentType: "text/csv", body: []byte("name\n'=1+2\n"), collection: true, wantNames: []string{"=1+2"}},
+		"csv single value":    {contentType: "text/csv", body: []byte("name\nDesk\n"), wantCode: http.StatusUnsupportedMediaType},
+		"csv bad column":      {contentType: "text/csv", body: []byte("color\nred\n"), collection: true, wantCode: http.StatusBadRequest},
+		"csv bad number":      {contentType: "text/csv", body: []byte("price\ncheap\n"), collection: true, wantCode: http.StatusBadRequest},
+		"unsupported":         {contentType: "application/pdf", body: []byte("%PDF"), wantCode: http.StatusUnsupportedMediaType},
+		"malformed json":      {contentType: "application/json", body: []byte(`{"id":`), wantCode: http.StatusBadRequest},
+		"empty body":          {contentType: "application/json", wantCode: http.StatusBadRequest},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, tc.contentType)
+			}
+			c := e.NewContext(req, httptest.NewRecorder())
+
+			var got []testItem
+			if tc.collection {
+				err = Bind(c, &got)
+			} else {
+				var item testItem
+				err = Bind(c, &item)
+				got = append(got, item)
+			}
+
+			if tc.wantCode != 0 {
+				he, ok := err.(*echo.HTTPError)
+				if !ok || he.Code != tc.wantCode {
+					t.Fatalf("expected status %d, got %v", tc.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Bind: %v", err)
+			}
+			if len(got) != len(tc.wantNames) {
+				t.Fatalf("expected %d items, got %+v", len(tc.wantNames), got)
+			}
+			for i, name := range tc.wantNames {
+				if got[i].Name != name {
+					t.Errorf("item %d: expected name %s, got %+v", i, name, got[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+// OpenAPIConfig configures validation of requests and responses against an OpenAPI document.
+type OpenAPIConfig struct {
+	// SpecFile is the path of the OpenAPI 3 document (YAML or JSON).
+	SpecFile string
+	// ValidateResponses additionally checks every response against the declared schema and
+	// replaces non-conforming responses by a 500. Meant for tests, as responses are buffered.
+	// Streamed responses (events, NDJSON and CSV) pass through unchecked.
+	ValidateResponses bool
+}
+
+// OpenAPIValidator validates requests and responses of the routes described by an OpenAPI document.
+// Routes that are not part of the document pass through unchecked.
+type OpenAPIValidator struct {
+	doc               *openapi3.T
+	validateResponses bool
+	options           *openapi3filter.Options
+	log               *zerolog.Logger
+}
+
+// NewOpenAPIValidator loads and validates the document referenced by the config.
+func NewOpenAPIValidator(cfg OpenAPIConfig, log *zerolog.Logger) (*OpenAPIValidator, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromFile(cfg.SpecFile)
+	if err != nil {
+		return nil, fmt.Errorf("load openapi document %s: %w", cfg.SpecFile, err)
+	}
+
+	return newOpenAPIValidator(doc, cfg.ValidateResponses, log)
+}
+
+// defineFormats registers the string formats used by the documents. kin-openapi does not pass
+// document-scoped format validators on to parameter validation, so they are defined globally.
+var defineFormats = sync.OnceFunc(func() {
+	openapi3.DefineStringFormatValidator("uuid", openapi3.NewRegexpFormatValidator(openapi3.FormatOfStringForUUIDOfRFC4122))
+	openapi3.DefineStringFormatValidator("email", openapi3.NewRegexpFormatValidator(openapi3.FormatOfStringForEmail))
+})
+
+func newOpenAPIValidator(doc *openapi3.T, validateResponses bool, log *zerolog.Logger) (*OpenAPIValidator, error) {
+	defineFormats()
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+
+	return &OpenAPIValidator{
+		doc:               doc,
+		validateResponses: validateResponses,
+		log:               log,
+		options: &openapi3filter.Options{
+			MultiError:         false,
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}, nil
+}
+
+// Middleware returns the echo middleware performing the validation. It relies on echo's routing,
+// so it has to be registered with e.Use and not with e.Pre.
+func (v *OpenAPIValidator) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			input, ok := v.requestInput(c)
+			if !ok {
+				return next(c)
+			}
+
+			if err := openapi3filter.ValidateRequest(c.Request().Context(), input); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, requestErrorMessage(err)).SetInternal(err)
+			}
+
+			if !v.validateResponses {
+				return next(c)
+			}
+
+			return v.validateResponse(c, input, next)
+		}
+	}
+}
+
+// requestInput resolves the operation of the matched echo route in the OpenAPI document.
+func (v *OpenAPIValidator) requestInput(c echo.Context) (*openapi3filter.RequestValidationInput, bool) {
+	path := openAPIPath(routePath(c))
+	pathItem := v.doc.Paths.Find(path)
+	if pathItem == nil {
+		return nil, false
+	}
+	method := c.Request().Method
+	operation := pathItem.GetOperation(method)
+	if operation == nil {
+		return nil, false
+	}
+
+	options := v.options
+	if !IsJSON(c.Request().Header.Get(echo.HeaderContentType)) {
+		// the document describes JSON bodies, other media types are checked by Bind
+		options = &openapi3filter.Options{}
+		*options = *v.options
+		options.ExcludeRequestBody = true
+	}
+
+	params := make(map[string]string, len(c.ParamNames()))
+	for i, name := range c.ParamNames() {
+		params[name] = c.ParamValues()[i]
+	}
+
+	return &openapi3filter.RequestValidationInput{
+		Request:    c.Request(),
+		PathParams: params,
+		Route: &routers.Route{
+			Spec:      v.doc,
+			Path:      path,
+			PathItem:  pathItem,
+			Method:    method,
+			Operation: operation,
+		},
+		Options: options,
+	}, true
+}
+
+func (v *OpenAPIValidator) validateResponse(c echo.Context, input *openapi3filter.RequestValidationInput, next echo.HandlerFunc) error {
+	res := c.Response()
+	original := res.Writer
+	recorder := &responseRecorder{ResponseWriter: original}
+	res.Writer = recorder
+
+	err := next(c)
+	res.Writer = original
+	if !recorder.wroteHeader || recorder.streaming {
+		return err
+	}
+	if err != nil {
+		return errors.Join(err, recorder.writeTo(original))
+	}
+
+	options := v.options
+	if !IsJSON(original.Header().Get(echo.HeaderContentType)) {
+		// only the JSON rendering is described by the document
+		options = &openapi3filter.Options{}
+		*options = *v.options
+		options.ExcludeResponseBody = true
+	}
+	responseInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 recorder.status,
+		Header:                 original.Header(),
+		Options:                options,
+	}
+	responseInput.SetBodyBytes(recorder.body.Bytes())
+	verr := openapi3filter.ValidateResponse(c.Request().Context(), responseInput)
+	if verr == nil {
+		return recorder.writeTo(original)
+	}
+
+	response := ErrorResponse{Error: "Response does not match the API contract", ErrorID: uuid.NewString()}
+	v.log.Error().Err(verr).Str("error_id", response.ErrorID).Str("method", input.Route.Method).
+		Str("path", input.Route.Path).Int("status", recorder.status).Msg("Response does not match the OpenAPI document")
+
+	// the handler already committed the echo response, so the replacement is written directly
+	original.Header().Del(echo.HeaderContentLength)
+	original.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	original.WriteHeader(http.StatusInternalServerError)
+	res.Status = http.StatusInternalServerError
+	return json.NewEncoder(original).Encode(response)
+}
+
+// openAPIPath converts an echo route like /customer/:id into the OpenAPI form /customer/{id}.
+func openAPIPath(echoPath string) string {
+	segments := strings.Split(echoPath, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + strings.TrimPrefix(s, ":") + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func requestErrorMessage(err error) string {
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) {
+		if reqErr.Parameter != nil {
+			return fmt.Sprintf("Invalid %s parameter %q: %s", reqErr.Parameter.In, reqErr.Parameter.Name, reasonOf(reqErr))
+		}
+		if reqErr.RequestBody != nil {
+			return "Invalid request body: " + reasonOf(reqErr)
+		}
+	}
+	return "Invalid request: " + err.Error()
+}
+
+func reasonOf(reqErr *openapi3filter.RequestError) string {
+	var schemaErr *openapi3.SchemaError
+	if errors.As(reqErr.Err, &schemaErr) {
+		if path := schemaErr.JSONPointer(); len(path) > 0 {
+			return fmt.Sprintf("%s: %s", strings.Join(path, "."), schemaErr.Reason)
+		}
+		return schemaErr.Reason
+	}
+	if reqErr.Err != nil {
+		return reqErr.Err.Error()
+	}
+	return reqErr.Reason
+}
+
+// responseRecorder buffers a response so it can be validated before it is sent. Streamed
+// responses are passed through as they are written, see isStreamed.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	streaming   bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.status = status
+	r.wroteHeader = true
+	if isStreamed(r.Header().Get(echo.HeaderContentType)) {
+		r.streaming = true
+		r.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.streaming {
+		return r.ResponseWriter.Write(b)
+	}
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) writeTo(w http.ResponseWriter) error {
+	w.WriteHeader(r.status)
+	_, err := w.Write(r.body.Bytes())
+	return err
+}
+
+// Flush passes streamed responses on, a buffered response is written once the handler returns.
+func (r *responseRecorder) Flush() {
+	if r.streaming {
+		_ = http.NewResponseController(r.ResponseWriter).Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer, e.g. to extend the write
+// deadline of a stream.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// isStreamed reports whether responses of the media type are streamed: server-sent events,
+// NDJSON and CSV exports. They are written while they are produced and can't be buffered.
+func isStreamed(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case MIMETextEventStream, MIMEApplicationNDJSON, MIMETextCSV:
+		return true
+	}
+	return false
+}
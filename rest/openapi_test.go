@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func newValidatedEcho(t *testing.T, validateResponses bool) *echo.Echo {
+	e, log := newTestEcho(t)
+	validator, err := NewOpenAPIValidator(OpenAPIConfig{SpecFile: "../api/openapi.yaml", ValidateResponses: validateResponses}, log)
+	if err != nil {
+		t.Fatalf("Failed to load OpenAPI document: %v", err)
+	}
+	e.Use(validator.Middleware())
+
+	e.POST("/customer", func(c echo.Context) error {
+		return c.JSON(http.StatusCreated, map[string]any{
+			"id": "6f1c1c59-6a59-4b51-9e36-0f0f3c4b1a10", "name": "Bob", "email": "bob@example.com",
+		})
+	})
+	e.GET("/customer/:id", func(c echo.Context) error {
+		// drifts from the contract: email is missing
+		return c.JSON(http.StatusOK, map[string]any{"id": c.Param("id"), "name": "Bob"})
+	})
+	e.GET("/order/events", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, MIMETextEventStream)
+		c.Response().WriteHeader(http.StatusOK)
+		if _, err := c.Response().Write([]byte("id: 1\ndata: {}\n\n")); err != nil {
+			return err
+		}
+		c.Response().Flush()
+		return nil
+	})
+	e.GET("/unspecified", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+	return e
+}
+
+func TestOpenAPIValidator(t *testing.T) {
+	tests := map[string]struct {
+		validateResponses bool
+		method            string
+		path              string
+		body              string
+		contentType       string
+		expectedCode      int
+		expectedBody      string
+		expectedFlush     bool
+	}{
+		"valid request": {
+			method: http.MethodPost, path: "/customer", body: `{"name":"Bob","email":"bob@example.com"}`,
+			expectedCode: http.StatusCreated,
+		},
+		"missing body property": {
+			method: http.MethodPost, path: "/customer", body: `{"name":"Bob"}`,
+			expectedCode: http.StatusBadRequest, expectedBody: `Invalid request body`,
+		},
+		"invalid email": {
+			method: http.MethodPost, path: "/customer", body: `{"name":"Bob","email":"bob"}`,
+			expectedCode: http.StatusBadRequest, expectedBody: `email`,
+		},
+		"invalid uuid path parameter": {
+			method: http.MethodGet, path: "/customer/not-a-uuid",
+			expectedCode: http.StatusBadRequest, expectedBody: `Invalid path parameter \"id\"`,
+		},
+		"response drift ignored outside test mode": {
+			method: http.MethodGet, path: "/customer/6f1c1c59-6a59-4b51-9e36-0f0f3c4b1a10",
+			expectedCode: http.StatusOK,
+		},
+		"response drift fails in test mode": {
+			validateResponses: true,
+			method:            http.MethodGet, path: "/customer/6f1c1c59-6a59-4b51-9e36-0f0f3c4b1a10",
+			expectedCode: http.StatusInternalServerError, expectedBody: `"error_id":`,
+		},
+		"valid response passes in test mode": {
+			validateResponses: true,
+			method:            http.MethodPost, path: "/customer", body: `{"name":"Bob","email":"bob@example.com"}`,
+			expectedCode: http.StatusCreated, expectedBody: `"email":"bob@example.com"`,
+		},
+		"non-JSON body is left to the handler": {
+			validateResponses: true,
+			method:            http.MethodPost, path: "/customer", body: `<customer><name>Bob</name></customer>`,
+			contentType:  echo.MIMEApplicationXML,
+			expectedCode: http.StatusCreated,
+		},
+		"streamed response passes through in test mode": {
+			validateResponses: true,
+			method:            http.MethodGet, path: "/order/events",
+			expectedCode: http.StatusOK, expectedBody: "id: 1\n",
+			expectedFlush: true,
+		},
+		"route outside the document": {
+			validateResponses: true,
+			method:            http.MethodGet, path: "/unspecified",
+			expectedCode: http.StatusOK, expectedBody: "ok",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := newValidatedEcho(t, tt.validateResponses)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, tt.contentType)
+			} else if tt.body != "" {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedCode, rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %s, got %s", tt.expectedBody, rec.Body.String())
+			}
+			if tt.expectedFlush && !rec.Flushed {
+				t.Error("Expected the response to be flushed")
+			}
+		})
+	}
+}
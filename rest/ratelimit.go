@@ -0,0 +1,231 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+// Limit is a token bucket refilled with Rate tokens per second up to Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitResult is the outcome of taking a token from a bucket.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token is available when not allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the token buckets.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit Limit) (RateLimitResult, error)
+}
+
+// RateLimitConfig configures the rate limiter.
+type RateLimitConfig struct {
+	Default Limit
+	// Routes overrides the default per route, keyed by "METHOD /path" as registered, e.g. "POST /order".
+	// Routes with an override have a bucket of their own.
+	Routes map[string]Limit
+	// IP limits every client IP ahead of authentication, see RateLimitIP. A zero rate disables it.
+	IP    Limit
+	Store RateLimitStore
+}
+
+// RateLimit returns middleware enforcing token bucket limits per client identity: the API key or
+// user of the authenticated caller, the client IP otherwise. It has to run after Authenticate.
+func RateLimit(cfg RateLimitConfig, log *zerolog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			route := routeKey(c)
+			limit, ok := cfg.Routes[route]
+			if !ok {
+				route = "*"
+				limit = cfg.Default
+			}
+			if limit.Rate <= 0 {
+				return next(c)
+			}
+
+			if err := take(c, cfg.Store, route+"|"+clientIdentity(c), limit, log); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// RateLimitIP returns middleware enforcing cfg.IP per client IP. It runs before Authenticate, so
+// callers are throttled before their credentials are checked: invalid API keys and tokens don't
+// reach the database unlimited.
+func RateLimitIP(cfg RateLimitConfig, log *zerolog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if cfg.IP.Rate <= 0 {
+				return next(c)
+			}
+			if err := take(c, cfg.Store, "ip|"+c.RealIP(), cfg.IP, log); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// take takes a token from the bucket of key and sets the rate limit headers. It returns a 429
+// error if the bucket is empty.
+func take(c echo.Context, store RateLimitStore, key string, limit Limit, log *zerolog.Logger) error {
+	result, err := store.Take(c.Request().Context(), key, limit)
+	if err != nil {
+		// fail open, an unavailable store must not take the API down
+		log.Error().Err(err).Str("key", key).Msg("Rate limit store failed")
+		return nil
+	}
+
+	header := c.Response().Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, ceilSeconds(time.Duration(float64(limit.Burst)/limit.Rate*float64(time.Second)))))
+
+	if !result.Allowed {
+		header.Set(echo.HeaderRetryAfter, strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		return echo.NewHTTPError(http.StatusTooManyRequests, "Rate limit exceeded")
+	}
+	return nil
+}
+
+func clientIdentity(c echo.Context) string {
+	if claims, ok := ClaimsFrom(c); ok && claims.Subject != "" {
+		if strings.HasPrefix(claims.Subject, "apikey:") {
+			return claims.Subject
+		}
+		return "user:" + claims.Subject
+	}
+	return "ip:" + c.RealIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ParseRouteLimits parses overrides like "POST /order=5:10,GET /product/:id=50:100", where each
+// limit is rate per second and burst.
+func ParseRouteLimits(s string) (map[string]Limit, error) {
+	limits := map[string]Limit{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid route limit %q", entry)
+		}
+		limit, err := ParseLimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route limit %q: %w", entry, err)
+		}
+		limits[strings.TrimSpace(route)] = limit
+	}
+	return limits, nil
+}
+
+// ParseLimit parses "rate:burst", e.g. "5:10".
+func ParseLimit(s string) (Limit, error) {
+	rate, burst, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return Limit{}, fmt.Errorf("expected rate:burst, got %q", s)
+	}
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil {
+		return Limit{}, err
+	}
+	b, err := strconv.Atoi(burst)
+	if err != nil {
+		return Limit{}, err
+	}
+	if r <= 0 || b < 1 {
+		return Limit{}, fmt.Errorf("rate and burst must be positive, got %q", s)
+	}
+	return Limit{Rate: r, Burst: b}, nil
+}
+
+// result derives the headers of a bucket holding tokens after a take.
+func (l Limit) result(tokens float64, allowed bool) RateLimitResult {
+	res := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     time.Duration((float64(l.Burst) - tokens) / l.Rate * float64(time.Second)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+	}
+	return res
+}
+
+// MemoryRateLimitStore keeps the buckets in memory, suitable for a single instance.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit Limit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return limit.result(b.tokens, false), nil
+	}
+	b.tokens--
+	return limit.result(b.tokens, true), nil
+}
+
+// sweep drops buckets idle for more than an hour to bound memory.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > time.Hour {
+			delete(s.buckets, key)
+		}
+	}
+}
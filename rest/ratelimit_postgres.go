@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"context"
+	"time"
+
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/rs/zerolog"
+)
+
+// PostgresRateLimitStore keeps the buckets in Postgres so all replicas share them. Each take is a
+// single atomic upsert using the database clock.
+type PostgresRateLimitStore struct {
+	db *postgres.Db
+}
+
+func NewPostgresRateLimitStore(db *postgres.Db) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db}
+}
+
+const takeTokenQuery = `
+insert into rate_limit_buckets as b (key, tokens, allowed, updated_at)
+values ($1, $2 - 1, true, now())
+on conflict (key) do update set
+	allowed = least($2, b.tokens + extract(epoch from now() - b.updated_at) * $3) >= 1,
+	tokens = least($2, b.tokens + extract(epoch from now() - b.updated_at) * $3)
+		- case when least($2, b.tokens + extract(epoch from now() - b.updated_at) * $3) >= 1 then 1 else 0 end,
+	updated_at = now()
+returning tokens, allowed;`
+
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, limit Limit) (RateLimitResult, error) {
+	var tokens float64
+	var allowed bool
+	err := s.db.GetDB().QueryRowContext(ctx, takeTokenQuery, key, limit.Burst, limit.Rate).Scan(&tokens, &allowed)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return limit.result(tokens, allowed), nil
+}
+
+// Cleanup removes buckets idle for longer than idle.
+func (s *PostgresRateLimitStore) Cleanup(ctx context.Context, idle time.Duration) error {
+	_, err := s.db.GetDB().ExecContext(ctx,
+		"delete from rate_limit_buckets where updated_at < now() - $1 * interval '1 second';", idle.Seconds())
+	return err
+}
+
+// RunCleanup removes buckets idle for longer than idle every interval until ctx is done.
+func (s *PostgresRateLimitStore) RunCleanup(ctx context.Context, interval, idle time.Duration, log *zerolog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Cleanup(ctx, idle); err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Msg("Failed to clean up rate limit buckets")
+			}
+		}
+	}
+}
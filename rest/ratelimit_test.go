@@ -0,0 +1,229 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	test "github.com/romanWienicke/go-app-test/foundation/testing"
+	"github.com/rs/zerolog"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Burst: 2}
+	ctx := context.Background()
+
+	for i, expected := range []bool{true, true, false} {
+		res, err := store.Take(ctx, "client", limit)
+		if err != nil {
+			t.Fatalf("Failed to take token: %v", err)
+		}
+		if res.Allowed != expected {
+			t.Fatalf("Take %d: expected allowed=%v, got %v", i, expected, res.Allowed)
+		}
+		if !res.Allowed && res.RetryAfter != time.Second {
+			t.Errorf("Expected retry after 1s, got %v", res.RetryAfter)
+		}
+	}
+
+	now = now.Add(time.Second)
+	if res, _ := store.Take(ctx, "client", limit); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("Expected a refilled token, got %+v", res)
+	}
+	if res, _ := store.Take(ctx, "other", limit); !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("Expected an independent bucket per key, got %+v", res)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	e, log := newTestEcho(t)
+	e.Use(RateLimit(RateLimitConfig{
+		Default: Limit{Rate: 1, Burst: 3},
+		Routes:  map[string]Limit{"POST /order": {Rate: 1, Burst: 1}},
+		Store:   NewMemoryRateLimitStore(),
+	}, log))
+	e.GET("/product/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.POST("/order", func(c echo.Context) error { return c.NoContent(http.StatusCreated) })
+
+	do := func(method, path, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// the route override has its own, smaller bucket
+	if rec := do(http.MethodPost, "/order", "10.0.0.1"); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected first order to pass, got %d", rec.Code)
+	}
+	rec := do(http.MethodPost, "/order", "10.0.0.1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" || rec.Header().Get("RateLimit-Remaining") != "0" || rec.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("Unexpected rate limit headers %v", rec.Header())
+	}
+
+	// other routes use the default bucket
+	rec = do(http.MethodGet, "/product/1", "10.0.0.1")
+	if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Remaining") != "2" {
+		t.Fatalf("Expected default bucket with 2 remaining, got %d %v", rec.Code, rec.Header())
+	}
+
+	// other clients are not affected
+	if rec := do(http.MethodPost, "/order", "10.0.0.2"); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected other client to pass, got %d", rec.Code)
+	}
+}
+
+// countingAPIKeys counts the key lookups.
+type countingAPIKeys struct {
+	fakeAPIKeys
+	lookups int
+}
+
+func (c *countingAPIKeys) AuthenticateAPIKey(ctx context.Context, key string) (*auth.Claims, error) {
+	c.lookups++
+	return c.fakeAPIKeys.AuthenticateAPIKey(ctx, key)
+}
+
+func TestRateLimitIP(t *testing.T) {
+	keys := &countingAPIKeys{fakeAPIKeys: fakeAPIKeys{}}
+	e, log := newTestEcho(t)
+	e.Use(RateLimitIP(RateLimitConfig{IP: Limit{Rate: 1, Burst: 2}, Store: NewMemoryRateLimitStore()}, log))
+	e.Use(Authenticate(AuthConfig{APIKeys: keys}))
+	e.GET("/customer", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	// guessing keys is throttled before the lookup
+	codes := []int{}
+	for range 3 {
+		req := httptest.NewRequest(http.MethodGet, "/customer", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(echo.HeaderAuthorization, "ApiKey gat_guess_secret")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusUnauthorized || codes[1] != http.StatusUnauthorized || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("Expected two 401 and a 429, got %v", codes)
+	}
+	if keys.lookups != 2 {
+		t.Errorf("Expected 2 key lookups, got %d", keys.lookups)
+	}
+}
+
+func TestParseRouteLimits(t *testing.T) {
+	limits, err := ParseRouteLimits("POST /order=5:10, GET /product/:id=0.5:1")
+	if err != nil {
+		t.Fatalf("Failed to parse route limits: %v", err)
+	}
+	if limits["POST /order"] != (Limit{Rate: 5, Burst: 10}) || limits["GET /product/:id"] != (Limit{Rate: 0.5, Burst: 1}) {
+		t.Fatalf("Unexpected limits %v", limits)
+	}
+	if _, err := ParseRouteLimits("POST /order=5"); err == nil {
+		t.Fatalf("Expected error for missing burst")
+	}
+}
+
+func TestPostgresRateLimitStore(t *testing.T) {
+	test.SetEnv(t, "../.env")
+	dc := test.DockerComposeUp(t, "../docker-compose.yaml", "postgres")
+	test.SetupDatabaseEnv(t, dc["postgres"])
+	db := test.InitPostgres(t, "../migrations")
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Failed to close db: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		t.Helper()
+		test.DockerComposeDown(t, "../docker-compose.yaml")
+	})
+
+	store := NewPostgresRateLimitStore(db)
+	limit := Limit{Rate: 0.01, Burst: 2}
+	ctx := context.Background()
+
+	for i, expected := range []bool{true, true, false} {
+		res, err := store.Take(ctx, "client", limit)
+		if err != nil {
+			t.Fatalf("Failed to take token: %v", err)
+		}
+		if res.Allowed != expected {
+			t.Fatalf("Take %d: expected allowed=%v, got %v", i, expected, res.Allowed)
+		}
+	}
+
+	if err := store.Cleanup(ctx, 0); err != nil {
+		t.Fatalf("Failed to clean up: %v", err)
+	}
+	if res, _ := store.Take(ctx, "client", limit); !res.Allowed {
+		t.Fatalf("Expected a fresh bucket after cleanup")
+	}
+}
+
+func TestRateLimitClientIP(t *testing.T) {
+	log := zerolog.Nop()
+	newServer := func(trustedProxies ...string) *echo.Echo {
+		s, err := NewServer(Config{
+			TrustedProxies: trustedProxies,
+			RateLimit:      &RateLimitConfig{IP: Limit{Rate: 1, Burst: 2}, Store: NewMemoryRateLimitStore()},
+		}, &log)
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		return s.Echo()
+	}
+	do := func(e *echo.Echo, remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		req.Header.Set(echo.HeaderXRealIP, forwardedFor)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	t.Run("spoofed headers are ignored", func(t *testing.T) {
+		e := newServer()
+		codes := []int{}
+		for i := range 3 {
+			codes = append(codes, do(e, "203.0.113.7:1234", fmt.Sprintf("198.51.100.%d", i)))
+		}
+		if codes[2] != http.StatusTooManyRequests {
+			t.Fatalf("Expected a 429 despite rotating X-Forwarded-For, got %v", codes)
+		}
+	})
+
+	t.Run("trusted proxy", func(t *testing.T) {
+		e := newServer("10.0.0.0/8")
+		for i := range 3 {
+			if code := do(e, "10.0.0.1:1234", fmt.Sprintf("198.51.100.%d", i)); code != http.StatusOK {
+				t.Fatalf("Expected clients behind the proxy to have own buckets, got %d", code)
+			}
+		}
+		// a client outside the trusted range can't name itself
+		codes := []int{}
+		for i := range 3 {
+			codes = append(codes, do(e, "203.0.113.7:1234", fmt.Sprintf("198.51.100.%d", i)))
+		}
+		if codes[2] != http.StatusTooManyRequests {
+			t.Fatalf("Expected a 429 for an untrusted peer, got %v", codes)
+		}
+	})
+
+	t.Run("invalid proxy", func(t *testing.T) {
+		if _, err := NewServer(Config{TrustedProxies: []string{"10.0.0.1"}}, &log); err == nil {
+			t.Fatal("Expected an error for a proxy without prefix length")
+		}
+	})
+}
@@ -1,70 +1,226 @@
 package rest
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	stdlog "log"
+	"net"
 	"net/http"
+	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
 )
 
-type Payload struct {
-	Key string `json:"key" validate:"required"`
+type RouteAdder func(e *echo.Echo)
+
+// Config holds the settings of the REST server.
+type Config struct {
+	Port string
+	// TLS serves HTTPS (with HTTP/2) when set.
+	TLS *TLSConfig
+	// H2C additionally accepts HTTP/2 without TLS, for internal traffic that skips TLS.
+	H2C bool
+	// CORSAllowOrigins lists the origins browsers may call the API from.
+	CORSAllowOrigins []string
+	// TrustedProxies lists the CIDRs of reverse proxies whose X-Forwarded-For header names the
+	// client. Without it the client is the peer of the connection and the header is ignored.
+	TrustedProxies []string
+	// MaxBodySize limits request bodies, e.g. "1M"; BodyLimits overrides it per route ("POST /product").
+	MaxBodySize string
+	BodyLimits  map[string]string
+	// ReadTimeout, WriteTimeout and IdleTimeout configure the HTTP server.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// HandlerTimeout bounds the request context of every handler, HandlerTimeouts overrides it per route.
+	HandlerTimeout  time.Duration
+	HandlerTimeouts map[string]time.Duration
+	// AccessLog enables the access log when set.
+	AccessLog *AccessLogConfig
+	// Compression enables response compression when set.
+	Compression *CompressConfig
+	// Auth enables bearer token authentication when set.
+	Auth *AuthConfig
+	// Tenant resolves the tenant of every request when set.
+	Tenant *TenantConfig
+	// RateLimit enables rate limiting when set.
+	RateLimit *RateLimitConfig
+	// Exports caps the concurrent exports when set.
+	Exports *ExportLimitConfig
+	// OpenAPI enables validation against an OpenAPI document when set.
+	OpenAPI *OpenAPIConfig
 }
 
-type RouteAdder func(e *echo.Echo)
+func (cfg Config) withDefaults() Config {
+	if cfg.MaxBodySize == "" {
+		cfg.MaxBodySize = "1M"
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = 15 * time.Second
+	}
+	if cfg.HandlerTimeout == 0 {
+		cfg.HandlerTimeout = 30 * time.Second
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = cfg.HandlerTimeout + 5*time.Second
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = 2 * time.Minute
+	}
+	return cfg
+}
+
+// Server is the REST server.
+type Server struct {
+	echo *echo.Echo
+	http *http.Server
+}
+
+func NewServer(cfg Config, log *zerolog.Logger, adders ...RouteAdder) (*Server, error) {
+	cfg = cfg.withDefaults()
 
-func NewServer(port string, adders ...RouteAdder) error {
 	e := echo.New()
-	validator := validator.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.HTTPErrorHandler = NewErrorHandler(log)
+	ipExtractor, err := newIPExtractor(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	// c.RealIP, which the rate limits and the access log key on, must not trust client headers
+	e.IPExtractor = ipExtractor
+
+	e.Use(RequestID())
+	if cfg.AccessLog != nil {
+		e.Use(AccessLog(*cfg.AccessLog, log))
+	}
+	e.Use(Recover())
+	e.Use(SecureHeaders())
+	e.Use(CORS(cfg.CORSAllowOrigins))
+	if cfg.Compression != nil {
+		e.Use(Compress(*cfg.Compression))
+	}
+	e.Use(Decompress())
+	e.Use(BodyLimit(cfg.MaxBodySize, cfg.BodyLimits))
+	e.Use(Deadline(cfg.HandlerTimeout, cfg.HandlerTimeouts))
+
+	if cfg.RateLimit != nil {
+		e.Use(RateLimitIP(*cfg.RateLimit, log))
+	}
+	if cfg.Auth != nil {
+		e.Use(Authenticate(*cfg.Auth))
+	}
+	if cfg.Tenant != nil {
+		e.Use(Tenant(*cfg.Tenant))
+	}
+
+	if cfg.RateLimit != nil {
+		e.Use(RateLimit(*cfg.RateLimit, log))
+	}
+	if cfg.Exports != nil {
+		e.Use(LimitExports(*cfg.Exports))
+	}
+
+	if cfg.OpenAPI != nil {
+		openAPI, err := NewOpenAPIValidator(*cfg.OpenAPI, log)
+		if err != nil {
+			return nil, err
+		}
+		e.Use(openAPI.Middleware())
+	}
 
 	// Register routes from RouteAdders
 	for _, addRoute := range adders {
 		addRoute(e)
 	}
 
-	e.GET("/", func(c echo.Context) error {
-		return c.String(http.StatusOK, "Hello, world!")
-	})
-
 	e.GET("/ping", func(c echo.Context) error {
 		return c.String(http.StatusOK, "pong")
 	})
 
-	e.POST("/", func(c echo.Context) error {
-		var data Payload
-
-		if err := c.Bind(&data); err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
-		}
-
-		if err := validator.Struct(data); err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
-		}
-
-		return c.JSON(http.StatusCreated, map[string]string{"message": "JSON received"})
+	e.GET("/healthz", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
 	})
 
-	e.PUT("/", func(c echo.Context) error {
-		var body Payload
-		if err := c.Bind(&body); err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	s := &Server{
+		echo: e,
+		http: &http.Server{
+			Addr:              ":" + cfg.Port,
+			Handler:           e,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: min(cfg.ReadTimeout, 5*time.Second),
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			// handshake and protocol errors go to the structured log
+			ErrorLog: stdlog.New(log, "", 0),
+		},
+	}
+	if cfg.TLS != nil {
+		tlsConfig, err := NewTLSConfig(*cfg.TLS, log)
+		if err != nil {
+			return nil, err
 		}
+		s.http.TLSConfig = tlsConfig
+	}
+	if cfg.H2C {
+		s.http.Protocols = new(http.Protocols)
+		s.http.Protocols.SetHTTP1(true)
+		s.http.Protocols.SetHTTP2(true)
+		s.http.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return s, nil
+}
 
-		if err := validator.Struct(body); err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+// newIPExtractor returns the peer address of the connection as client IP, or with trusted proxies
+// the last X-Forwarded-For address not added by one of them.
+func newIPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	// only the configured proxies, not every private address as echo does by default
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range trustedProxies {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
 		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
 
-		return c.JSON(http.StatusAccepted, map[string]string{"message": "JSON received"})
-	})
+// Echo returns the router, e.g. to register additional routes in tests.
+func (s *Server) Echo() *echo.Echo {
+	return s.echo
+}
 
-	e.DELETE("/any/:id", func(c echo.Context) error {
-		id := c.Param("id")
-		if id == "" {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing id parameter"})
-		}
-		// Here you would handle deletion logic using the id
-		return c.JSON(http.StatusOK, map[string]string{"message": "Resource deleted", "id": id})
-	})
+// Start serves until the server is shut down.
+func (s *Server) Start() error {
+	l, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves on l until the server is shut down, with TLS when configured.
+func (s *Server) Serve(l net.Listener) error {
+	var err error
+	if s.http.TLSConfig != nil {
+		// the certificate comes from TLSConfig.GetCertificate
+		err = s.http.ServeTLS(l, "", "")
+	} else {
+		err = s.http.Serve(l)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
 
-	return e.Start(":" + port)
+// Shutdown stops accepting connections and waits for running requests until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
 }
@@ -0,0 +1,19 @@
+package rest
+
+import (
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+// newTestEcho returns echo with the central error handler and client IP extraction, like NewServer
+// sets it up, and the discarding logger it uses. Tests add the middleware and routes of the feature under test.
+func newTestEcho(t *testing.T) (*echo.Echo, *zerolog.Logger) {
+	t.Helper()
+	log := zerolog.Nop()
+	e := echo.New()
+	e.HTTPErrorHandler = NewErrorHandler(&log)
+	e.IPExtractor = echo.ExtractIPDirect()
+	return e, &log
+}
@@ -0,0 +1,270 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/rs/zerolog"
+)
+
+// JSON-RPC 2.0 error codes. Errors of the methods keep their HTTP status in the error data and
+// map to the server error range.
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	RPCUnauthorized   = -32001
+	RPCForbidden      = -32003
+	RPCNotFound       = -32004
+	RPCServerError    = -32000
+)
+
+// MaxRPCBatchSize bounds the requests of a batch. A batch is a single request to the rate
+// limiter, so it must not fan out into an unbounded number of calls.
+const MaxRPCBatchSize = 100
+
+// RPCMethod is a JSON-RPC method, called with the raw by-name params once the caller's
+// permission was checked.
+type RPCMethod struct {
+	Permission auth.Permission
+	Call       func(c echo.Context, params json.RawMessage) (any, error)
+}
+
+// RPCRequest is a JSON-RPC request, a missing ID makes it a notification.
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// RPCResponse carries either a result or an error.
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// RPCError is a JSON-RPC error, Data holds the HTTP status of method errors.
+type RPCError struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Data    RPCErrorData `json:"data,omitzero"`
+}
+
+// RPCErrorData relates an RPC error to the response the REST route would have given.
+type RPCErrorData struct {
+	Status  int    `json:"status,omitempty"`
+	ErrorID string `json:"error_id,omitempty"`
+}
+
+// RPC serves JSON-RPC 2.0 over the service methods, so internal tooling gets RPC semantics with
+// the validation and error mapping of the REST routes.
+type RPC struct {
+	methods map[string]RPCMethod
+	log     *zerolog.Logger
+}
+
+// NewRPC merges the methods of the services.
+func NewRPC(log *zerolog.Logger, methods ...map[string]RPCMethod) *RPC {
+	r := &RPC{methods: map[string]RPCMethod{}, log: log}
+	for _, m := range methods {
+		for name, method := range m {
+			r.methods[name] = method
+		}
+	}
+	return r
+}
+
+// RouteAdder registers POST /rpc, which takes single requests and batches of up to
+// MaxRPCBatchSize requests. Notifications are executed without a response; a request or batch of
+// notifications only is answered with 204.
+func (r *RPC) RouteAdder() RouteAdder {
+	return func(e *echo.Echo) {
+		e.POST("/rpc", r.handle)
+	}
+}
+
+func (r *RPC) handle(c echo.Context) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	body = bytes.TrimSpace(body)
+
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return c.JSON(http.StatusOK, rpcFailure(nil, RPCParseError, "Parse error"))
+		}
+		if len(batch) == 0 {
+			return c.JSON(http.StatusOK, rpcFailure(nil, RPCInvalidRequest, "Invalid Request: empty batch"))
+		}
+		if len(batch) > MaxRPCBatchSize {
+			return c.JSON(http.StatusOK, rpcFailure(nil, RPCInvalidRequest,
+				fmt.Sprintf("Invalid Request: batch exceeds %d requests", MaxRPCBatchSize)))
+		}
+		responses := make([]*RPCResponse, 0, len(batch))
+		for _, raw := range batch {
+			if res := r.call(c, raw); res != nil {
+				responses = append(responses, res)
+			}
+		}
+		if len(responses) == 0 {
+			return c.NoContent(http.StatusNoContent)
+		}
+		return c.JSON(http.StatusOK, responses)
+	}
+
+	res := r.call(c, body)
+	if res == nil {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// call runs a single request, it returns nil for notifications.
+func (r *RPC) call(c echo.Context, raw json.RawMessage) *RPCResponse {
+	var req RPCRequest
+	if !json.Valid(raw) {
+		return rpcFailure(nil, RPCParseError, "Parse error")
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return rpcFailure(nil, RPCInvalidRequest, "Invalid Request")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" || !validRPCID(req.ID) {
+		return rpcFailure(validIDOrNull(req.ID), RPCInvalidRequest, "Invalid Request")
+	}
+	notification := req.ID == nil
+
+	result, rpcErr := r.invoke(c, req)
+	if notification {
+		return nil
+	}
+	if rpcErr != nil {
+		return &RPCResponse{JSONRPC: "2.0", Error: rpcErr, ID: req.ID}
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return &RPCResponse{JSONRPC: "2.0", Error: r.mapError(c, req.Method, err), ID: req.ID}
+	}
+	return &RPCResponse{JSONRPC: "2.0", Result: encoded, ID: req.ID}
+}
+
+func (r *RPC) invoke(c echo.Context, req RPCRequest) (any, *RPCError) {
+	method, ok := r.methods[req.Method]
+	if !ok {
+		return nil, &RPCError{Code: RPCMethodNotFound, Message: "Method not found: " + req.Method}
+	}
+	claims, ok := ClaimsFrom(c)
+	if !ok {
+		return nil, &RPCError{Code: RPCUnauthorized, Message: "Missing bearer token", Data: RPCErrorData{Status: http.StatusUnauthorized}}
+	}
+	if !claims.Can(method.Permission) {
+		return nil, &RPCError{Code: RPCForbidden, Message: fmt.Sprintf("Missing permission %s", method.Permission),
+			Data: RPCErrorData{Status: http.StatusForbidden}}
+	}
+
+	params := req.Params
+	if len(params) == 0 || string(params) == "null" {
+		params = json.RawMessage("{}")
+	}
+	if params[0] != '{' {
+		return nil, &RPCError{Code: RPCInvalidParams, Message: "Invalid params: expected an object",
+			Data: RPCErrorData{Status: http.StatusBadRequest}}
+	}
+
+	result, err := method.Call(c, params)
+	if err != nil {
+		return nil, r.mapError(c, req.Method, err)
+	}
+	return result, nil
+}
+
+// mapError translates the HTTP error a REST route would answer with into an RPC error.
+func (r *RPC) mapError(c echo.Context, method string, err error) *RPCError {
+	status, message := errorStatus(err)
+	rpcErr := &RPCError{Message: message, Data: RPCErrorData{Status: status}}
+	switch {
+	case status == http.StatusBadRequest:
+		rpcErr.Code = RPCInvalidParams
+	case status == http.StatusUnauthorized:
+		rpcErr.Code = RPCUnauthorized
+	case status == http.StatusForbidden:
+		rpcErr.Code = RPCForbidden
+	case status == http.StatusNotFound:
+		rpcErr.Code = RPCNotFound
+	case status >= http.StatusInternalServerError:
+		rpcErr.Code = RPCInternalError
+		rpcErr.Data.ErrorID = uuid.NewString()
+		r.log.Error().Err(err).Str("error_id", rpcErr.Data.ErrorID).Str("request_id", GetRequestID(c)).
+			Str("rpc_method", method).Msg("RPC call failed")
+	default:
+		rpcErr.Code = RPCServerError
+	}
+	return rpcErr
+}
+
+// RPCParams decodes by-name params into T, leniently like Bind decodes REST bodies.
+func RPCParams[T any](params json.RawMessage) (T, error) {
+	var v T
+	if err := json.Unmarshal(params, &v); err != nil {
+		return v, echo.NewHTTPError(http.StatusBadRequest, "Invalid params: "+err.Error()).SetInternal(err)
+	}
+	return v, nil
+}
+
+func rpcFailure(id json.RawMessage, code int, message string) *RPCResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: code, Message: message}, ID: id}
+}
+
+// validRPCID accepts a missing ID, null, strings and numbers.
+func validRPCID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	var v any
+	if err := json.Unmarshal(id, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case nil, string, float64:
+		return true
+	}
+	return false
+}
+
+func validIDOrNull(id json.RawMessage) json.RawMessage {
+	if id == nil || !validRPCID(id) {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+// RPCID decodes the params {"id": "..."} of methods addressing a single resource, a missing or
+// malformed ID is invalid with message as on the REST route.
+func RPCID(params json.RawMessage, message string) (uuid.UUID, error) {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, message).SetInternal(err)
+	}
+	id, err := uuid.Parse(p.ID)
+	if err != nil {
+		return uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, message).SetInternal(err)
+	}
+	return id, nil
+}
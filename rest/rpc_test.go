@@ -0,0 +1,161 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+)
+
+type rpcItem struct {
+	Name string `json:"name" validate:"required"`
+}
+
+func newRPCEcho(t *testing.T, scopes ...auth.Permission) *echo.Echo {
+	e, log := newTestEcho(t)
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(claimsContextKey, &auth.Claims{Scopes: scopes})
+			return next(c)
+		}
+	})
+
+	rpc := NewRPC(log, map[string]RPCMethod{
+		"item.create": {Permission: auth.PermProductWrite, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			item, err := RPCParams[rpcItem](params)
+			if err != nil {
+				return nil, err
+			}
+			if err := validator.New().Struct(item); err != nil {
+				return nil, ServiceError(err, "", "Failed to create item")
+			}
+			return item, nil
+		}},
+		"item.get": {Permission: auth.PermProductRead, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			if _, err := RPCID(params, "Invalid item ID"); err != nil {
+				return nil, err
+			}
+			return nil, ServiceError(postgres.ErrNoRows, "Item not found", "Failed to retrieve item")
+		}},
+		"item.fail": {Permission: auth.PermProductRead, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			return nil, ServiceError(errors.New("connection refused"), "", "Failed to fail")
+		}},
+	})
+	rpc.RouteAdder()(e)
+	return e
+}
+
+func TestRPC(t *testing.T) {
+	tests := map[string]struct {
+		body     string
+		scopes   []auth.Permission
+		wantCode int
+		want     string
+	}{
+		"result": {
+			body:   `{"jsonrpc":"2.0","method":"item.create","params":{"name":"pen"},"id":1}`,
+			scopes: []auth.Permission{auth.PermProductWrite}, wantCode: http.StatusOK,
+			want: `{"jsonrpc":"2.0","result":{"name":"pen"},"id":1}`,
+		},
+		"validation error": {
+			body:   `{"jsonrpc":"2.0","method":"item.create","params":{},"id":"a"}`,
+			scopes: []auth.Permission{auth.PermProductWrite}, wantCode: http.StatusOK,
+			want: `"error":{"code":-32602,"message":"Validation failed: `,
+		},
+		"mistyped params": {
+			body:   `{"jsonrpc":"2.0","method":"item.create","params":{"name":1},"id":1}`,
+			scopes: []auth.Permission{auth.PermProductWrite}, wantCode: http.StatusOK,
+			want: `"code":-32602,"message":"Invalid params: `,
+		},
+		"positional params": {
+			body:   `{"jsonrpc":"2.0","method":"item.create","params":["pen"],"id":1}`,
+			scopes: []auth.Permission{auth.PermProductWrite}, wantCode: http.StatusOK,
+			want: `"code":-32602,"message":"Invalid params: expected an object"`,
+		},
+		"not found": {
+			body:   `{"jsonrpc":"2.0","method":"item.get","params":{"id":"6f1a3e5c-2b7d-4c1e-9f3a-0d2b4c6e8a10"},"id":1}`,
+			scopes: []auth.Permission{auth.PermProductRead}, wantCode: http.StatusOK,
+			want: `"error":{"code":-32004,"message":"Item not found","data":{"status":404}}`,
+		},
+		"invalid id": {
+			body:   `{"jsonrpc":"2.0","method":"item.get","params":{"id":"42"},"id":1}`,
+			scopes: []auth.Permission{auth.PermProductRead}, wantCode: http.StatusOK,
+			want: `"error":{"code":-32602,"message":"Invalid item ID","data":{"status":400}}`,
+		},
+		"internal error": {
+			body:   `{"jsonrpc":"2.0","method":"item.fail","id":1}`,
+			scopes: []auth.Permission{auth.PermProductRead}, wantCode: http.StatusOK,
+			want: `"error":{"code":-32603,"message":"Failed to fail","data":{"status":500,"error_id":"`,
+		},
+		"missing permission": {
+			body: `{"jsonrpc":"2.0","method":"item.create","params":{"name":"pen"},"id":1}`, wantCode: http.StatusOK,
+			want: `"error":{"code":-32003,"message":"Missing permission product:write","data":{"status":403}}`,
+		},
+		"method not found": {
+			body: `{"jsonrpc":"2.0","method":"item.melt","id":1}`, wantCode: http.StatusOK,
+			want: `"error":{"code":-32601,"message":"Method not found: item.melt"}`,
+		},
+		"parse error": {
+			body: `{"jsonrpc":"2.0","method"`, wantCode: http.StatusOK,
+			want: `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`,
+		},
+		"invalid request": {
+			body: `{"jsonrpc":"1.0","method":"item.get","id":7}`, wantCode: http.StatusOK,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":7}`,
+		},
+		"notification": {
+			body:   `{"jsonrpc":"2.0","method":"item.create","params":{"name":"pen"}}`,
+			scopes: []auth.Permission{auth.PermProductWrite}, wantCode: http.StatusNoContent,
+		},
+		"batch": {
+			body: `[{"jsonrpc":"2.0","method":"item.create","params":{"name":"pen"},"id":1},
+				{"jsonrpc":"2.0","method":"item.create","params":{"name":"ink"}},
+				1,
+				{"jsonrpc":"2.0","method":"item.create","params":{"name":"cap"},"id":2}]`,
+			scopes: []auth.Permission{auth.PermProductWrite}, wantCode: http.StatusOK,
+			want: `[{"jsonrpc":"2.0","result":{"name":"pen"},"id":1},` +
+				`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null},` +
+				`{"jsonrpc":"2.0","result":{"name":"cap"},"id":2}]`,
+		},
+		"empty batch": {
+			body: `[]`, wantCode: http.StatusOK,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request: empty batch"},"id":null}`,
+		},
+		"batch too large": {
+			body:   "[" + strings.TrimSuffix(strings.Repeat(`{"jsonrpc":"2.0","method":"item.create","params":{"name":"pen"}},`, MaxRPCBatchSize+1), ",") + "]",
+			scopes: []auth.Permission{auth.PermProductWrite}, wantCode: http.StatusOK,
+			want: `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request: batch exceeds 100 requests"},"id":null}`,
+		},
+		"batch of notifications": {
+			body:   `[{"jsonrpc":"2.0","method":"item.create","params":{"name":"pen"}}]`,
+			scopes: []auth.Permission{auth.PermProductWrite}, wantCode: http.StatusNoContent,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := newRPCEcho(t, tc.scopes...)
+			req := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d: %s", tc.wantCode, rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), tc.want) {
+				t.Errorf("expected body to contain %s, got %s", tc.want, rec.Body.String())
+			}
+			if tc.wantCode == http.StatusNoContent && rec.Body.Len() != 0 {
+				t.Errorf("expected no body, got %s", rec.Body.String())
+			}
+		})
+	}
+}
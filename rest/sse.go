@@ -0,0 +1,79 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MIMETextEventStream is the media type of Server-Sent Events.
+const MIMETextEventStream = "text/event-stream"
+
+// EventStream writes Server-Sent Events. Every write is flushed and extends the connection's
+// write deadline, so streams outlast the server's write timeout; the route should be exempt
+// from the handler deadline.
+type EventStream struct {
+	res *echo.Response
+	rc  *http.ResponseController
+}
+
+// NewEventStream sends the status and the stream headers.
+func NewEventStream(c echo.Context) *EventStream {
+	s := &EventStream{res: c.Response(), rc: http.NewResponseController(c.Response())}
+	header := s.res.Header()
+	header.Set(echo.HeaderContentType, MIMETextEventStream)
+	header.Set("Cache-Control", "no-cache")
+	// keeps reverse proxies like nginx from buffering the stream
+	header.Set("X-Accel-Buffering", "no")
+	s.res.WriteHeader(http.StatusOK)
+	_ = s.flush()
+	return s
+}
+
+// Send writes an event with data encoded as JSON. The id is what clients send back as
+// Last-Event-ID when they reconnect.
+func (s *EventStream) Send(id, event string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.res, "id: %s\nevent: %s\ndata: %s\n\n", id, event, encoded); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// Heartbeat writes a comment, which keeps idle connections and proxies from timing out.
+func (s *EventStream) Heartbeat() error {
+	if _, err := s.res.Write([]byte(": heartbeat\n\n")); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *EventStream) flush() error {
+	// best effort, not every writer supports deadlines
+	_ = s.rc.SetWriteDeadline(time.Now().Add(exportDeadlineExtension))
+	return s.rc.Flush()
+}
+
+// LastEventID returns the numeric ID a reconnecting client resumes from, taken from the
+// Last-Event-ID header or the last_event_id query parameter, and false for a fresh subscription.
+func LastEventID(c echo.Context) (int64, bool, error) {
+	value := c.Request().Header.Get("Last-Event-ID")
+	if value == "" {
+		value = c.QueryParam("last_event_id")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, echo.NewHTTPError(http.StatusBadRequest, "Invalid Last-Event-ID")
+	}
+	return id, true, nil
+}
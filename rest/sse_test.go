@@ -0,0 +1,61 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestEventStream(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/events", nil), rec)
+
+	stream := NewEventStream(c)
+	if err := stream.Send("42", "order.status", map[string]string{"status": "shipped"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := stream.Heartbeat(); err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+
+	want := "id: 42\nevent: order.status\ndata: {\"status\":\"shipped\"}\n\n: heartbeat\n\n"
+	if rec.Body.String() != want {
+		t.Errorf("expected %q, got %q", want, rec.Body.String())
+	}
+	if rec.Header().Get(echo.HeaderContentType) != MIMETextEventStream || !rec.Flushed {
+		t.Errorf("expected a flushed event stream, got %v", rec.Header())
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	tests := map[string]struct {
+		header     string
+		query      string
+		want       int64
+		wantResume bool
+		wantErr    bool
+	}{
+		"fresh":   {},
+		"header":  {header: "17", want: 17, wantResume: true},
+		"query":   {query: "?last_event_id=9", want: 9, wantResume: true},
+		"invalid": {header: "abc", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/events"+tc.query, nil)
+			if tc.header != "" {
+				req.Header.Set("Last-Event-ID", tc.header)
+			}
+			id, resume, err := LastEventID(echo.New().NewContext(req, httptest.NewRecorder()))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if id != tc.want || resume != tc.wantResume {
+				t.Errorf("expected %d/%v, got %d/%v", tc.want, tc.wantResume, id, resume)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package rest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+)
+
+// DefaultTenantHeader is the request header naming the tenant.
+const DefaultTenantHeader = "X-Tenant-ID"
+
+// tenantPattern matches tenant IDs, which double as subdomains.
+var tenantPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// TenantConfig configures how the tenant of a request is resolved.
+type TenantConfig struct {
+	// Header names the request header carrying the tenant ID, DefaultTenantHeader by default.
+	Header string
+	// Domain resolves hosts "<tenant>.<Domain>" to the tenant, when set.
+	Domain string
+	// Default is the tenant of requests naming none and of tokens without tenant claim.
+	Default string
+	// Exists rejects unknown tenants with 404 when set.
+	Exists func(ctx context.Context, tenant string) (bool, error)
+	// OptionalRoutes lists route paths that work without tenant, e.g. /ping.
+	OptionalRoutes []string
+}
+
+// Tenant returns middleware resolving the tenant of every request and storing it in the request
+// context for postgres.BeginTenantTx. The tenant claim of an authenticated caller decides; a
+// tenant header or subdomain naming another tenant is rejected, as a token is only valid for its
+// own tenant. Anonymous requests, e.g. logins, name the tenant with the header or subdomain.
+// Routes other than the optional ones fail with 400 without tenant.
+func Tenant(cfg TenantConfig) echo.MiddlewareFunc {
+	if cfg.Header == "" {
+		cfg.Header = DefaultTenantHeader
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			requested, err := requestedTenant(c, cfg)
+			if err != nil {
+				return err
+			}
+
+			tenant := requested
+			if claims, ok := ClaimsFrom(c); ok {
+				tenant = claims.Tenant
+				if tenant == "" {
+					tenant = cfg.Default
+				}
+				if tenant == "" || (requested != "" && requested != tenant) {
+					return echo.NewHTTPError(http.StatusForbidden, "Token not valid for this tenant")
+				}
+			}
+			if tenant == "" {
+				tenant = cfg.Default
+			}
+			if tenant == "" {
+				if slices.Contains(cfg.OptionalRoutes, c.Path()) {
+					return next(c)
+				}
+				return echo.NewHTTPError(http.StatusBadRequest, "Missing tenant")
+			}
+
+			if cfg.Exists != nil {
+				exists, err := cfg.Exists(c.Request().Context(), tenant)
+				if err != nil {
+					return err
+				}
+				if !exists {
+					return echo.NewHTTPError(http.StatusNotFound, "Unknown tenant")
+				}
+			}
+			c.SetRequest(c.Request().WithContext(postgres.WithTenant(c.Request().Context(), tenant)))
+			return next(c)
+		}
+	}
+}
+
+// requestedTenant returns the tenant named by header or subdomain, which have to agree.
+func requestedTenant(c echo.Context, cfg TenantConfig) (string, error) {
+	header := strings.ToLower(strings.TrimSpace(c.Request().Header.Get(cfg.Header)))
+	if header != "" && !tenantPattern.MatchString(header) {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Invalid tenant")
+	}
+
+	subdomain := ""
+	if cfg.Domain != "" {
+		host := c.Request().Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		label, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(cfg.Domain))
+		if ok && tenantPattern.MatchString(label) {
+			subdomain = label
+		}
+	}
+
+	if header != "" && subdomain != "" && header != subdomain {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Tenant header and subdomain differ")
+	}
+	if header != "" {
+		return header, nil
+	}
+	return subdomain, nil
+}
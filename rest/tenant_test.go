@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+)
+
+func TestTenant(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{Secret: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	sign := func(tenant string) string {
+		t.Helper()
+		token, err := auth.NewHS256Signer("secret").Sign(auth.Claims{Tenant: tenant, RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "alice",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}})
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return token
+	}
+	exists := func(_ context.Context, tenant string) (bool, error) {
+		return tenant != "gone", nil
+	}
+
+	newEcho := func(cfg TenantConfig) *echo.Echo {
+		e, _ := newTestEcho(t)
+		e.Use(Authenticate(AuthConfig{Verifier: verifier, PublicRoutes: []string{"/ping", "/auth/login"}}))
+		e.Use(Tenant(cfg))
+		handler := func(c echo.Context) error {
+			tenant, _ := postgres.TenantFromContext(c.Request().Context())
+			return c.String(http.StatusOK, tenant)
+		}
+		e.GET("/ping", handler)
+		e.GET("/auth/login", handler)
+		e.GET("/whoami", handler)
+		return e
+	}
+	strict := newEcho(TenantConfig{Domain: "example.com", Exists: exists, OptionalRoutes: []string{"/ping"}})
+	withDefault := newEcho(TenantConfig{Default: "default"})
+
+	tests := map[string]struct {
+		e            *echo.Echo
+		path         string
+		host         string
+		header       string
+		token        string
+		expectedCode int
+		expectedBody string
+	}{
+		"header":                {e: strict, path: "/auth/login", header: "acme", expectedCode: http.StatusOK, expectedBody: "acme"},
+		"subdomain":             {e: strict, path: "/auth/login", host: "acme.example.com:8080", expectedCode: http.StatusOK, expectedBody: "acme"},
+		"other domain":          {e: strict, path: "/auth/login", host: "acme.example.org", expectedCode: http.StatusBadRequest},
+		"header and subdomain":  {e: strict, path: "/auth/login", host: "acme.example.com", header: "other", expectedCode: http.StatusBadRequest},
+		"invalid header":        {e: strict, path: "/auth/login", header: "../acme", expectedCode: http.StatusBadRequest},
+		"unknown tenant":        {e: strict, path: "/auth/login", header: "gone", expectedCode: http.StatusNotFound},
+		"missing tenant":        {e: strict, path: "/auth/login", expectedCode: http.StatusBadRequest},
+		"optional route":        {e: strict, path: "/ping", expectedCode: http.StatusOK},
+		"token":                 {e: strict, path: "/whoami", token: sign("acme"), expectedCode: http.StatusOK, expectedBody: "acme"},
+		"token and header":      {e: strict, path: "/whoami", token: sign("acme"), header: "acme", expectedCode: http.StatusOK, expectedBody: "acme"},
+		"token of other tenant": {e: strict, path: "/whoami", token: sign("acme"), header: "other", expectedCode: http.StatusForbidden},
+		"token without tenant":  {e: strict, path: "/whoami", token: sign(""), header: "acme", expectedCode: http.StatusForbidden},
+		"default":               {e: withDefault, path: "/auth/login", expectedCode: http.StatusOK, expectedBody: "default"},
+		"default token":         {e: withDefault, path: "/whoami", token: sign(""), expectedCode: http.StatusOK, expectedBody: "default"},
+		"default overridden":    {e: withDefault, path: "/auth/login", header: "acme", expectedCode: http.StatusOK, expectedBody: "acme"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.header != "" {
+				req.Header.Set(DefaultTenantHeader, tt.header)
+			}
+			if tt.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			tt.e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedCode, rec.Code, rec.Body.String())
+			}
+			if tt.expectedBody != "" && rec.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+const defaultTLSReloadInterval = 10 * time.Second
+
+// TLSConfig configures native TLS.
+type TLSConfig struct {
+	// CertFile and KeyFile hold the PEM encoded server certificate chain and key.
+	CertFile string
+	KeyFile  string
+	// ReloadInterval is how often the files are checked for changes, 10s by default. Changed
+	// files are picked up by the next handshake, so rotated certificates need no restart.
+	ReloadInterval time.Duration
+	// ClientCAFile enables mutual TLS: client certificates are verified against these CAs.
+	ClientCAFile string
+	// RequireClientCert rejects connections without a valid client certificate, otherwise a
+	// certificate is only verified when the client sends one.
+	RequireClientCert bool
+}
+
+// NewTLSConfig builds the server's TLS configuration. The certificate is loaded right away, so
+// misconfigured files fail at startup.
+func NewTLSConfig(cfg TLSConfig, log *zerolog.Logger) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("tls: certificate and key file are required")
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = defaultTLSReloadInterval
+	}
+
+	reloader := &certReloader{certFile: cfg.CertFile, keyFile: cfg.KeyFile, interval: cfg.ReloadInterval, log: log}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates in client CA file %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// certReloader serves the current certificate and reloads it when the files changed. The files
+// are checked on handshakes, at most once per interval.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	log      *zerolog.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	cert, due := r.cert, time.Since(r.lastCheck) >= r.interval
+	r.mu.RUnlock()
+	if !due {
+		return cert, nil
+	}
+
+	if err := r.reloadIfChanged(); err != nil {
+		// keep serving the previous certificate, the sidecar may be midway through a rotation
+		r.log.Error().Err(err).Str("cert_file", r.certFile).Msg("Failed to reload TLS certificate")
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) reloadIfChanged() error {
+	r.mu.Lock()
+	if time.Since(r.lastCheck) < r.interval {
+		r.mu.Unlock()
+		return nil
+	}
+	r.lastCheck = time.Now()
+	modTime := r.modTime
+	r.mu.Unlock()
+
+	latest, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	if latest.Equal(modTime) {
+		return nil
+	}
+	if err := r.load(); err != nil {
+		return err
+	}
+	r.log.Info().Str("cert_file", r.certFile).Msg("Reloaded TLS certificate")
+	return nil
+}
+
+// load reads the key pair and remembers the modification time it was read at.
+func (r *certReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls: load key pair: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.lastCheck = time.Now()
+	return nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("tls: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ClientCertificate returns the verified client certificate of a mutual TLS connection, or nil.
+func ClientCertificate(c echo.Context) *x509.Certificate {
+	state := c.Request().TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// ClientIdentity names the client of a mutual TLS connection: the certificate's common name, or
+// its first URI or DNS name. It is empty without a verified client certificate.
+func ClientIdentity(c echo.Context) string {
+	cert := ClientCertificate(c)
+	switch {
+	case cert == nil:
+		return ""
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	}
+	return ""
+}
@@ -0,0 +1,249 @@
+package rest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+// testCA issues certificates for the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM encoded certificate and key for a server (with IP SAN 127.0.0.1) or client.
+func (ca *testCA) issue(t *testing.T, serial int64, commonName string, client bool) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if client {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		tmpl.IPAddresses = nil
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startTestServer serves cfg on a random local port and returns its address.
+func startTestServer(t *testing.T, cfg Config) string {
+	t.Helper()
+	log := zerolog.Nop()
+	s, err := NewServer(cfg, &log)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	s.Echo().GET("/whoami", func(c echo.Context) error {
+		return c.String(http.StatusOK, ClientIdentity(c))
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(func() { _ = s.Shutdown(t.Context()) })
+	return l.Addr().String()
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	certPEM, keyPEM := ca.issue(t, 10, "server", false)
+	start := time.Now().Add(-time.Minute)
+	writeFile(t, certFile, certPEM, start)
+	writeFile(t, keyFile, keyPEM, start)
+	writeFile(t, caFile, ca.pem, start)
+
+	addr := startTestServer(t, Config{TLS: &TLSConfig{
+		CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Millisecond, ClientCAFile: caFile,
+	}})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCertPEM, clientKeyPEM := ca.issue(t, 20, "billing-service", true)
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(t *testing.T, certs []tls.Certificate) (*http.Response, string) {
+		t.Helper()
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+			ForceAttemptHTTP2: true,
+			DisableKeepAlives: true,
+		}}
+		res, err := client.Get("https://" + addr + "/whoami")
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		defer func() { _ = res.Body.Close() }()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, string(body)
+	}
+
+	t.Run("http2 without client certificate", func(t *testing.T) {
+		res, body := get(t, nil)
+		if res.ProtoMajor != 2 {
+			t.Errorf("expected HTTP/2, got %s", res.Proto)
+		}
+		if body != "" {
+			t.Errorf("expected no client identity, got %q", body)
+		}
+	})
+
+	t.Run("client identity", func(t *testing.T) {
+		_, body := get(t, []tls.Certificate{clientCert})
+		if body != "billing-service" {
+			t.Errorf("expected client identity billing-service, got %q", body)
+		}
+	})
+
+	t.Run("rotated certificate is reloaded", func(t *testing.T) {
+		certPEM, keyPEM := ca.issue(t, 11, "server", false)
+		writeFile(t, certFile, certPEM, start.Add(30*time.Second))
+		writeFile(t, keyFile, keyPEM, start.Add(30*time.Second))
+		time.Sleep(5 * time.Millisecond)
+
+		res, _ := get(t, nil)
+		if serial := res.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 11 {
+			t.Errorf("expected the rotated certificate 11, got %d", serial)
+		}
+	})
+
+	t.Run("broken files keep the previous certificate", func(t *testing.T) {
+		writeFile(t, keyFile, []byte("garbage"), start.Add(time.Minute))
+		time.Sleep(5 * time.Millisecond)
+
+		res, _ := get(t, nil)
+		if serial := res.TLS.PeerCertificates[0].SerialNumber.Int64(); serial != 11 {
+			t.Errorf("expected the previous certificate 11, got %d", serial)
+		}
+	})
+}
+
+func TestTLSRequireClientCert(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, 10, "server", false)
+	for name, data := range map[string][]byte{"tls.crt": certPEM, "tls.key": keyPEM, "ca.crt": ca.pem} {
+		writeFile(t, filepath.Join(dir, name), data, time.Now())
+	}
+	addr := startTestServer(t, Config{TLS: &TLSConfig{
+		CertFile:          filepath.Join(dir, "tls.crt"),
+		KeyFile:           filepath.Join(dir, "tls.key"),
+		ClientCAFile:      filepath.Join(dir, "ca.crt"),
+		RequireClientCert: true,
+	}})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	if res, err := client.Get("https://" + addr + "/whoami"); err == nil {
+		_ = res.Body.Close()
+		t.Fatal("expected the handshake to fail without a client certificate")
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	log := zerolog.Nop()
+	dir := t.TempDir()
+	if _, err := NewTLSConfig(TLSConfig{}, &log); err == nil {
+		t.Error("expected an error without files")
+	}
+	if _, err := NewTLSConfig(TLSConfig{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: filepath.Join(dir, "missing.key")}, &log); err == nil {
+		t.Error("expected an error for missing files")
+	}
+}
+
+func TestH2C(t *testing.T) {
+	addr := startTestServer(t, Config{H2C: true})
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	res, err := client.Get("http://" + addr + "/ping")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2, got %s", res.Proto)
+	}
+}
@@ -0,0 +1,264 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/rest"
+	"github.com/rs/zerolog"
+)
+
+// keyPrefix marks the keys issued by this service, the visible part follows it.
+const keyPrefix = "gat_"
+
+var (
+	ErrInvalidKey   = errors.New("invalid API key")
+	ErrUnknownScope = errors.New("unknown scope")
+)
+
+type APIKey struct {
+	ID         uuid.UUID      `db:"id" json:"id" xml:"id" validate:"omitempty,uuid4"`
+	Name       string         `db:"name" json:"name" xml:"name" validate:"required,min=2,max=100"`
+	Prefix     string         `db:"prefix" json:"prefix" xml:"prefix"`
+	Scopes     pq.StringArray `db:"scopes" json:"scopes" xml:"scopes>scope" validate:"required,min=1"`
+	ExpiresAt  *time.Time     `db:"expires_at" json:"expires_at,omitempty" xml:"expires_at,omitempty"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at" xml:"created_at"`
+	RevokedAt  *time.Time     `db:"revoked_at" json:"revoked_at,omitempty" xml:"revoked_at,omitempty"`
+	LastUsedAt *time.Time     `db:"last_used_at" json:"last_used_at,omitempty" xml:"last_used_at,omitempty"`
+	UsageCount int64          `db:"usage_count" json:"usage_count" xml:"usage_count"`
+}
+
+// CreatedKey is returned once on creation, it is the only time the full key is visible.
+type CreatedKey struct {
+	APIKey
+	Key string `json:"key" xml:"key"`
+}
+
+func Validate(k APIKey) error {
+	validator := validator.New()
+	if err := validator.Struct(k); err != nil {
+		return err
+	}
+	for _, scope := range k.Scopes {
+		if !auth.IsPermission(auth.Permission(scope)) {
+			return fmt.Errorf("%w %q", ErrUnknownScope, scope)
+		}
+	}
+	return nil
+}
+
+type APIKeyService struct {
+	db    *postgres.Db
+	log   *zerolog.Logger
+	usage usage
+}
+
+func NewAPIKeyService(db *postgres.Db, log *zerolog.Logger) *APIKeyService {
+	return &APIKeyService{
+		db:  db,
+		log: log,
+	}
+}
+
+func (s *APIKeyService) RouteAdder() func(e *echo.Echo) {
+	return func(e *echo.Echo) {
+		e.POST("/admin/apikeys", func(c echo.Context) error {
+			var newKey APIKey
+			if err := rest.Bind(c, &newKey); err != nil {
+				s.log.Error().Err(err).Msg("Failed to bind API key")
+				return err
+			}
+			if err := Validate(newKey); err != nil {
+				s.log.Error().Err(err).Msg("Invalid API key")
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+			}
+
+			created, err := s.CreateKey(c.Request().Context(), newKey)
+			if err != nil {
+				s.log.Error().Err(err).Msg("Failed to create API key")
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create API key"})
+			}
+			return rest.Respond(c, http.StatusCreated, created)
+		}, rest.Require(auth.PermAPIKeyManage))
+
+		e.GET("/admin/apikeys", func(c echo.Context) error {
+			keys, err := s.ListKeys(c.Request().Context())
+			if err != nil {
+				s.log.Error().Err(err).Msg("Failed to list API keys")
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list API keys"})
+			}
+			return rest.Respond(c, http.StatusOK, keys)
+		}, rest.Require(auth.PermAPIKeyManage))
+
+		e.DELETE("/admin/apikeys/:id", func(c echo.Context) error {
+			id, err := uuid.Parse(c.Param("id"))
+			if err != nil {
+				s.log.Error().Err(err).Msg("Invalid API key ID")
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid API key ID"})
+			}
+
+			if err := s.RevokeKey(c.Request().Context(), id); err != nil {
+				if errors.Is(err, postgres.ErrNoRows) {
+					return c.JSON(http.StatusNotFound, map[string]string{"error": "API key not found"})
+				}
+				s.log.Error().Err(err).Msg("Failed to revoke API key")
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke API key"})
+			}
+			return c.NoContent(http.StatusNoContent)
+		}, rest.Require(auth.PermAPIKeyManage))
+	}
+}
+
+// CreateKey stores a new key and returns it including the secret, which is only kept hashed.
+func (s *APIKeyService) CreateKey(ctx context.Context, key APIKey) (*CreatedKey, error) {
+	if err := Validate(key); err != nil {
+		return nil, err
+	}
+
+	prefix, secret, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+	plain := keyPrefix + prefix + "_" + secret
+
+	// tenant_id defaults to the tenant of the transaction, keys authenticate for it
+	key.ID = uuid.New()
+	key.Prefix = prefix
+	err = s.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowContext(ctx,
+			"insert into api_keys (id, name, prefix, key_hash, scopes, expires_at) values ($1, $2, $3, $4, $5, $6) returning created_at;",
+			key.ID, key.Name, key.Prefix, hashKey(plain), key.Scopes, key.ExpiresAt).Scan(&key.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreatedKey{APIKey: key, Key: plain}, nil
+}
+
+func (s *APIKeyService) ListKeys(ctx context.Context) ([]APIKey, error) {
+	keys, err := postgres.InTenantResult(ctx, s.db, func(tx *sqlx.Tx) ([]APIKey, error) {
+		return postgres.QueryList[APIKey](ctx, tx,
+			"select id, name, prefix, scopes, expires_at, created_at, revoked_at, last_used_at, usage_count from api_keys where tenant_id=current_tenant() order by created_at")
+	})
+	if keys == nil {
+		keys = []APIKey{}
+	}
+	return keys, err
+}
+
+func (s *APIKeyService) GetKeyByID(ctx context.Context, id uuid.UUID) (*APIKey, error) {
+	return postgres.InTenantResult(ctx, s.db, func(tx *sqlx.Tx) (*APIKey, error) {
+		return postgres.QueryOne[APIKey](ctx, tx,
+			"select id, name, prefix, scopes, expires_at, created_at, revoked_at, last_used_at, usage_count from api_keys where id=$1 and tenant_id=current_tenant()", id)
+	})
+}
+
+func (s *APIKeyService) RevokeKey(ctx context.Context, id uuid.UUID) error {
+	return s.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"update api_keys set revoked_at=coalesce(revoked_at, now()) where id=$1 and tenant_id=current_tenant();", id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return postgres.ErrNoRows
+		}
+		return nil
+	})
+}
+
+type storedKey struct {
+	ID        uuid.UUID      `db:"id"`
+	TenantID  string         `db:"tenant_id"`
+	KeyHash   string         `db:"key_hash"`
+	Scopes    pq.StringArray `db:"scopes"`
+	ExpiresAt *time.Time     `db:"expires_at"`
+	RevokedAt *time.Time     `db:"revoked_at"`
+}
+
+// AuthenticateAPIKey implements rest.APIKeyAuthenticator. Valid keys are granted their scopes
+// within the tenant they were created in and their usage is recorded. Keys are looked up across
+// tenants, as the tenant of the request is only known afterwards.
+func (s *APIKeyService) AuthenticateAPIKey(ctx context.Context, plain string) (*auth.Claims, error) {
+	prefix, ok := parsePrefix(plain)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	stored, err := postgres.QueryOne[storedKey](ctx, s.db.GetDB(),
+		"select id, tenant_id, key_hash, scopes, expires_at, revoked_at from api_keys where prefix=$1", prefix)
+	if errors.Is(err, postgres.ErrNoRows) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(stored.KeyHash), []byte(hashKey(plain))) != 1 {
+		return nil, ErrInvalidKey
+	}
+	if stored.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: revoked", ErrInvalidKey)
+	}
+	if stored.ExpiresAt != nil && stored.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidKey)
+	}
+
+	// written in batches by RunUsage
+	s.usage.record(stored.ID, time.Now())
+
+	scopes := make([]auth.Permission, len(stored.Scopes))
+	for i, scope := range stored.Scopes {
+		scopes[i] = auth.Permission(scope)
+	}
+	return &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "apikey:" + stored.ID.String()},
+		Scopes:           scopes,
+		Tenant:           stored.TenantID,
+	}, nil
+}
+
+func generateKey() (string, string, error) {
+	b := make([]byte, 38)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(b[:4]), base64.RawURLEncoding.EncodeToString(b[4:]), nil
+}
+
+// parsePrefix extracts the visible prefix of a key formatted as gat_<prefix>_<secret>.
+func parsePrefix(plain string) (string, bool) {
+	rest, ok := strings.CutPrefix(plain, keyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || prefix == "" || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+// hashKey is used to store keys; they are random, so a fast hash is sufficient.
+func hashKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
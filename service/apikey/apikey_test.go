@@ -0,0 +1,118 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	test "github.com/romanWienicke/go-app-test/foundation/testing"
+	"github.com/rs/zerolog"
+)
+
+func TestUsage(t *testing.T) {
+	var u usage
+	id := uuid.New()
+	first := time.Now()
+	u.record(id, first)
+	u.record(id, first.Add(-time.Second))
+	keys := u.take()
+	if keys[id].count != 2 || !keys[id].lastUsed.Equal(first) {
+		t.Fatalf("Expected 2 uses, last at %v, got %+v", first, keys[id])
+	}
+	if len(u.take()) != 0 {
+		t.Fatal("Expected take to start over")
+	}
+
+	// usage that failed to be written is kept for the next flush
+	u.record(id, first.Add(time.Second))
+	u.add(keys)
+	if k := u.take()[id]; k.count != 3 || !k.lastUsed.Equal(first.Add(time.Second)) {
+		t.Fatalf("Expected 3 uses, got %+v", k)
+	}
+}
+
+func TestAPIKeyService(t *testing.T) {
+	test.SetEnv(t, "../../.env")
+	dc := test.DockerComposeUp(t, "../../docker-compose.yaml", "postgres")
+	test.SetupDatabaseEnv(t, dc["postgres"])
+	db := test.InitPostgres(t, "../../migrations")
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Failed to close db: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		t.Helper()
+		test.DockerComposeDown(t, "../../docker-compose.yaml")
+	})
+
+	ctx := postgres.WithTenant(context.Background(), "default")
+	log := zerolog.Nop()
+	keyService := NewAPIKeyService(db, &log)
+
+	// Unknown scopes are rejected
+	if _, err := keyService.CreateKey(ctx, APIKey{Name: "warehouse", Scopes: []string{"order:fly"}}); !errors.Is(err, ErrUnknownScope) {
+		t.Fatalf("Expected ErrUnknownScope, got %v", err)
+	}
+
+	created, err := keyService.CreateKey(ctx, APIKey{Name: "warehouse", Scopes: []string{"order:write", "product:read"}})
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	// Authenticate grants the scopes and records the usage
+	for i := 0; i < 2; i++ {
+		claims, err := keyService.AuthenticateAPIKey(ctx, created.Key)
+		if err != nil {
+			t.Fatalf("Failed to authenticate API key: %v", err)
+		}
+		if !claims.Can(auth.PermOrderWrite) || claims.Can(auth.PermOrderDelete) {
+			t.Fatalf("Unexpected scopes %v", claims.Scopes)
+		}
+	}
+	if err := keyService.FlushUsage(ctx); err != nil {
+		t.Fatalf("Failed to record usage: %v", err)
+	}
+	stored, err := keyService.GetKeyByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve API key: %v", err)
+	}
+	if stored.UsageCount != 2 || stored.LastUsedAt == nil {
+		t.Fatalf("Expected 2 recorded usages, got %d (last used %v)", stored.UsageCount, stored.LastUsedAt)
+	}
+
+	// Tampered keys are rejected
+	if _, err := keyService.AuthenticateAPIKey(ctx, created.Key+"x"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey for tampered key, got %v", err)
+	}
+
+	// Expired keys are rejected
+	expiredAt := time.Now().Add(-time.Minute)
+	expired, err := keyService.CreateKey(ctx, APIKey{Name: "expired", Scopes: []string{"order:read"}, ExpiresAt: &expiredAt})
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	if _, err := keyService.AuthenticateAPIKey(ctx, expired.Key); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey for expired key, got %v", err)
+	}
+
+	// Revoked keys are rejected
+	if err := keyService.RevokeKey(ctx, created.ID); err != nil {
+		t.Fatalf("Failed to revoke API key: %v", err)
+	}
+	if _, err := keyService.AuthenticateAPIKey(ctx, created.Key); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey for revoked key, got %v", err)
+	}
+
+	keys, err := keyService.ListKeys(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list API keys: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 API keys, got %d", len(keys))
+	}
+}
@@ -0,0 +1,103 @@
+package apikey
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// DefaultUsageFlushInterval is how often RunUsage writes the recorded key usage.
+const DefaultUsageFlushInterval = 10 * time.Second
+
+// usage collects the uses of keys in memory, so authenticating a request neither waits for nor
+// serializes on the row of its key. FlushUsage writes them in a single statement.
+type usage struct {
+	mu   sync.Mutex
+	keys map[uuid.UUID]keyUsage
+}
+
+type keyUsage struct {
+	count    int64
+	lastUsed time.Time
+}
+
+func (u *usage) record(id uuid.UUID, at time.Time) {
+	u.add(map[uuid.UUID]keyUsage{id: {count: 1, lastUsed: at}})
+}
+
+// take returns the recorded usage and starts over.
+func (u *usage) take() map[uuid.UUID]keyUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	keys := u.keys
+	u.keys = nil
+	return keys
+}
+
+// add merges usage into the recorded one, also to retry usage that failed to be written.
+func (u *usage) add(keys map[uuid.UUID]keyUsage) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.keys == nil {
+		u.keys = make(map[uuid.UUID]keyUsage, len(keys))
+	}
+	for id, k := range keys {
+		current := u.keys[id]
+		current.count += k.count
+		if k.lastUsed.After(current.lastUsed) {
+			current.lastUsed = k.lastUsed
+		}
+		u.keys[id] = current
+	}
+}
+
+// FlushUsage writes the usage recorded since the last flush to last_used_at and usage_count.
+func (s *APIKeyService) FlushUsage(ctx context.Context) error {
+	keys := s.usage.take()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ids := make(pq.StringArray, 0, len(keys))
+	counts := make(pq.Int64Array, 0, len(keys))
+	lastUsed := make(pq.StringArray, 0, len(keys))
+	for id, k := range keys {
+		ids = append(ids, id.String())
+		counts = append(counts, k.count)
+		lastUsed = append(lastUsed, k.lastUsed.Format(time.RFC3339Nano))
+	}
+
+	// runs as owner like the lookup in AuthenticateAPIKey, the keys belong to several tenants
+	_, err := s.db.GetDB().ExecContext(ctx,
+		`update api_keys k set usage_count=k.usage_count+u.count, last_used_at=greatest(k.last_used_at, u.last_used)
+		from unnest($1::uuid[], $2::bigint[], $3::timestamptz[]) as u(id, count, last_used)
+		where k.id=u.id;`,
+		ids, counts, lastUsed)
+	if err != nil {
+		s.usage.add(keys)
+	}
+	return err
+}
+
+// RunUsage flushes the recorded usage every interval until ctx is done. Usage recorded after
+// that is written by a last FlushUsage on shutdown.
+func (s *APIKeyService) RunUsage(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultUsageFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.FlushUsage(ctx); err != nil && ctx.Err() == nil {
+				s.log.Error().Err(err).Msg("Failed to record API key usage")
+			}
+		}
+	}
+}
@@ -5,15 +5,20 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/events"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
 	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/outbox"
+	"github.com/romanWienicke/go-app-test/rest"
 	"github.com/rs/zerolog"
 )
 
 type Customer struct {
-	ID    uuid.UUID `db:"id" json:"id" validate:"omitempty,uuid4"`
-	Name  string    `db:"name" json:"name" validate:"required,min=2,max=100"`
-	Email string    `db:"email" json:"email" validate:"required,email"`
+	ID    uuid.UUID `db:"id" json:"id" xml:"id" validate:"omitempty,uuid4"`
+	Name  string    `db:"name" json:"name" xml:"name" validate:"required,min=2,max=100"`
+	Email string    `db:"email" json:"email" xml:"email" validate:"required,email"`
 }
 
 func Validate(c Customer) error {
@@ -21,9 +26,14 @@ func Validate(c Customer) error {
 	return validator.Struct(c)
 }
 
+// ChangesChannel is the NOTIFY channel receiving the ID and tenant of every inserted, updated or
+// deleted customer, see postgres.Db.Listen and postgres.Change.
+const ChangesChannel = "customers_changed"
+
 type CustomerService struct {
-	db  *postgres.Db
-	log *zerolog.Logger
+	db     *postgres.Db
+	log    *zerolog.Logger
+	outbox *outbox.Outbox
 }
 
 func NewCustomerService(db *postgres.Db, log *zerolog.Logger) *CustomerService {
@@ -33,24 +43,31 @@ func NewCustomerService(db *postgres.Db, log *zerolog.Logger) *CustomerService {
 	}
 }
 
+// SetOutbox sets the outbox customer events are stored in. Bulk imports don't publish events.
+func (cs *CustomerService) SetOutbox(o *outbox.Outbox) {
+	cs.outbox = o
+}
+
 func (cs *CustomerService) RouteAdder() func(e *echo.Echo) {
 	return func(e *echo.Echo) {
 		e.POST("/customer", func(c echo.Context) error {
 			var newCustomer Customer
-			if err := c.Bind(&newCustomer); err != nil {
+			if err := rest.Bind(c, &newCustomer); err != nil {
 				cs.log.Error().Err(err).Msg("Failed to bind customer")
-				return c.JSON(400, map[string]string{"error": "Invalid request body"})
+				return err
 			}
 
-			id, err := cs.CreateCustomer(c.Request().Context(), newCustomer)
+			created, err := cs.create(c.Request().Context(), newCustomer)
 			if err != nil {
-				cs.log.Error().Err(err).Msg("Failed to create customer")
-				return c.JSON(500, map[string]string{"error": "Failed to create customer"})
+				return err
 			}
-
-			newCustomer.ID = id
-			return c.JSON(201, newCustomer)
-		})
+			return rest.Respond(c, 201, created)
+		}, rest.Require(auth.PermCustomerWrite))
+		e.POST("/customer\\:bulk", rest.Bulk(rest.BulkConfig[Customer]{
+			DB:       cs.db,
+			Validate: Validate,
+			Insert:   cs.insertCustomers,
+		}, cs.log), rest.Require(auth.PermCustomerWrite))
 		e.GET("/customer/:id", func(c echo.Context) error {
 			idParam := c.Param("id")
 			id, err := uuid.Parse(idParam)
@@ -59,17 +76,12 @@ func (cs *CustomerService) RouteAdder() func(e *echo.Echo) {
 				return c.JSON(400, map[string]string{"error": "Invalid customer ID"})
 			}
 
-			customer, err := cs.GetCustomerByID(c.Request().Context(), id)
+			customer, err := cs.get(c.Request().Context(), id)
 			if err != nil {
-				if err == postgres.ErrNoRows {
-					cs.log.Error().Err(err).Msg("Customer not found")
-					return c.JSON(404, map[string]string{"error": "Customer not found"})
-				}
-				cs.log.Error().Err(err).Msg("Failed to retrieve customer")
-				return c.JSON(500, map[string]string{"error": "Failed to retrieve customer"})
+				return err
 			}
-			return c.JSON(200, customer)
-		})
+			return rest.Respond(c, 200, customer)
+		}, rest.Require(auth.PermCustomerRead))
 		e.PUT("/customer/:id", func(c echo.Context) error {
 			idParam := c.Param("id")
 			id, err := uuid.Parse(idParam)
@@ -79,18 +91,18 @@ func (cs *CustomerService) RouteAdder() func(e *echo.Echo) {
 			}
 
 			var updatedCustomer Customer
-			if err := c.Bind(&updatedCustomer); err != nil {
+			if err := rest.Bind(c, &updatedCustomer); err != nil {
 				cs.log.Error().Err(err).Msg("Invalid request body")
-				return c.JSON(400, map[string]string{"error": "Invalid request body"})
+				return err
 			}
 			updatedCustomer.ID = id
 
-			if err := cs.UpdateCustomer(c.Request().Context(), updatedCustomer); err != nil {
-				cs.log.Error().Err(err).Msg("Failed to update customer")
-				return c.JSON(500, map[string]string{"error": "Failed to update customer"})
+			updated, err := cs.update(c.Request().Context(), updatedCustomer)
+			if err != nil {
+				return err
 			}
-			return c.JSON(200, updatedCustomer)
-		})
+			return rest.Respond(c, 200, updated)
+		}, rest.Require(auth.PermCustomerWrite))
 		e.DELETE("/customer/:id", func(c echo.Context) error {
 			idParam := c.Param("id")
 			id, err := uuid.Parse(idParam)
@@ -99,12 +111,13 @@ func (cs *CustomerService) RouteAdder() func(e *echo.Echo) {
 				return c.JSON(400, map[string]string{"error": "Invalid customer ID"})
 			}
 
-			if err := cs.DeleteCustomer(c.Request().Context(), id); err != nil {
-				cs.log.Error().Err(err).Msg("Failed to delete customer")
-				return c.JSON(500, map[string]string{"error": "Failed to delete customer"})
+			if err := cs.remove(c.Request().Context(), id); err != nil {
+				return err
 			}
 			return c.NoContent(204)
-		})
+		}, rest.Require(auth.PermCustomerDelete))
+
+		cs.addExportRoutes(e)
 	}
 }
 
@@ -113,18 +126,41 @@ func (cs *CustomerService) CreateCustomer(ctx context.Context, customer Customer
 		return uuid.Nil, err
 	}
 
+	tx, err := cs.db.BeginTenantTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// tenant_id defaults to the tenant of the transaction
 	id := uuid.New()
-	_, err := cs.db.GetDB().ExecContext(ctx,
+	if _, err := tx.ExecContext(ctx,
 		"insert into customers (id, name, email) values ($1, $2, $3);",
-		id, customer.Name, customer.Email)
-	if err != nil {
+		id, customer.Name, customer.Email); err != nil {
+		return uuid.Nil, err
+	}
+	if err := cs.outbox.Add(ctx, tx, events.CustomerCreated{CustomerID: id, Name: customer.Name, Email: customer.Email}); err != nil {
 		return uuid.Nil, err
 	}
-	return id, nil
+	return id, tx.Commit()
+}
+
+// insertCustomers stores a batch of validated customers for the bulk import.
+func (cs *CustomerService) insertCustomers(ctx context.Context, tx *sqlx.Tx, customers []Customer) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, len(customers))
+	rows := make([][]any, len(customers))
+	for i, customer := range customers {
+		ids[i] = uuid.New()
+		rows[i] = []any{ids[i], customer.Name, customer.Email}
+	}
+	return ids, postgres.InsertRows(ctx, tx, "customers", []string{"id", "name", "email"}, rows)
 }
 
 func (cs *CustomerService) GetCustomerByID(ctx context.Context, id uuid.UUID) (*Customer, error) {
-	return postgres.QueryOne[Customer](ctx, cs.db.GetDB(), "select id, name, email from customers where id=$1", id)
+	return postgres.InTenantResult(ctx, cs.db, func(tx *sqlx.Tx) (*Customer, error) {
+		return postgres.QueryOne[Customer](ctx, tx,
+			"select id, name, email from customers where id=$1 and tenant_id=current_tenant()", id)
+	})
 }
 
 func (cs *CustomerService) UpdateCustomer(ctx context.Context, customer Customer) error {
@@ -132,15 +168,56 @@ func (cs *CustomerService) UpdateCustomer(ctx context.Context, customer Customer
 		return err
 	}
 
-	_, err := cs.db.GetDB().ExecContext(ctx,
-		"update customers set name=$1, email=$2 where id=$3;",
-		customer.Name, customer.Email, customer.ID)
-	return err
+	return cs.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			"update customers set name=$1, email=$2 where id=$3 and tenant_id=current_tenant();",
+			customer.Name, customer.Email, customer.ID)
+		return err
+	})
 }
 
 func (cs *CustomerService) DeleteCustomer(ctx context.Context, id uuid.UUID) error {
-	_, err := cs.db.GetDB().ExecContext(ctx,
-		"delete from customers where id=$1;",
-		id)
-	return err
+	return cs.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			"delete from customers where id=$1 and tenant_id=current_tenant();",
+			id)
+		return err
+	})
+}
+
+// create, get, update and remove back both the REST routes and the RPC methods, so both validate
+// and map errors the same way.
+func (cs *CustomerService) create(ctx context.Context, customer Customer) (*Customer, error) {
+	id, err := cs.CreateCustomer(ctx, customer)
+	if err != nil {
+		cs.log.Error().Err(err).Msg("Failed to create customer")
+		return nil, rest.ServiceError(err, "", "Failed to create customer")
+	}
+	customer.ID = id
+	return &customer, nil
+}
+
+func (cs *CustomerService) get(ctx context.Context, id uuid.UUID) (*Customer, error) {
+	customer, err := cs.GetCustomerByID(ctx, id)
+	if err != nil {
+		cs.log.Error().Err(err).Msg("Failed to retrieve customer")
+		return nil, rest.ServiceError(err, "Customer not found", "Failed to retrieve customer")
+	}
+	return customer, nil
+}
+
+func (cs *CustomerService) update(ctx context.Context, customer Customer) (*Customer, error) {
+	if err := cs.UpdateCustomer(ctx, customer); err != nil {
+		cs.log.Error().Err(err).Msg("Failed to update customer")
+		return nil, rest.ServiceError(err, "", "Failed to update customer")
+	}
+	return &customer, nil
+}
+
+func (cs *CustomerService) remove(ctx context.Context, id uuid.UUID) error {
+	if err := cs.DeleteCustomer(ctx, id); err != nil {
+		cs.log.Error().Err(err).Msg("Failed to delete customer")
+		return rest.ServiceError(err, "", "Failed to delete customer")
+	}
+	return nil
 }
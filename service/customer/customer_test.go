@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
 	test "github.com/romanWienicke/go-app-test/foundation/testing"
 	"github.com/rs/zerolog"
 )
@@ -23,7 +24,7 @@ func TestCustomerService(t *testing.T) {
 		test.DockerComposeDown(t, "../../docker-compose.yaml")
 	})
 
-	ctx := context.Background()
+	ctx := postgres.WithTenant(context.Background(), "default")
 	log := zerolog.Nop()
 	customerService := NewCustomerService(db, &log)
 
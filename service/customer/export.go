@@ -0,0 +1,69 @@
+package customer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/rest"
+)
+
+// ExportFilter narrows an export by creation date, zero values do not filter. To is exclusive.
+type ExportFilter struct {
+	From time.Time
+	To   time.Time
+}
+
+// ExportedCustomer is a customer of the export including its creation date.
+type ExportedCustomer struct {
+	ID        uuid.UUID `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	Email     string    `db:"email" json:"email"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+func (cs *CustomerService) addExportRoutes(e *echo.Echo) {
+	e.GET("/customer/export", func(c echo.Context) error {
+		format, err := rest.ExportFormat(c)
+		if err != nil {
+			return err
+		}
+		var filter ExportFilter
+		if filter.From, err = rest.QueryTime(c, "from"); err != nil {
+			return err
+		}
+		if filter.To, err = rest.QueryTime(c, "to"); err != nil {
+			return err
+		}
+
+		return rest.Export(c, format, cs.log, func(ctx context.Context, emit func(ExportedCustomer) error) error {
+			return cs.ExportCustomers(ctx, filter, emit)
+		})
+	}, rest.Require(auth.PermCustomerRead))
+}
+
+// ExportCustomers streams the matching customers, oldest first.
+func (cs *CustomerService) ExportCustomers(ctx context.Context, filter ExportFilter, emit func(ExportedCustomer) error) error {
+	conditions := []string{"tenant_id = current_tenant()"}
+	var args []any
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+
+	query := "select id, name, email, coalesce(created_at, 'epoch') as created_at from customers where " +
+		strings.Join(conditions, " and ") + " order by created_at, id"
+	return cs.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		return postgres.StreamRows(ctx, tx, postgres.DefaultFetchSize, emit, query, args...)
+	})
+}
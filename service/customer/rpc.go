@@ -0,0 +1,49 @@
+package customer
+
+import (
+	"encoding/json"
+
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/rest"
+)
+
+// RPCMethods exposes the customer operations as JSON-RPC methods customer.create, customer.get, customer.update
+// and customer.delete.
+func (cs *CustomerService) RPCMethods() map[string]rest.RPCMethod {
+	return map[string]rest.RPCMethod{
+		"customer.create": {Permission: auth.PermCustomerWrite, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			customer, err := rest.RPCParams[Customer](params)
+			if err != nil {
+				return nil, err
+			}
+			return cs.create(c.Request().Context(), customer)
+		}},
+		"customer.get": {Permission: auth.PermCustomerRead, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			id, err := rest.RPCID(params, "Invalid customer ID")
+			if err != nil {
+				return nil, err
+			}
+			return cs.get(c.Request().Context(), id)
+		}},
+		"customer.update": {Permission: auth.PermCustomerWrite, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			id, err := rest.RPCID(params, "Invalid customer ID")
+			if err != nil {
+				return nil, err
+			}
+			customer, err := rest.RPCParams[Customer](params)
+			if err != nil {
+				return nil, err
+			}
+			customer.ID = id
+			return cs.update(c.Request().Context(), customer)
+		}},
+		"customer.delete": {Permission: auth.PermCustomerDelete, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			id, err := rest.RPCID(params, "Invalid customer ID")
+			if err != nil {
+				return nil, err
+			}
+			return nil, cs.remove(c.Request().Context(), id)
+		}},
+	}
+}
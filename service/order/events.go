@@ -0,0 +1,253 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/rest"
+)
+
+const (
+	// eventName is the SSE event type of status changes.
+	eventName = "order.status"
+	// eventReplayPage is the number of logged events read at once when a client resumes.
+	eventReplayPage = 500
+	// subscriberBuffer is the number of events a subscriber may lag behind before it is dropped.
+	subscriberBuffer = 64
+)
+
+// ErrTooManySubscribers is returned when the subscriber cap is reached.
+var ErrTooManySubscribers = errors.New("too many event subscribers")
+
+// OrderEvent is a logged status change of an order.
+type OrderEvent struct {
+	ID             int64     `db:"id" json:"id"`
+	OrderID        uuid.UUID `db:"order_id" json:"order_id"`
+	CustomerID     uuid.UUID `db:"customer_id" json:"customer_id"`
+	Status         string    `db:"status" json:"status"`
+	PreviousStatus string    `db:"previous_status" json:"previous_status"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	TenantID       string    `db:"tenant_id" json:"-"`
+}
+
+// EventConfig configures the order event streams.
+type EventConfig struct {
+	// MaxSubscribers caps the concurrent streams of this instance, 100 by default.
+	MaxSubscribers int
+	// Heartbeat is the interval of keep-alive comments on idle streams, 15s by default.
+	Heartbeat time.Duration
+}
+
+func (cfg EventConfig) withDefaults() EventConfig {
+	if cfg.MaxSubscribers <= 0 {
+		cfg.MaxSubscribers = 100
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = 15 * time.Second
+	}
+	return cfg
+}
+
+// eventFilter selects the events of a tenant, of one order or of one customer; zero IDs match all.
+type eventFilter struct {
+	TenantID   string
+	OrderID    uuid.UUID
+	CustomerID uuid.UUID
+}
+
+func (f eventFilter) match(e OrderEvent) bool {
+	return e.TenantID == f.TenantID &&
+		(f.OrderID == uuid.Nil || e.OrderID == f.OrderID) &&
+		(f.CustomerID == uuid.Nil || e.CustomerID == f.CustomerID)
+}
+
+type subscriber struct {
+	filter eventFilter
+	events chan OrderEvent
+}
+
+// eventHub fans status changes out to the streams of this instance.
+type eventHub struct {
+	mu             sync.Mutex
+	maxSubscribers int
+	subscribers    map[*subscriber]struct{}
+}
+
+func newEventHub(maxSubscribers int) *eventHub {
+	return &eventHub{maxSubscribers: maxSubscribers, subscribers: map[*subscriber]struct{}{}}
+}
+
+func (h *eventHub) subscribe(filter eventFilter) (*subscriber, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subscribers) >= h.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	s := &subscriber{filter: filter, events: make(chan OrderEvent, subscriberBuffer)}
+	h.subscribers[s] = struct{}{}
+	return s, nil
+}
+
+func (h *eventHub) unsubscribe(s *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
+
+// publish never blocks: a subscriber that fell behind is dropped, its stream ends and the client
+// resumes from the event log with Last-Event-ID.
+func (h *eventHub) publish(e OrderEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subscribers {
+		if !s.filter.match(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			delete(h.subscribers, s)
+			close(s.events)
+		}
+	}
+}
+
+// ConfigureEvents sets the subscriber cap and heartbeat of the event streams.
+func (o *OrderService) ConfigureEvents(cfg EventConfig) {
+	o.eventCfg = cfg.withDefaults()
+	o.events = newEventHub(o.eventCfg.MaxSubscribers)
+}
+
+func (o *OrderService) addEventRoutes(e *echo.Echo) {
+	e.GET("/order/events", func(c echo.Context) error {
+		var filter eventFilter
+		if id := c.QueryParam("customer_id"); id != "" {
+			customerID, err := uuid.Parse(id)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid query parameter customer_id")
+			}
+			filter.CustomerID = customerID
+		}
+		return o.streamEvents(c, filter)
+	}, rest.Require(auth.PermOrderRead))
+
+	e.GET("/order/:id/events", func(c echo.Context) error {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid order ID")
+		}
+		if _, err := o.get(c.Request().Context(), id); err != nil {
+			return err
+		}
+		return o.streamEvents(c, eventFilter{OrderID: id})
+	}, rest.Require(auth.PermOrderRead))
+}
+
+// streamEvents sends the events logged after Last-Event-ID, then live events and heartbeats
+// until the client goes away. The subscription starts before the replay, so no event falls in
+// between; events sent in the replay are skipped when they arrive live. IDs are not compared
+// otherwise, as events commit out of ID order and a lower ID may arrive after a higher one.
+func (o *OrderService) streamEvents(c echo.Context, filter eventFilter) error {
+	lastID, resume, err := rest.LastEventID(c)
+	if err != nil {
+		return err
+	}
+	filter.TenantID, _ = postgres.TenantFromContext(c.Request().Context())
+
+	sub, err := o.events.subscribe(filter)
+	if err != nil {
+		c.Response().Header().Set(echo.HeaderRetryAfter, "5")
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Too many event subscribers").SetInternal(err)
+	}
+	defer o.events.unsubscribe(sub)
+
+	ctx := c.Request().Context()
+	var replay []OrderEvent
+	if resume {
+		if replay, err = o.eventsAfter(ctx, filter, lastID, eventReplayPage); err != nil {
+			o.log.Error().Err(err).Msg("Failed to read order events")
+			return rest.ServiceError(err, "", "Failed to read order events")
+		}
+	}
+
+	stream := rest.NewEventStream(c)
+	send := func(e OrderEvent) error {
+		return stream.Send(strconv.FormatInt(e.ID, 10), eventName, e)
+	}
+	replayed := map[int64]struct{}{}
+	for len(replay) > 0 {
+		for _, e := range replay {
+			if err := send(e); err != nil {
+				return nil
+			}
+			replayed[e.ID] = struct{}{}
+			lastID = e.ID
+		}
+		if len(replay) < eventReplayPage {
+			break
+		}
+		if replay, err = o.eventsAfter(ctx, filter, lastID, eventReplayPage); err != nil {
+			// the client resumes from the last event it got
+			o.log.Error().Err(err).Msg("Failed to read order events")
+			return nil
+		}
+	}
+
+	heartbeat := time.NewTicker(o.eventCfg.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-sub.events:
+			if !ok {
+				// dropped for lagging behind
+				return nil
+			}
+			if _, ok := replayed[e.ID]; ok {
+				delete(replayed, e.ID)
+				continue
+			}
+			if err := send(e); err != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if err := stream.Heartbeat(); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// eventsAfter returns up to limit logged events with an ID above lastID, oldest first.
+func (o *OrderService) eventsAfter(ctx context.Context, filter eventFilter, lastID int64, limit int) ([]OrderEvent, error) {
+	query := `select id, order_id, customer_id, status, previous_status, created_at, tenant_id from order_events
+		where tenant_id = current_tenant() and id > $1`
+	args := []any{lastID}
+	if filter.OrderID != uuid.Nil {
+		args = append(args, filter.OrderID)
+		query += fmt.Sprintf(" and order_id = $%d", len(args))
+	}
+	if filter.CustomerID != uuid.Nil {
+		args = append(args, filter.CustomerID)
+		query += fmt.Sprintf(" and customer_id = $%d", len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" order by id limit $%d", len(args))
+	return postgres.InTenantResult(ctx, o.db, func(tx *sqlx.Tx) ([]OrderEvent, error) {
+		return postgres.QueryList[OrderEvent](ctx, tx, query, args...)
+	})
+}
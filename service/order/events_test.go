@@ -0,0 +1,121 @@
+package order
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/rest"
+	"github.com/rs/zerolog"
+)
+
+func TestEventHub(t *testing.T) {
+	hub := newEventHub(2)
+	customerID := uuid.New()
+
+	mine, err := hub.subscribe(eventFilter{CustomerID: customerID})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	all, err := hub.subscribe(eventFilter{})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if _, err := hub.subscribe(eventFilter{}); !errors.Is(err, ErrTooManySubscribers) {
+		t.Fatalf("expected the subscriber cap, got %v", err)
+	}
+
+	// events of other tenants are never delivered
+	hub.publish(OrderEvent{ID: 1, TenantID: "other", CustomerID: customerID})
+	hub.publish(OrderEvent{ID: 1, CustomerID: uuid.New()})
+	hub.publish(OrderEvent{ID: 2, CustomerID: customerID})
+	if e := <-mine.events; e.ID != 2 {
+		t.Errorf("expected only the customer's event, got %d", e.ID)
+	}
+	if len(all.events) != 2 {
+		t.Errorf("expected both events, got %d", len(all.events))
+	}
+
+	// a subscriber lagging behind is dropped instead of blocking the publisher
+	for i := range subscriberBuffer + 1 {
+		hub.publish(OrderEvent{ID: int64(3 + i), CustomerID: customerID})
+	}
+	for range all.events {
+	}
+	hub.unsubscribe(all)
+	if _, err := hub.subscribe(eventFilter{}); err != nil {
+		t.Errorf("expected the dropped subscriber to free its slot: %v", err)
+	}
+	hub.unsubscribe(mine)
+}
+
+func TestStreamEvents(t *testing.T) {
+	log := zerolog.Nop()
+	o := NewOrderService(nil, &log)
+	o.ConfigureEvents(EventConfig{MaxSubscribers: 1, Heartbeat: 20 * time.Millisecond})
+	customerID := uuid.New()
+
+	e := echo.New()
+	e.HTTPErrorHandler = rest.NewErrorHandler(&log)
+	e.GET("/order/events", func(c echo.Context) error {
+		return o.streamEvents(c, eventFilter{CustomerID: customerID})
+	})
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/order/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.Header.Get(echo.HeaderContentType) != rest.MIMETextEventStream {
+		t.Fatalf("unexpected content type %s", res.Header.Get(echo.HeaderContentType))
+	}
+
+	second, err := http.Get(server.URL + "/order/events")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	_ = second.Body.Close()
+	if second.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the subscriber cap to answer 503, got %d", second.StatusCode)
+	}
+
+	o.events.publish(OrderEvent{ID: 7, CustomerID: customerID, Status: "shipped", PreviousStatus: "pending"})
+	// a transaction that got its ID earlier may commit later, its event must not be skipped
+	o.events.publish(OrderEvent{ID: 5, CustomerID: customerID, Status: "paid", PreviousStatus: "pending"})
+
+	lines := bufio.NewScanner(res.Body)
+	var got []string
+	heartbeat := false
+	for (len(got) < 6 || !heartbeat) && lines.Scan() {
+		switch line := lines.Text(); {
+		case line == ": heartbeat":
+			heartbeat = true
+		case line != "":
+			got = append(got, line)
+		}
+	}
+	want := []string{"id: 7", "event: order.status", `data: {"id":7,`, "id: 5", "event: order.status", `data: {"id":5,`}
+	for i, prefix := range want {
+		if i >= len(got) || !strings.HasPrefix(got[i], prefix) {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+	if !heartbeat {
+		t.Error("expected a heartbeat on the idle stream")
+	}
+}
@@ -0,0 +1,148 @@
+package order
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/money"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/rest"
+)
+
+// ExportFilter narrows an export, zero values do not filter. To is exclusive.
+type ExportFilter struct {
+	From       time.Time
+	To         time.Time
+	Status     string
+	CustomerID uuid.UUID
+}
+
+// ExportedOrder is an order of the NDJSON export.
+type ExportedOrder struct {
+	ID         uuid.UUID     `db:"id" json:"id"`
+	CustomerID uuid.UUID     `db:"customer_id" json:"customer_id"`
+	Status     string        `db:"status" json:"status"`
+	Total      money.Money   `db:"total" json:"total"`
+	OrderDate  time.Time     `db:"order_date" json:"order_date"`
+	Items      exportedItems `db:"items" json:"items"`
+}
+
+// exportedItems scans the items aggregated as JSON by the export query.
+type exportedItems []OrderItem
+
+func (i *exportedItems) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, i)
+	case string:
+		return json.Unmarshal([]byte(v), i)
+	}
+	return fmt.Errorf("cannot scan %T into order items", src)
+}
+
+// ExportedOrderLine is a row of the CSV export, one per order item. Orders without items have a
+// single row with empty item columns.
+type ExportedOrderLine struct {
+	OrderID    uuid.UUID   `db:"order_id" json:"order_id"`
+	CustomerID uuid.UUID   `db:"customer_id" json:"customer_id"`
+	Status     string      `db:"status" json:"status"`
+	Total      money.Money `db:"total" json:"total"`
+	OrderDate  time.Time   `db:"order_date" json:"order_date"`
+	ItemID     *uuid.UUID  `db:"item_id" json:"item_id"`
+	ProductID  *uuid.UUID  `db:"product_id" json:"product_id"`
+	Quantity   *float32    `db:"quantity" json:"quantity"`
+}
+
+func (o *OrderService) addExportRoutes(e *echo.Echo) {
+	e.GET("/order/export", func(c echo.Context) error {
+		format, err := rest.ExportFormat(c)
+		if err != nil {
+			return err
+		}
+		filter, err := parseExportFilter(c)
+		if err != nil {
+			return err
+		}
+
+		if format == rest.MIMETextCSV {
+			return rest.Export(c, format, o.log, func(ctx context.Context, emit func(ExportedOrderLine) error) error {
+				return o.ExportOrderLines(ctx, filter, emit)
+			})
+		}
+		return rest.Export(c, format, o.log, func(ctx context.Context, emit func(ExportedOrder) error) error {
+			return o.ExportOrders(ctx, filter, emit)
+		})
+	}, rest.Require(auth.PermOrderRead))
+}
+
+func parseExportFilter(c echo.Context) (ExportFilter, error) {
+	var filter ExportFilter
+	var err error
+	if filter.From, err = rest.QueryTime(c, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = rest.QueryTime(c, "to"); err != nil {
+		return filter, err
+	}
+	filter.Status = c.QueryParam("status")
+	if id := c.QueryParam("customer_id"); id != "" {
+		if filter.CustomerID, err = uuid.Parse(id); err != nil {
+			return filter, echo.NewHTTPError(400, "Invalid query parameter customer_id")
+		}
+	}
+	return filter, nil
+}
+
+// where renders the filter as a where clause on the orders table aliased as o.
+func (f ExportFilter) where() (string, []any) {
+	conditions := []string{"o.tenant_id = current_tenant()"}
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if !f.From.IsZero() {
+		add("o.order_date >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("o.order_date < $%d", f.To)
+	}
+	if f.Status != "" {
+		add("o.status = $%d", f.Status)
+	}
+	if f.CustomerID != uuid.Nil {
+		add("o.customer_id = $%d", f.CustomerID)
+	}
+	return " where " + strings.Join(conditions, " and "), args
+}
+
+// ExportOrders streams the matching orders including their items, oldest first.
+func (o *OrderService) ExportOrders(ctx context.Context, filter ExportFilter, emit func(ExportedOrder) error) error {
+	where, args := filter.where()
+	query := `select o.id, o.customer_id, o.status, o.total, o.currency as "total.currency", o.order_date,
+		(select coalesce(json_agg(json_build_object('id', i.id, 'order_id', i.order_id, 'product_id', i.product_id, 'quantity', i.quantity) order by i.id), '[]')
+			from order_items i where i.order_id = o.id and i.tenant_id = o.tenant_id) as items
+		from orders o` + where + " order by o.order_date, o.id"
+	return o.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		return postgres.StreamRows(ctx, tx, postgres.DefaultFetchSize, emit, query, args...)
+	})
+}
+
+// ExportOrderLines streams a row per item of the matching orders, oldest order first.
+func (o *OrderService) ExportOrderLines(ctx context.Context, filter ExportFilter, emit func(ExportedOrderLine) error) error {
+	where, args := filter.where()
+	query := `select o.id as order_id, o.customer_id, o.status, o.total, o.currency as "total.currency", o.order_date,
+		i.id as item_id, i.product_id, i.quantity
+		from orders o left join order_items i on i.order_id = o.id and i.tenant_id = o.tenant_id` + where + " order by o.order_date, o.id, i.id"
+	return o.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		return postgres.StreamRows(ctx, tx, postgres.DefaultFetchSize, emit, query, args...)
+	})
+}
@@ -2,32 +2,107 @@ package order
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/romanWienicke/go-app-test/events"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/money"
 	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/outbox"
+	"github.com/romanWienicke/go-app-test/rest"
 	"github.com/rs/zerolog"
 )
 
 type Order struct {
-	ID         uuid.UUID   `db:"id" json:"id" validate:"omitempty,uuid4"`
-	CustomerID uuid.UUID   `db:"customer_id" json:"customer_id" validate:"required,uuid4"`
-	Status     string      `db:"status" json:"status" validate:"required"`
-	Total      float64     `db:"total" json:"total" validate:"required,gt=0"`
-	Items      []OrderItem `db:"items" json:"items" validate:"required"`
+	ID         uuid.UUID   `db:"id" json:"id" xml:"id" validate:"omitempty,uuid4"`
+	CustomerID uuid.UUID   `db:"customer_id" json:"customer_id" xml:"customer_id" validate:"required,uuid4"`
+	Status     string      `db:"status" json:"status" xml:"status" validate:"required"`
+	Total      money.Money `db:"total" json:"total" xml:"total"`
+	Items      []OrderItem `db:"items" json:"items" xml:"items>item" validate:"required"`
 }
 
 func Validate(o Order) error {
 	validator := validator.New()
-	return validator.Struct(o)
+	if err := validator.Struct(o); err != nil {
+		return err
+	}
+	if !o.Total.IsPositive() {
+		return fmt.Errorf("%w: total has to be positive", money.ErrInvalidAmount)
+	}
+	return o.Total.Validate()
+}
+
+// orderColumns selects an Order without items, the currency of the total has a column of its own.
+const orderColumns = `id, customer_id, status, total, currency as "total.currency"`
+
+// checkTotal verifies the order total against the current prices of the items' products. It fails
+// with money.ErrCurrencyMismatch if one of the products is priced in another currency than the
+// total, and with money.ErrInvalidAmount if the total differs from the sum of the items. Products
+// that don't exist are left to the foreign key of the items.
+func checkTotal(ctx context.Context, tx *sqlx.Tx, total money.Money, items []OrderItem) error {
+	var products []struct {
+		ID    uuid.UUID   `db:"id"`
+		Price money.Money `db:"price"`
+	}
+	if err := tx.SelectContext(ctx, &products,
+		`select id, price, currency as "price.currency" from products where tenant_id=current_tenant() and id = any($1)`,
+		pq.Array(productIDs(items))); err != nil {
+		return err
+	}
+	prices := make(map[uuid.UUID]money.Money, len(products))
+	for _, product := range products {
+		if product.Price.Currency != total.Currency {
+			return fmt.Errorf("%w: product %s is priced in %s, the order in %s",
+				money.ErrCurrencyMismatch, product.ID, product.Price.Currency, total.Currency)
+		}
+		prices[product.ID] = product.Price
+	}
+
+	sum := money.New(0, total.Currency)
+	for _, item := range items {
+		price, ok := prices[item.ProductID]
+		if !ok {
+			return nil
+		}
+		quantity := int64(item.Quantity)
+		if float32(quantity) != item.Quantity {
+			return fmt.Errorf("%w: quantity %v of product %s is not a whole number", money.ErrInvalidAmount, item.Quantity, item.ProductID)
+		}
+		amount, err := price.Mul(quantity)
+		if err != nil {
+			return err
+		}
+		if sum, err = sum.Add(amount); err != nil {
+			return err
+		}
+	}
+	if sum != total {
+		return fmt.Errorf("%w: total %s, the items come to %s", money.ErrInvalidAmount, total, sum)
+	}
+	return nil
+}
+
+func productIDs(items []OrderItem) []uuid.UUID {
+	ids := make([]uuid.UUID, len(items))
+	for i, item := range items {
+		ids[i] = item.ProductID
+	}
+	return ids
 }
 
 type OrderItem struct {
-	ID        uuid.UUID `db:"id" json:"id" validate:"omitempty,uuid4"`
-	OrderID   uuid.UUID `db:"order_id" json:"order_id" validate:"required,uuid4"`
-	ProductID uuid.UUID `db:"product_id" json:"product_id" validate:"required,uuid4"`
-	Quantity  float32   `db:"quantity" json:"quantity" validate:"required,gt=0"`
+	ID        uuid.UUID `db:"id" json:"id" xml:"id" validate:"omitempty,uuid4"`
+	OrderID   uuid.UUID `db:"order_id" json:"order_id" xml:"order_id" validate:"required,uuid4"`
+	ProductID uuid.UUID `db:"product_id" json:"product_id" xml:"product_id" validate:"required,uuid4"`
+	Quantity  float32   `db:"quantity" json:"quantity" xml:"quantity" validate:"required,gt=0"`
 }
 
 func ValidateItem(oi OrderItem) error {
@@ -35,36 +110,118 @@ func ValidateItem(oi OrderItem) error {
 	return validator.Struct(oi)
 }
 
+// validateBulk checks an imported order including its items, which have no order ID yet.
+func validateBulk(o Order) error {
+	if err := Validate(o); err != nil {
+		return err
+	}
+	validator := validator.New()
+	for _, item := range o.Items {
+		if err := validator.StructExcept(item, "OrderID"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrMissingIdempotencyKey is returned by CreateOrderOnce without key.
+var ErrMissingIdempotencyKey = errors.New("missing idempotency key")
+
+// ChangesChannel is the NOTIFY channel receiving the ID and tenant of every order inserted, updated
+// or deleted, or whose items changed, see postgres.Db.Listen and postgres.Change.
+const ChangesChannel = "orders_changed"
+
+// Event types passed to the Notifier.
+const (
+	EventCreated = "order.created"
+	EventUpdated = "order.updated"
+)
+
+// Notifier is told about created and updated orders, e.g. to call partner webhooks. Notify
+// stores the notification in the transaction of the order, so it is sent only once the order is
+// committed and never lost after that, like the events of the outbox.
+type Notifier interface {
+	Notify(ctx context.Context, tx sqlx.ExtContext, eventType string, data any) error
+}
+
 type OrderService struct {
-	db  *postgres.Db
-	log *zerolog.Logger
+	db       *postgres.Db
+	log      *zerolog.Logger
+	eventCfg EventConfig
+	events   *eventHub
+	notifier Notifier
+	outbox   *outbox.Outbox
 }
 
+// defaultListLimit and maxListLimit bound the page size of order listings.
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
 func NewOrderService(db *postgres.Db, log *zerolog.Logger) *OrderService {
-	return &OrderService{
+	o := &OrderService{
 		db:  db,
 		log: log,
 	}
+	o.ConfigureEvents(EventConfig{})
+	return o
+}
+
+// SetNotifier sets the notifier of created and updated orders. Bulk imports don't notify.
+func (o *OrderService) SetNotifier(n Notifier) {
+	o.notifier = n
+}
+
+// SetOutbox sets the outbox order events are stored in. Bulk imports don't publish events.
+func (o *OrderService) SetOutbox(ob *outbox.Outbox) {
+	o.outbox = ob
+}
+
+// notify tells the notifier about an order within tx, a failure fails the change of the order.
+func (o *OrderService) notify(ctx context.Context, tx sqlx.ExtContext, eventType string, order Order) error {
+	if o.notifier == nil {
+		return nil
+	}
+	return o.notifier.Notify(ctx, tx, eventType, order)
 }
 
 func (o *OrderService) RouteAdder() func(e *echo.Echo) {
 	return func(e *echo.Echo) {
 		e.POST("/order", func(c echo.Context) error {
 			var newOrder Order
-			if err := c.Bind(&newOrder); err != nil {
+			if err := rest.Bind(c, &newOrder); err != nil {
 				o.log.Error().Err(err).Msg("Failed to bind order")
-				return c.JSON(400, map[string]string{"error": "Invalid request body"})
+				return err
+			}
+
+			created, err := o.create(c.Request().Context(), newOrder)
+			if err != nil {
+				return err
 			}
+			return rest.Respond(c, 201, created)
+		}, rest.Require(auth.PermOrderWrite))
 
-			id, err := o.CreateOrder(c.Request().Context(), newOrder)
+		e.POST("/order\\:bulk", rest.Bulk(rest.BulkConfig[Order]{
+			DB:       o.db,
+			Validate: validateBulk,
+			Insert:   o.insertOrders,
+		}, o.log), rest.Require(auth.PermOrderWrite))
+
+		e.GET("/order", func(c echo.Context) error {
+			limit, offset := defaultListLimit, 0
+			err := echo.QueryParamsBinder(c).Int("limit", &limit).Int("offset", &offset).BindError()
 			if err != nil {
-				o.log.Error().Err(err).Msg("Failed to create order")
-				return c.JSON(500, map[string]string{"error": "Failed to create order"})
+				o.log.Error().Err(err).Msg("Invalid paging parameters")
+				return c.JSON(400, map[string]string{"error": "Invalid paging parameters"})
 			}
 
-			newOrder.ID = id
-			return c.JSON(201, newOrder)
-		})
+			orders, err := o.list(c.Request().Context(), limit, offset)
+			if err != nil {
+				return err
+			}
+			return rest.Respond(c, 200, orders)
+		}, rest.Require(auth.PermOrderRead))
 
 		e.GET("/order/:id", func(c echo.Context) error {
 			idParam := c.Param("id")
@@ -74,17 +231,12 @@ func (o *OrderService) RouteAdder() func(e *echo.Echo) {
 				return c.JSON(400, map[string]string{"error": "Invalid order ID"})
 			}
 
-			order, err := o.GetOrderByID(c.Request().Context(), id)
+			order, err := o.get(c.Request().Context(), id)
 			if err != nil {
-				if err == postgres.ErrNoRows {
-					o.log.Error().Err(err).Msg("Order not found")
-					return c.JSON(404, map[string]string{"error": "Order not found"})
-				}
-				o.log.Error().Err(err).Msg("Failed to retrieve order")
-				return c.JSON(500, map[string]string{"error": "Failed to retrieve order"})
+				return err
 			}
-			return c.JSON(200, order)
-		})
+			return rest.Respond(c, 200, order)
+		}, rest.Require(auth.PermOrderRead))
 
 		e.PUT("/order/:id", func(c echo.Context) error {
 			idParam := c.Param("id")
@@ -95,18 +247,18 @@ func (o *OrderService) RouteAdder() func(e *echo.Echo) {
 			}
 
 			var updatedOrder Order
-			if err := c.Bind(&updatedOrder); err != nil {
+			if err := rest.Bind(c, &updatedOrder); err != nil {
 				o.log.Error().Err(err).Msg("Invalid request body")
-				return c.JSON(400, map[string]string{"error": "Invalid request body"})
+				return err
 			}
 			updatedOrder.ID = id
 
-			if err := o.UpdateOrder(c.Request().Context(), updatedOrder); err != nil {
-				o.log.Error().Err(err).Msg("Failed to update order")
-				return c.JSON(500, map[string]string{"error": "Failed to update order"})
+			updated, err := o.update(c.Request().Context(), updatedOrder)
+			if err != nil {
+				return err
 			}
-			return c.JSON(200, updatedOrder)
-		})
+			return rest.Respond(c, 200, updated)
+		}, rest.Require(auth.PermOrderWrite))
 		e.DELETE("/order/:id", func(c echo.Context) error {
 			idParam := c.Param("id")
 			id, err := uuid.Parse(idParam)
@@ -115,88 +267,319 @@ func (o *OrderService) RouteAdder() func(e *echo.Echo) {
 				return c.JSON(400, map[string]string{"error": "Invalid order ID"})
 			}
 
-			if err := o.DeleteOrder(c.Request().Context(), id); err != nil {
-				o.log.Error().Err(err).Msg("Failed to delete order")
-				return c.JSON(500, map[string]string{"error": "Failed to delete order"})
+			if err := o.remove(c.Request().Context(), id); err != nil {
+				return err
 			}
 			return c.NoContent(204)
-		})
+		}, rest.Require(auth.PermOrderDelete))
+
+		o.addExportRoutes(e)
+		o.addEventRoutes(e)
 	}
 }
 
 func (o *OrderService) CreateOrder(ctx context.Context, order Order) (uuid.UUID, error) {
-	if err := Validate(order); err != nil {
-		return uuid.Nil, err
+	id, _, err := o.createOrder(ctx, "", order)
+	return id, err
+}
+
+// CreateOrderOnce creates the order once per idempotency key, like the key of a partner's
+// message. It returns the ID of the order and whether it was created now; a repeated key returns
+// the order created first.
+func (o *OrderService) CreateOrderOnce(ctx context.Context, key string, order Order) (uuid.UUID, bool, error) {
+	if key == "" {
+		return uuid.Nil, false, ErrMissingIdempotencyKey
 	}
+	return o.createOrder(ctx, key, order)
+}
 
-	id := uuid.New()
-	_, err := o.db.GetDB().ExecContext(ctx,
-		"insert into orders (id, customer_id, status, total) values ($1, $2, $3, $4);",
-		id, order.CustomerID, order.Status, order.Total)
-	if err != nil {
-		return uuid.Nil, err
+func (o *OrderService) createOrder(ctx context.Context, key string, order Order) (uuid.UUID, bool, error) {
+	if err := Validate(order); err != nil {
+		return uuid.Nil, false, err
 	}
 
+	id := uuid.New()
 	for _, item := range order.Items {
 		item.OrderID = id
 		if err := ValidateItem(item); err != nil {
-			return uuid.Nil, err
+			return uuid.Nil, false, err
 		}
+	}
+
+	tx, err := o.db.BeginTenantTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := checkTotal(ctx, tx, order.Total, order.Items); err != nil {
+		return uuid.Nil, false, err
+	}
+
+	if key != "" {
+		// a concurrent insert of the same key waits for the other transaction and then conflicts
+		res, err := tx.ExecContext(ctx,
+			"insert into order_idempotency_keys (key, order_id) values ($1, $2) on conflict (tenant_id, key) do nothing;", key, id)
+		if err != nil {
+			return uuid.Nil, false, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return uuid.Nil, false, err
+		}
+		if n == 0 {
+			var existing uuid.UUID
+			err := tx.GetContext(ctx, &existing, "select order_id from order_idempotency_keys where tenant_id=current_tenant() and key=$1;", key)
+			return existing, false, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"insert into orders (id, customer_id, status, total, currency) values ($1, $2, $3, $4, $5);",
+		id, order.CustomerID, order.Status, order.Total, order.Total.Currency); err != nil {
+		return uuid.Nil, false, err
+	}
+
+	created := events.OrderCreated{OrderID: id, CustomerID: order.CustomerID, Status: order.Status, Total: order.Total}
+	for _, item := range order.Items {
 		itemID := uuid.New()
-		_, err := o.db.GetDB().ExecContext(ctx,
+		if _, err := tx.ExecContext(ctx,
 			"insert into order_items (id, order_id, product_id, quantity) values ($1, $2, $3, $4);",
-			itemID, id, item.ProductID, item.Quantity)
-		if err != nil {
-			return uuid.Nil, err
+			itemID, id, item.ProductID, item.Quantity); err != nil {
+			return uuid.Nil, false, err
+		}
+		created.Items = append(created.Items, events.OrderCreatedItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+	if err := o.outbox.Add(ctx, tx, created); err != nil {
+		return uuid.Nil, false, err
+	}
+	order.ID = id
+	if err := o.notify(ctx, tx, EventCreated, order); err != nil {
+		return uuid.Nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, false, err
+	}
+	return id, true, nil
+}
+
+// insertOrders stores a batch of validated orders and their items for the bulk import.
+func (o *OrderService) insertOrders(ctx context.Context, tx *sqlx.Tx, orders []Order) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, len(orders))
+	rows := make([][]any, len(orders))
+	var itemRows [][]any
+	for i, order := range orders {
+		if err := checkTotal(ctx, tx, order.Total, order.Items); err != nil {
+			return nil, err
+		}
+		ids[i] = uuid.New()
+		rows[i] = []any{ids[i], order.CustomerID, order.Status, order.Total, order.Total.Currency}
+		for _, item := range order.Items {
+			itemRows = append(itemRows, []any{uuid.New(), ids[i], item.ProductID, item.Quantity})
 		}
 	}
 
-	return id, nil
+	if err := postgres.InsertRows(ctx, tx, "orders", []string{"id", "customer_id", "status", "total", "currency"}, rows); err != nil {
+		return nil, err
+	}
+	return ids, postgres.InsertRows(ctx, tx, "order_items", []string{"id", "order_id", "product_id", "quantity"}, itemRows)
 }
 
 func (o *OrderService) GetOrderByID(ctx context.Context, id uuid.UUID) (*Order, error) {
-	order, err := postgres.QueryOne[Order](ctx, o.db.GetDB(), "select id, customer_id, status, total from orders where id=$1", id)
+	return postgres.InTenantResult(ctx, o.db, func(tx *sqlx.Tx) (*Order, error) {
+		order, err := postgres.QueryOne[Order](ctx, tx,
+			"select "+orderColumns+" from orders where id=$1 and tenant_id=current_tenant()", id)
+		if err != nil {
+			return nil, err
+		}
+
+		items, err := postgres.QueryList[OrderItem](ctx, tx,
+			"select id, order_id, product_id, quantity from order_items where order_id=$1 and tenant_id=current_tenant()", id)
+		if err != nil {
+			return nil, err
+		}
+		order.Items = items
+		return order, nil
+	})
+}
+
+// ListOrders returns a page of orders including their items, oldest first.
+func (o *OrderService) ListOrders(ctx context.Context, limit, offset int) ([]Order, error) {
+	return postgres.InTenantResult(ctx, o.db, func(tx *sqlx.Tx) ([]Order, error) {
+		return listOrders(ctx, tx, limit, offset)
+	})
+}
+
+func listOrders(ctx context.Context, tx *sqlx.Tx, limit, offset int) ([]Order, error) {
+	orders, err := postgres.QueryList[Order](ctx, tx,
+		"select "+orderColumns+" from orders where tenant_id=current_tenant() order by order_date, id limit $1 offset $2",
+		limit, offset)
 	if err != nil {
 		return nil, err
 	}
+	if len(orders) == 0 {
+		return []Order{}, nil
+	}
 
-	items, err := postgres.QueryList[OrderItem](ctx, o.db.GetDB(), "select id, order_id, product_id, quantity from order_items where order_id=$1", id)
+	ids := make([]uuid.UUID, len(orders))
+	byID := make(map[uuid.UUID]*Order, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].ID
+		orders[i].Items = []OrderItem{}
+		byID[orders[i].ID] = &orders[i]
+	}
+
+	items, err := postgres.QueryList[OrderItem](ctx, tx,
+		"select id, order_id, product_id, quantity from order_items where tenant_id=current_tenant() and order_id = any($1)",
+		pq.Array(ids))
 	if err != nil {
 		return nil, err
 	}
-	order.Items = items
-	return order, nil
+	for _, item := range items {
+		byID[item.OrderID].Items = append(byID[item.OrderID].Items, item)
+	}
+	return orders, nil
 }
 
+// UpdateOrder stores the order and its item quantities, whose current prices have to add up to the
+// total. A status change is logged as an order
+// event and stored as OrderStatusChanged in the outbox in the same transaction, and published to
+// the event streams once committed; the notifier is told about every update in the transaction.
 func (o *OrderService) UpdateOrder(ctx context.Context, order Order) error {
 	if err := Validate(order); err != nil {
 		return err
 	}
-
-	_, err := o.db.GetDB().ExecContext(ctx,
-		"update orders set customer_id=$1, status=$2, total=$3 where id=$4;",
-		order.CustomerID, order.Status, order.Total, order.ID)
-
 	for _, item := range order.Items {
 		item.OrderID = order.ID
 		if err := ValidateItem(item); err != nil {
 			return err
 		}
+	}
 
-		_, err := o.db.GetDB().ExecContext(ctx,
-			"update order_items set quantity=$1 where order_id=$2 and product_id=$3;",
-			item.Quantity, order.ID, item.ProductID)
-		if err != nil {
+	tx, err := o.db.BeginTenantTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var previousStatus string
+	err = tx.GetContext(ctx, &previousStatus, "select status from orders where id=$1 and tenant_id=current_tenant() for update;", order.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// nothing to update
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"update orders set customer_id=$1, status=$2, total=$3, currency=$4 where id=$5 and tenant_id=current_tenant();",
+		order.CustomerID, order.Status, order.Total, order.Total.Currency, order.ID); err != nil {
+		return err
+	}
+
+	for _, item := range order.Items {
+		if _, err := tx.ExecContext(ctx,
+			"update order_items set quantity=$1 where order_id=$2 and product_id=$3 and tenant_id=current_tenant();",
+			item.Quantity, order.ID, item.ProductID); err != nil {
+			return err
+		}
+	}
+	// the total has to match the items as updated
+	var stored []OrderItem
+	if err := tx.SelectContext(ctx, &stored,
+		"select product_id, quantity from order_items where order_id=$1 and tenant_id=current_tenant();", order.ID); err != nil {
+		return err
+	}
+	if err := checkTotal(ctx, tx, order.Total, stored); err != nil {
+		return err
+	}
+
+	var event *OrderEvent
+	if order.Status != previousStatus {
+		event = &OrderEvent{}
+		if err := tx.QueryRowxContext(ctx,
+			`insert into order_events (order_id, customer_id, status, previous_status) values ($1, $2, $3, $4)
+			returning id, order_id, customer_id, status, previous_status, created_at, tenant_id;`,
+			order.ID, order.CustomerID, order.Status, previousStatus).StructScan(event); err != nil {
+			return err
+		}
+		if err := o.outbox.Add(ctx, tx, events.OrderStatusChanged{
+			OrderID:        event.OrderID,
+			CustomerID:     event.CustomerID,
+			Status:         event.Status,
+			PreviousStatus: event.PreviousStatus,
+		}); err != nil {
 			return err
 		}
 	}
+	if err := o.notify(ctx, tx, EventUpdated, order); err != nil {
+		return err
+	}
 
-	return err
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if event != nil {
+		o.events.publish(*event)
+	}
+	return nil
 }
 
 func (o *OrderService) DeleteOrder(ctx context.Context, id uuid.UUID) error {
-	_, err := o.db.GetDB().ExecContext(ctx,
-		"delete from orders where id=$1;",
-		id)
-	return err
+	return o.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			"delete from orders where id=$1 and tenant_id=current_tenant();",
+			id)
+		return err
+	})
+}
+
+// create, get, update and remove back both the REST routes and the RPC methods, so both validate
+// and map errors the same way.
+func (o *OrderService) create(ctx context.Context, order Order) (*Order, error) {
+	id, err := o.CreateOrder(ctx, order)
+	if err != nil {
+		o.log.Error().Err(err).Msg("Failed to create order")
+		return nil, rest.ServiceError(err, "", "Failed to create order")
+	}
+	order.ID = id
+	return &order, nil
+}
+
+func (o *OrderService) get(ctx context.Context, id uuid.UUID) (*Order, error) {
+	order, err := o.GetOrderByID(ctx, id)
+	if err != nil {
+		o.log.Error().Err(err).Msg("Failed to retrieve order")
+		return nil, rest.ServiceError(err, "Order not found", "Failed to retrieve order")
+	}
+	return order, nil
+}
+
+func (o *OrderService) update(ctx context.Context, order Order) (*Order, error) {
+	if err := o.UpdateOrder(ctx, order); err != nil {
+		o.log.Error().Err(err).Msg("Failed to update order")
+		return nil, rest.ServiceError(err, "", "Failed to update order")
+	}
+	return &order, nil
+}
+
+func (o *OrderService) list(ctx context.Context, limit, offset int) ([]Order, error) {
+	if limit < 1 || limit > maxListLimit || offset < 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid paging parameters")
+	}
+	orders, err := o.ListOrders(ctx, limit, offset)
+	if err != nil {
+		o.log.Error().Err(err).Msg("Failed to list orders")
+		return nil, rest.ServiceError(err, "", "Failed to list orders")
+	}
+	return orders, nil
+}
+
+func (o *OrderService) remove(ctx context.Context, id uuid.UUID) error {
+	if err := o.DeleteOrder(ctx, id); err != nil {
+		o.log.Error().Err(err).Msg("Failed to delete order")
+		return rest.ServiceError(err, "", "Failed to delete order")
+	}
+	return nil
 }
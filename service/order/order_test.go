@@ -2,8 +2,11 @@ package order
 
 import (
 	"context"
+	"errors"
 	"testing"
 
+	"github.com/romanWienicke/go-app-test/foundation/money"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
 	test "github.com/romanWienicke/go-app-test/foundation/testing"
 	"github.com/romanWienicke/go-app-test/service/customer"
 	"github.com/romanWienicke/go-app-test/service/product"
@@ -26,9 +29,10 @@ func TestCreateOrder(t *testing.T) {
 		test.DockerComposeDown(t, "../../docker-compose.yaml")
 	})
 	log := zerolog.Nop()
+	ctx := postgres.WithTenant(context.Background(), "default")
 	customerService := customer.NewCustomerService(db, &log)
 	// Create a customer to associate with the product if needed
-	customerID, err := customerService.CreateCustomer(context.Background(), customer.Customer{
+	customerID, err := customerService.CreateCustomer(ctx, customer.Customer{
 		Name:  "Test Customer",
 		Email: "testcustomer@example.com",
 	})
@@ -38,9 +42,9 @@ func TestCreateOrder(t *testing.T) {
 
 	productService := product.NewProductService(db, &log)
 	// Create a product to associate with the order
-	productID, err := productService.CreateProduct(context.Background(), product.Product{
+	productID, err := productService.CreateProduct(ctx, product.Product{
 		Name:        "Test Product",
-		Price:       24.99,
+		Price:       money.New(2499, "EUR"),
 		Description: "Test Product Description",
 	})
 	if err != nil {
@@ -51,7 +55,7 @@ func TestCreateOrder(t *testing.T) {
 	newOrder := Order{
 		CustomerID: customerID,
 		Status:     "pending",
-		Total:      49.99,
+		Total:      money.New(4998, "EUR"),
 		Items: []OrderItem{
 			{
 				ProductID: productID,
@@ -60,12 +64,34 @@ func TestCreateOrder(t *testing.T) {
 		},
 	}
 
-	ctx := context.Background()
 	id, err := orderService.CreateOrder(ctx, newOrder)
 	if err != nil {
 		t.Fatalf("Failed to create order: %v", err)
 	}
 
+	// the total has to be in the currency of the products
+	inDollars := newOrder
+	inDollars.Total = money.New(5400, "USD")
+	if _, err := orderService.CreateOrder(ctx, inDollars); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Fatalf("Expected ErrCurrencyMismatch, got %v", err)
+	}
+	// and match the prices of the items
+	wrongTotal := newOrder
+	wrongTotal.Total = money.New(2499, "EUR")
+	if _, err := orderService.CreateOrder(ctx, wrongTotal); !errors.Is(err, money.ErrInvalidAmount) {
+		t.Fatalf("Expected ErrInvalidAmount for a total below the items, got %v", err)
+	}
+
+	// a repeated idempotency key returns the first order
+	onceID, created, err := orderService.CreateOrderOnce(ctx, "test:once", newOrder)
+	if err != nil || !created {
+		t.Fatalf("Failed to create order once: %v", err)
+	}
+	againID, created, err := orderService.CreateOrderOnce(ctx, "test:once", newOrder)
+	if err != nil || created || againID != onceID {
+		t.Fatalf("Expected order %s again, got %s (created %t): %v", onceID, againID, created, err)
+	}
+
 	retrievedOrder, err := orderService.GetOrderByID(ctx, id)
 	if err != nil {
 		t.Fatalf("Failed to retrieve order: %v", err)
@@ -76,13 +102,36 @@ func TestCreateOrder(t *testing.T) {
 
 	updatedOrder := *retrievedOrder
 	updatedOrder.Status = "shipped"
-	updatedOrder.Total = 99.99
+	updatedOrder.Items[0].Quantity = 4
+	updatedOrder.Total = money.New(9996, "EUR")
+
+	sub, err := orderService.events.subscribe(eventFilter{TenantID: "default", CustomerID: customerID})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer orderService.events.unsubscribe(sub)
 
 	err = orderService.UpdateOrder(ctx, updatedOrder)
 	if err != nil {
 		t.Fatalf("Failed to update order: %v", err)
 	}
 
+	select {
+	case event := <-sub.events:
+		if event.OrderID != id || event.PreviousStatus != "pending" || event.Status != "shipped" {
+			t.Fatalf("Unexpected order event %+v", event)
+		}
+	default:
+		t.Fatalf("Expected an order event for the status change")
+	}
+	events, err := orderService.eventsAfter(ctx, eventFilter{OrderID: id}, 0, 10)
+	if err != nil {
+		t.Fatalf("Failed to read order events: %v", err)
+	}
+	if len(events) != 1 || events[0].Status != "shipped" {
+		t.Fatalf("Expected the logged status change, got %+v", events)
+	}
+
 	finalOrder, err := orderService.GetOrderByID(ctx, id)
 	if err != nil {
 		t.Fatalf("Failed to retrieve updated order: %v", err)
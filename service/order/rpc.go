@@ -0,0 +1,63 @@
+package order
+
+import (
+	"encoding/json"
+
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/rest"
+)
+
+// RPCMethods exposes the order operations as JSON-RPC methods order.create, order.get, order.update
+// and order.delete plus order.list.
+func (o *OrderService) RPCMethods() map[string]rest.RPCMethod {
+	return map[string]rest.RPCMethod{
+		"order.list": {Permission: auth.PermOrderRead, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			paging, err := rest.RPCParams[struct {
+				Limit  *int `json:"limit"`
+				Offset int  `json:"offset"`
+			}](params)
+			if err != nil {
+				return nil, err
+			}
+			limit := defaultListLimit
+			if paging.Limit != nil {
+				limit = *paging.Limit
+			}
+			return o.list(c.Request().Context(), limit, paging.Offset)
+		}},
+		"order.create": {Permission: auth.PermOrderWrite, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			order, err := rest.RPCParams[Order](params)
+			if err != nil {
+				return nil, err
+			}
+			return o.create(c.Request().Context(), order)
+		}},
+		"order.get": {Permission: auth.PermOrderRead, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			id, err := rest.RPCID(params, "Invalid order ID")
+			if err != nil {
+				return nil, err
+			}
+			return o.get(c.Request().Context(), id)
+		}},
+		"order.update": {Permission: auth.PermOrderWrite, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			id, err := rest.RPCID(params, "Invalid order ID")
+			if err != nil {
+				return nil, err
+			}
+			order, err := rest.RPCParams[Order](params)
+			if err != nil {
+				return nil, err
+			}
+			order.ID = id
+			return o.update(c.Request().Context(), order)
+		}},
+		"order.delete": {Permission: auth.PermOrderDelete, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			id, err := rest.RPCID(params, "Invalid order ID")
+			if err != nil {
+				return nil, err
+			}
+			return nil, o.remove(c.Request().Context(), id)
+		}},
+	}
+}
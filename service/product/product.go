@@ -2,29 +2,52 @@ package product
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/events"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/money"
 	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/outbox"
+	"github.com/romanWienicke/go-app-test/rest"
 	"github.com/rs/zerolog"
 )
 
 type Product struct {
-	ID          uuid.UUID `db:"id" json:"id" validate:"omitempty,uuid4"`
-	Name        string    `db:"name" json:"name" validate:"required,min=2,max=100"`
-	Description string    `db:"description" json:"description" validate:"max=2000"`
-	Price       float64   `db:"price" json:"price" validate:"required,gt=0"`
+	ID          uuid.UUID   `db:"id" json:"id" xml:"id" validate:"omitempty,uuid4"`
+	Name        string      `db:"name" json:"name" xml:"name" validate:"required,min=2,max=100"`
+	Description string      `db:"description" json:"description" xml:"description" validate:"max=2000"`
+	Price       money.Money `db:"price" json:"price" xml:"price"`
 }
 
 func Validate(p Product) error {
 	validator := validator.New()
-	return validator.Struct(p)
+	if err := validator.Struct(p); err != nil {
+		return err
+	}
+	if !p.Price.IsPositive() {
+		return fmt.Errorf("%w: price has to be positive", money.ErrInvalidAmount)
+	}
+	return p.Price.Validate()
 }
 
+// productColumns selects a Product, the currency of the price has a column of its own.
+const productColumns = `id, name, description, price, currency as "price.currency"`
+
+// ChangesChannel is the NOTIFY channel receiving the ID and tenant of every inserted, updated or
+// deleted product, see postgres.Db.Listen and postgres.Change.
+const ChangesChannel = "products_changed"
+
 type ProductService struct {
-	db  *postgres.Db
-	log *zerolog.Logger
+	db     *postgres.Db
+	log    *zerolog.Logger
+	outbox *outbox.Outbox
 }
 
 func NewProductService(db *postgres.Db, log *zerolog.Logger) *ProductService {
@@ -34,24 +57,34 @@ func NewProductService(db *postgres.Db, log *zerolog.Logger) *ProductService {
 	}
 }
 
+// SetOutbox sets the outbox product events are stored in. Bulk imports don't publish events.
+func (p *ProductService) SetOutbox(o *outbox.Outbox) {
+	p.outbox = o
+}
+
 func (p *ProductService) RouteAdder() func(e *echo.Echo) {
 	return func(e *echo.Echo) {
 		e.POST("/product", func(c echo.Context) error {
 			var newProduct Product
-			if err := c.Bind(&newProduct); err != nil {
+			if err := rest.Bind(c, &newProduct); err != nil {
 				p.log.Printf("Failed to bind product: %v", err)
-				return c.JSON(400, map[string]string{"error": "Invalid request body"})
+				return err
 			}
 
-			id, err := p.CreateProduct(c.Request().Context(), newProduct)
+			created, err := p.create(c.Request().Context(), newProduct)
 			if err != nil {
-				p.log.Error().Err(err).Msg("Failed to create product")
-				return c.JSON(500, map[string]string{"error": "Failed to create product"})
+				return err
 			}
+			return rest.Respond(c, 201, created)
+		}, rest.Require(auth.PermProductWrite))
+
+		e.POST("/product\\:bulk", rest.Bulk(rest.BulkConfig[Product]{
+			DB:       p.db,
+			Validate: Validate,
+			Insert:   p.insertProducts,
+		}, p.log), rest.Require(auth.PermProductWrite))
 
-			newProduct.ID = id
-			return c.JSON(201, newProduct)
-		})
+		e.GET("/product/search", p.searchRoute, rest.Require(auth.PermProductRead))
 
 		e.GET("/product/:id", func(c echo.Context) error {
 			idParam := c.Param("id")
@@ -61,17 +94,12 @@ func (p *ProductService) RouteAdder() func(e *echo.Echo) {
 				return c.JSON(400, map[string]string{"error": "Invalid product ID"})
 			}
 
-			product, err := p.GetProductByID(c.Request().Context(), id)
+			product, err := p.get(c.Request().Context(), id)
 			if err != nil {
-				if err == postgres.ErrNoRows {
-					p.log.Error().Err(err).Msg("Product not found")
-					return c.JSON(404, map[string]string{"error": "Product not found"})
-				}
-				p.log.Error().Err(err).Msg("Failed to retrieve product")
-				return c.JSON(500, map[string]string{"error": "Failed to retrieve product"})
+				return err
 			}
-			return c.JSON(200, product)
-		})
+			return rest.Respond(c, 200, product)
+		}, rest.Require(auth.PermProductRead))
 
 		e.PUT("/product/:id", func(c echo.Context) error {
 			idParam := c.Param("id")
@@ -82,18 +110,18 @@ func (p *ProductService) RouteAdder() func(e *echo.Echo) {
 			}
 
 			var updatedProduct Product
-			if err := c.Bind(&updatedProduct); err != nil {
+			if err := rest.Bind(c, &updatedProduct); err != nil {
 				p.log.Error().Err(err).Msg("Invalid request body")
-				return c.JSON(400, map[string]string{"error": "Invalid request body"})
+				return err
 			}
 			updatedProduct.ID = id
 
-			if err := p.UpdateProduct(c.Request().Context(), updatedProduct); err != nil {
-				p.log.Error().Err(err).Msg("Failed to update product")
-				return c.JSON(500, map[string]string{"error": "Failed to update product"})
+			updated, err := p.update(c.Request().Context(), updatedProduct)
+			if err != nil {
+				return err
 			}
-			return c.JSON(200, updatedProduct)
-		})
+			return rest.Respond(c, 200, updated)
+		}, rest.Require(auth.PermProductWrite))
 
 		e.DELETE("/product/:id", func(c echo.Context) error {
 			idParam := c.Param("id")
@@ -103,12 +131,11 @@ func (p *ProductService) RouteAdder() func(e *echo.Echo) {
 				return c.JSON(400, map[string]string{"error": "Invalid product ID"})
 			}
 
-			if err := p.DeleteProduct(c.Request().Context(), id); err != nil {
-				p.log.Error().Err(err).Msg("Failed to delete product")
-				return c.JSON(500, map[string]string{"error": "Failed to delete product"})
+			if err := p.remove(c.Request().Context(), id); err != nil {
+				return err
 			}
 			return c.NoContent(204)
-		})
+		}, rest.Require(auth.PermProductDelete))
 	}
 }
 
@@ -117,34 +144,120 @@ func (p *ProductService) CreateProduct(ctx context.Context, product Product) (uu
 		return uuid.Nil, err
 	}
 
+	// tenant_id defaults to the tenant of the transaction
 	id := uuid.New()
-	_, err := p.db.GetDB().ExecContext(ctx,
-		"insert into products (id, name, description, price) values ($1, $2, $3, $4);",
-		id, product.Name, product.Description, product.Price)
+	err := p.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			"insert into products (id, name, description, price, currency) values ($1, $2, $3, $4, $5);",
+			id, product.Name, product.Description, product.Price, product.Price.Currency)
+		return err
+	})
 	if err != nil {
 		return uuid.Nil, err
 	}
 	return id, nil
 }
 
+// insertProducts stores a batch of validated products for the bulk import.
+func (p *ProductService) insertProducts(ctx context.Context, tx *sqlx.Tx, products []Product) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, len(products))
+	rows := make([][]any, len(products))
+	for i, product := range products {
+		ids[i] = uuid.New()
+		rows[i] = []any{ids[i], product.Name, product.Description, product.Price, product.Price.Currency}
+	}
+	return ids, postgres.InsertRows(ctx, tx, "products", []string{"id", "name", "description", "price", "currency"}, rows)
+}
+
 func (p *ProductService) GetProductByID(ctx context.Context, id uuid.UUID) (*Product, error) {
-	return postgres.QueryOne[Product](ctx, p.db.GetDB(), "select id, name, description, price from products where id=$1", id)
+	return postgres.InTenantResult(ctx, p.db, func(tx *sqlx.Tx) (*Product, error) {
+		return postgres.QueryOne[Product](ctx, tx,
+			"select "+productColumns+" from products where id=$1 and tenant_id=current_tenant()", id)
+	})
 }
 
+// UpdateProduct stores the product; a price change is stored as ProductPriceChanged in the outbox.
 func (p *ProductService) UpdateProduct(ctx context.Context, product Product) error {
 	if err := Validate(product); err != nil {
 		return err
 	}
 
-	_, err := p.db.GetDB().ExecContext(ctx,
-		"update products set name=$1, description=$2, price=$3 where id=$4;",
-		product.Name, product.Description, product.Price, product.ID)
-	return err
+	tx, err := p.db.BeginTenantTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// the row lock of the subquery keeps concurrent updates from reporting the same old price
+	var previousPrice money.Money
+	err = tx.QueryRowContext(ctx,
+		`update products p set name=$1, description=$2, price=$3, currency=$4
+		from (select id, price, currency from products where id=$5 and tenant_id=current_tenant() for update) old
+		where p.id = old.id
+		returning old.price, old.currency;`,
+		product.Name, product.Description, product.Price, product.Price.Currency, product.ID).Scan(&previousPrice, &previousPrice.Currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		// nothing to update
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if previousPrice != product.Price {
+		if err := p.outbox.Add(ctx, tx, events.ProductPriceChanged{
+			ProductID:     product.ID,
+			PreviousPrice: previousPrice,
+			Price:         product.Price,
+		}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func (p *ProductService) DeleteProduct(ctx context.Context, id uuid.UUID) error {
-	_, err := p.db.GetDB().ExecContext(ctx,
-		"delete from products where id=$1;",
-		id)
-	return err
+	return p.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			"delete from products where id=$1 and tenant_id=current_tenant();",
+			id)
+		return err
+	})
+}
+
+// create, get, update and remove back both the REST routes and the RPC methods, so both validate
+// and map errors the same way.
+func (p *ProductService) create(ctx context.Context, product Product) (*Product, error) {
+	id, err := p.CreateProduct(ctx, product)
+	if err != nil {
+		p.log.Error().Err(err).Msg("Failed to create product")
+		return nil, rest.ServiceError(err, "", "Failed to create product")
+	}
+	product.ID = id
+	return &product, nil
+}
+
+func (p *ProductService) get(ctx context.Context, id uuid.UUID) (*Product, error) {
+	product, err := p.GetProductByID(ctx, id)
+	if err != nil {
+		p.log.Error().Err(err).Msg("Failed to retrieve product")
+		return nil, rest.ServiceError(err, "Product not found", "Failed to retrieve product")
+	}
+	return product, nil
+}
+
+func (p *ProductService) update(ctx context.Context, product Product) (*Product, error) {
+	if err := p.UpdateProduct(ctx, product); err != nil {
+		p.log.Error().Err(err).Msg("Failed to update product")
+		return nil, rest.ServiceError(err, "", "Failed to update product")
+	}
+	return &product, nil
+}
+
+func (p *ProductService) remove(ctx context.Context, id uuid.UUID) error {
+	if err := p.DeleteProduct(ctx, id); err != nil {
+		p.log.Error().Err(err).Msg("Failed to delete product")
+		return rest.ServiceError(err, "", "Failed to delete product")
+	}
+	return nil
 }
@@ -4,7 +4,11 @@ import (
 	"context"
 	"testing"
 
+	"github.com/romanWienicke/go-app-test/events"
+	"github.com/romanWienicke/go-app-test/foundation/money"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
 	test "github.com/romanWienicke/go-app-test/foundation/testing"
+	"github.com/romanWienicke/go-app-test/outbox"
 	"github.com/rs/zerolog"
 )
 
@@ -26,14 +30,16 @@ func TestCreateProduct(t *testing.T) {
 
 	log := zerolog.Nop()
 	productService := NewProductService(db, &log)
+	productOutbox := outbox.NewOutbox(db, &log, outbox.Config{})
+	productService.SetOutbox(productOutbox)
 
 	newProduct := Product{
 		Name:        "Test Product",
-		Price:       19.99,
+		Price:       money.New(1999, "EUR"),
 		Description: "Test Product Description",
 	}
 
-	ctx := context.Background()
+	ctx := postgres.WithTenant(context.Background(), "default")
 	id, err := productService.CreateProduct(ctx, newProduct)
 	if err != nil {
 		t.Fatalf("Failed to create product: %v", err)
@@ -49,7 +55,7 @@ func TestCreateProduct(t *testing.T) {
 
 	updatedProduct := *retrievedProduct
 	updatedProduct.Name = "Updated Product"
-	updatedProduct.Price = 29.99
+	updatedProduct.Price = money.New(2999, "EUR")
 	updatedProduct.Description = "Updated Product Description"
 
 	err = productService.UpdateProduct(ctx, updatedProduct)
@@ -61,10 +67,41 @@ func TestCreateProduct(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to retrieve updated product: %v", err)
 	}
-	if finalProduct.Name != "Updated Product" || finalProduct.Price != 29.99 || finalProduct.Description != "Updated Product Description" {
+	if finalProduct.Name != "Updated Product" || finalProduct.Price != updatedProduct.Price || finalProduct.Description != "Updated Product Description" {
 		t.Fatalf("Updated product does not match expected values")
 	}
 
+	publisher := events.NewMemory()
+	if n, err := productOutbox.Relay(ctx, publisher); err != nil || n != 1 {
+		t.Fatalf("Failed to relay the outbox: %d, %v", n, err)
+	}
+	published := publisher.Published()
+	if len(published) != 1 || published[0].Type != events.ProductPriceChangedType || published[0].AggregateID != id {
+		t.Fatalf("Expected one price change event, got %+v", published)
+	}
+	e, err := published[0].Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if change := e.(events.ProductPriceChanged); change.PreviousPrice != newProduct.Price || change.Price != updatedProduct.Price {
+		t.Fatalf("Unexpected price change %+v", change)
+	}
+
+	// prefix and typo tolerant search
+	for _, q := range []string{"updat prod", "Prodct"} {
+		hits, err := productService.SearchProducts(ctx, q, 10, 0)
+		if err != nil {
+			t.Fatalf("Failed to search %q: %v", q, err)
+		}
+		if len(hits) != 1 || hits[0].ID != id {
+			t.Fatalf("Expected the product for %q, got %+v", q, hits)
+		}
+	}
+	hits, err := productService.SearchProducts(ctx, "description", 10, 0)
+	if err != nil || len(hits) != 1 || hits[0].Snippet != "Updated Product <mark>Description</mark>" {
+		t.Fatalf("Expected a highlighted snippet, got %+v, %v", hits, err)
+	}
+
 	err = productService.DeleteProduct(ctx, id)
 	if err != nil {
 		t.Fatalf("Failed to delete product: %v", err)
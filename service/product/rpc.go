@@ -0,0 +1,49 @@
+package product
+
+import (
+	"encoding/json"
+
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/rest"
+)
+
+// RPCMethods exposes the product operations as JSON-RPC methods product.create, product.get, product.update
+// and product.delete.
+func (p *ProductService) RPCMethods() map[string]rest.RPCMethod {
+	return map[string]rest.RPCMethod{
+		"product.create": {Permission: auth.PermProductWrite, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			product, err := rest.RPCParams[Product](params)
+			if err != nil {
+				return nil, err
+			}
+			return p.create(c.Request().Context(), product)
+		}},
+		"product.get": {Permission: auth.PermProductRead, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			id, err := rest.RPCID(params, "Invalid product ID")
+			if err != nil {
+				return nil, err
+			}
+			return p.get(c.Request().Context(), id)
+		}},
+		"product.update": {Permission: auth.PermProductWrite, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			id, err := rest.RPCID(params, "Invalid product ID")
+			if err != nil {
+				return nil, err
+			}
+			product, err := rest.RPCParams[Product](params)
+			if err != nil {
+				return nil, err
+			}
+			product.ID = id
+			return p.update(c.Request().Context(), product)
+		}},
+		"product.delete": {Permission: auth.PermProductDelete, Call: func(c echo.Context, params json.RawMessage) (any, error) {
+			id, err := rest.RPCID(params, "Invalid product ID")
+			if err != nil {
+				return nil, err
+			}
+			return nil, p.remove(c.Request().Context(), id)
+		}},
+	}
+}
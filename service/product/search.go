@@ -0,0 +1,115 @@
+package product
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/rest"
+)
+
+// defaultSearchLimit and maxSearchLimit bound the page size of product searches, maxQueryLength
+// the length of the search text.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxQueryLength     = 200
+)
+
+// SearchHit is a product found by SearchProducts.
+type SearchHit struct {
+	Product
+	Rank float64 `db:"rank" json:"rank" xml:"rank"`
+	// NameHighlight and Snippet are HTML-escaped, with the matched words in <mark> elements.
+	NameHighlight string `db:"name_highlight" json:"name_highlight" xml:"name_highlight"`
+	Snippet       string `db:"snippet" json:"snippet" xml:"snippet"`
+}
+
+// ts_headline marks matches with these control characters, which are replaced by <mark> after
+// escaping the text.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// searchQuery matches products by full text, every word also as prefix of a longer one, or by a
+// name similar to the search text. Full-text matches in the name rank highest.
+const searchQuery = `
+select id, name, coalesce(description, '') as description, price, currency as "price.currency",
+	ts_rank(search_vector, query) + word_similarity($2, name) as rank,
+	ts_headline('english', name, query,
+		'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', HighlightAll=true') as name_highlight,
+	ts_headline('english', coalesce(description, ''), query,
+		'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MinWords=15, MaxWords=35') as snippet
+from products, to_tsquery('english', $1) query
+where tenant_id = current_tenant() and (search_vector @@ query or $2 <% name)
+order by rank desc, id
+limit $3 offset $4;`
+
+// SearchProducts returns a page of the products matching text, best match first.
+func (p *ProductService) SearchProducts(ctx context.Context, text string, limit, offset int) ([]SearchHit, error) {
+	hits := []SearchHit{}
+	err := p.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		return tx.SelectContext(ctx, &hits, searchQuery, prefixQuery(text), text, limit, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		hits[i].NameHighlight = highlight(hits[i].NameHighlight)
+		hits[i].Snippet = highlight(hits[i].Snippet)
+	}
+	return hits, nil
+}
+
+// prefixQuery turns text into a tsquery matching all its words as prefixes, so "wire key" finds
+// "wireless keyboard". Only letters and digits are kept, the rest of the tsquery syntax can't be
+// used.
+func prefixQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+func highlight(s string) string {
+	s = html.EscapeString(s)
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(s)
+}
+
+func (p *ProductService) searchRoute(c echo.Context) error {
+	limit, offset := defaultSearchLimit, 0
+	err := echo.QueryParamsBinder(c).Int("limit", &limit).Int("offset", &offset).BindError()
+	if err != nil {
+		p.log.Error().Err(err).Msg("Invalid paging parameters")
+		return c.JSON(400, map[string]string{"error": "Invalid paging parameters"})
+	}
+
+	hits, err := p.search(c.Request().Context(), strings.TrimSpace(c.QueryParam("q")), limit, offset)
+	if err != nil {
+		return err
+	}
+	return rest.Respond(c, 200, hits)
+}
+
+func (p *ProductService) search(ctx context.Context, text string, limit, offset int) ([]SearchHit, error) {
+	if limit < 1 || limit > maxSearchLimit || offset < 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid paging parameters")
+	}
+	if prefixQuery(text) == "" || len(text) > maxQueryLength {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid search query")
+	}
+	hits, err := p.SearchProducts(ctx, text, limit, offset)
+	if err != nil {
+		p.log.Error().Err(err).Msg("Failed to search products")
+		return nil, rest.ServiceError(err, "", "Failed to search products")
+	}
+	return hits, nil
+}
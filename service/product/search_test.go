@@ -0,0 +1,24 @@
+package product
+
+import "testing"
+
+func TestPrefixQuery(t *testing.T) {
+	tests := map[string]string{
+		"wire key":           "wire:* & key:*",
+		"  USB-C   charger ": "USB:* & C:* & charger:*",
+		"a & !b | c:*":       "a:* & b:* & c:*",
+		"!&|":                "",
+	}
+	for text, want := range tests {
+		if got := prefixQuery(text); got != want {
+			t.Errorf("prefixQuery(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := highlight("<b>fast</b> \x02charger\x03")
+	if want := "&lt;b&gt;fast&lt;/b&gt; <mark>charger</mark>"; got != want {
+		t.Errorf("highlight = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,371 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrAccountLocked       = errors.New("account is locked")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// AuthConfig configures login and token issuance.
+type AuthConfig struct {
+	Signer          *auth.Signer
+	Issuer          string
+	Audience        string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// MaxFailedLogins locks an account for LockoutDuration once reached.
+	MaxFailedLogins int
+	LockoutDuration time.Duration
+}
+
+func (cfg AuthConfig) withDefaults() AuthConfig {
+	if cfg.AccessTokenTTL == 0 {
+		cfg.AccessTokenTTL = 15 * time.Minute
+	}
+	if cfg.RefreshTokenTTL == 0 {
+		cfg.RefreshTokenTTL = 30 * 24 * time.Hour
+	}
+	if cfg.MaxFailedLogins == 0 {
+		cfg.MaxFailedLogins = 5
+	}
+	if cfg.LockoutDuration == 0 {
+		cfg.LockoutDuration = 15 * time.Minute
+	}
+	return cfg
+}
+
+// Credentials is the body of a login request.
+type Credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Tokens is returned by login and refresh.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	// All revokes every session of the user on logout.
+	All bool `json:"all"`
+}
+
+// dummyHash is compared against for unknown emails and users without password so response
+// times don't reveal them.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// HashPassword hashes a password with bcrypt.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// PublicRoutes are the authentication routes reachable without a bearer token.
+func (u *UserService) PublicRoutes() []string {
+	return []string{"/auth/login", "/auth/refresh", "/auth/logout"}
+}
+
+func (u *UserService) addAuthRoutes(e *echo.Echo) {
+	e.POST("/auth/login", func(c echo.Context) error {
+		var creds Credentials
+		if err := c.Bind(&creds); err != nil {
+			u.log.Error().Err(err).Msg("Failed to bind credentials")
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		}
+
+		tokens, err := u.Login(c.Request().Context(), creds.Email, creds.Password)
+		if err != nil {
+			return u.authError(c, err)
+		}
+		return c.JSON(http.StatusOK, tokens)
+	})
+
+	e.POST("/auth/refresh", func(c echo.Context) error {
+		var req refreshRequest
+		if err := c.Bind(&req); err != nil {
+			u.log.Error().Err(err).Msg("Failed to bind refresh request")
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		}
+
+		tokens, err := u.Refresh(c.Request().Context(), req.RefreshToken)
+		if err != nil {
+			return u.authError(c, err)
+		}
+		return c.JSON(http.StatusOK, tokens)
+	})
+
+	e.POST("/auth/logout", func(c echo.Context) error {
+		var req refreshRequest
+		if err := c.Bind(&req); err != nil {
+			u.log.Error().Err(err).Msg("Failed to bind logout request")
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		}
+
+		if err := u.Logout(c.Request().Context(), req.RefreshToken, req.All); err != nil {
+			return u.authError(c, err)
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+func (u *UserService) authError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, ErrAccountLocked):
+		u.log.Warn().Err(err).Msg("Login to locked account")
+		return c.JSON(http.StatusLocked, map[string]string{"error": "Account is locked, try again later"})
+	case errors.Is(err, ErrInvalidCredentials):
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid email or password"})
+	case errors.Is(err, ErrRefreshTokenReused):
+		u.log.Warn().Err(err).Msg("Refresh token reuse detected, session revoked")
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid refresh token"})
+	case errors.Is(err, ErrInvalidRefreshToken):
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid refresh token"})
+	default:
+		u.log.Error().Err(err).Msg("Authentication failed")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Authentication failed"})
+	}
+}
+
+type credentialRow struct {
+	ID           int            `db:"id"`
+	PasswordHash sql.NullString `db:"password_hash"`
+	FailedLogins int            `db:"failed_logins"`
+	LockedUntil  sql.NullTime   `db:"locked_until"`
+}
+
+// Login checks the credentials of a user of the tenant of ctx and issues a new token pair.
+// Repeated failures lock the account. A locked account is only reported as such for the right
+// password, wrong ones fail like for unknown emails, so the lockout doesn't reveal accounts.
+func (u *UserService) Login(ctx context.Context, email, password string) (*Tokens, error) {
+	tx, err := u.db.BeginTenantTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var row credentialRow
+	err = tx.GetContext(ctx, &row,
+		"select id, password_hash, failed_logins, locked_until from users where lower(email)=lower($1) and tenant_id=current_tenant();",
+		strings.TrimSpace(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hash := dummyHash
+	if row.PasswordHash.Valid {
+		hash = []byte(row.PasswordHash.String)
+	}
+	valid := bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil && row.PasswordHash.Valid
+
+	if row.LockedUntil.Valid && row.LockedUntil.Time.After(time.Now()) {
+		if !valid {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, ErrAccountLocked
+	}
+
+	if !valid {
+		if err := u.recordFailedLogin(ctx, tx, row.ID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"update users set failed_logins=0, locked_until=null where id=$1;", row.ID); err != nil {
+		return nil, err
+	}
+
+	tokens, err := u.issueTokens(ctx, tx, row.ID, uuid.New())
+	if err != nil {
+		return nil, err
+	}
+	return tokens, tx.Commit()
+}
+
+func (u *UserService) recordFailedLogin(ctx context.Context, tx *sqlx.Tx, userID int) error {
+	_, err := tx.ExecContext(ctx,
+		`update users set
+			failed_logins = case when failed_logins + 1 >= $2 then 0 else failed_logins + 1 end,
+			locked_until = case when failed_logins + 1 >= $2 then now() + $3 * interval '1 second' else locked_until end
+		where id=$1;`,
+		userID, u.auth.MaxFailedLogins, u.auth.LockoutDuration.Seconds())
+	return err
+}
+
+type refreshTokenRow struct {
+	ID        uuid.UUID    `db:"id"`
+	UserID    int          `db:"user_id"`
+	FamilyID  uuid.UUID    `db:"family_id"`
+	ExpiresAt time.Time    `db:"expires_at"`
+	RevokedAt sql.NullTime `db:"revoked_at"`
+}
+
+// refreshTokenQuery selects a refresh token by hash if its user belongs to the current tenant.
+const refreshTokenQuery = `select t.id, t.user_id, t.family_id, t.expires_at, t.revoked_at
+	from refresh_tokens t join users u on u.id = t.user_id
+	where t.token_hash=$1 and u.tenant_id=current_tenant()`
+
+// Refresh rotates a refresh token. Presenting an already rotated or revoked token revokes the
+// whole token family, as it indicates the token was stolen. Tokens of users of other tenants than
+// the one of ctx are invalid.
+func (u *UserService) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	tx, err := u.db.BeginTenantTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var row refreshTokenRow
+	err = tx.GetContext(ctx, &row, refreshTokenQuery+" for update of t;", hashToken(refreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if row.RevokedAt.Valid {
+		if _, err := tx.ExecContext(ctx,
+			"update refresh_tokens set revoked_at=now() where family_id=$1 and revoked_at is null;",
+			row.FamilyID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if row.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	tokens, err := u.issueTokens(ctx, tx, row.UserID, row.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"update refresh_tokens set revoked_at=now(), replaced_by=(select id from refresh_tokens where token_hash=$2) where id=$1;",
+		row.ID, hashToken(tokens.RefreshToken)); err != nil {
+		return nil, err
+	}
+
+	return tokens, tx.Commit()
+}
+
+// Logout revokes the session of the refresh token, or every session of its user if all is set.
+func (u *UserService) Logout(ctx context.Context, refreshToken string, all bool) error {
+	return u.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		var row refreshTokenRow
+		err := tx.GetContext(ctx, &row, refreshTokenQuery, hashToken(refreshToken))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if all {
+			_, err = tx.ExecContext(ctx,
+				"update refresh_tokens set revoked_at=now() where user_id=$1 and revoked_at is null;", row.UserID)
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"update refresh_tokens set revoked_at=now() where family_id=$1 and revoked_at is null;", row.FamilyID)
+		return err
+	})
+}
+
+// issueTokens issues a token pair for the user within tx, a tenant transaction.
+func (u *UserService) issueTokens(ctx context.Context, tx *sqlx.Tx, userID int, familyID uuid.UUID) (*Tokens, error) {
+	if u.auth.Signer == nil {
+		return nil, auth.ErrNoKeys
+	}
+
+	roles, err := postgres.QueryList[string](ctx, tx, "select role from user_roles where user_id=$1 order by role", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant, _ := postgres.TenantFromContext(ctx)
+	now := time.Now()
+	claims := auth.Claims{Roles: roles, Tenant: tenant, RegisteredClaims: jwt.RegisteredClaims{
+		ID:        uuid.NewString(),
+		Subject:   strconv.Itoa(userID),
+		Issuer:    u.auth.Issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(u.auth.AccessTokenTTL)),
+	}}
+	if u.auth.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{u.auth.Audience}
+	}
+	accessToken, err := u.auth.Signer.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"insert into refresh_tokens (id, user_id, family_id, token_hash, expires_at) values ($1, $2, $3, $4, $5);",
+		uuid.New(), userID, familyID, hashToken(refreshToken), now.Add(u.auth.RefreshTokenTTL)); err != nil {
+		return nil, err
+	}
+
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(u.auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is used to store refresh tokens; they are random, so a fast hash is sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
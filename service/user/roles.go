@@ -0,0 +1,117 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/rest"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// RoleAssignment is the body of the role management endpoints.
+type RoleAssignment struct {
+	Roles []string `json:"roles"`
+}
+
+func (u *UserService) addRoleRoutes(e *echo.Echo) {
+	e.GET("/admin/users/:id/roles", func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			u.log.Error().Err(err).Msg("Invalid user ID")
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+		}
+
+		roles, err := u.GetRoles(c.Request().Context(), id)
+		if err != nil {
+			return u.roleError(c, err)
+		}
+		return c.JSON(http.StatusOK, RoleAssignment{Roles: roles})
+	}, rest.Require(auth.PermRoleManage))
+
+	e.PUT("/admin/users/:id/roles", func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			u.log.Error().Err(err).Msg("Invalid user ID")
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+		}
+
+		var assignment RoleAssignment
+		if err := c.Bind(&assignment); err != nil {
+			u.log.Error().Err(err).Msg("Failed to bind roles")
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		}
+
+		if err := u.SetRoles(c.Request().Context(), id, assignment.Roles); err != nil {
+			return u.roleError(c, err)
+		}
+		return c.JSON(http.StatusOK, assignment)
+	}, rest.Require(auth.PermRoleManage))
+}
+
+func (u *UserService) roleError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, postgres.ErrNoRows):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	case errors.Is(err, ErrUnknownRole):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	default:
+		u.log.Error().Err(err).Msg("Failed to manage roles")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to manage roles"})
+	}
+}
+
+// GetRoles returns the roles assigned to the user.
+func (u *UserService) GetRoles(ctx context.Context, userID int) ([]string, error) {
+	if _, err := u.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	roles, err := postgres.InTenantResult(ctx, u.db, func(tx *sqlx.Tx) ([]string, error) {
+		return postgres.QueryList[string](ctx, tx, "select role from user_roles where user_id=$1 order by role", userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+	return roles, nil
+}
+
+// SetRoles replaces the roles assigned to the user.
+func (u *UserService) SetRoles(ctx context.Context, userID int, roles []string) error {
+	for _, role := range roles {
+		if !auth.IsRole(role) {
+			return fmt.Errorf("%w %q", ErrUnknownRole, role)
+		}
+	}
+	if _, err := u.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+
+	tx, err := u.db.BeginTenantTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, "delete from user_roles where user_id=$1;", userID); err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if _, err := tx.ExecContext(ctx,
+			"insert into user_roles (user_id, role) values ($1, $2) on conflict do nothing;",
+			userID, role); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -6,26 +6,48 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/go-playground/validator/v10"
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
 	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/rest"
 	"github.com/rs/zerolog"
 )
 
 type User struct {
-	Id    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Id       int    `json:"id" xml:"id"`
+	Name     string `json:"name" xml:"name" validate:"required,min=2,max=100"`
+	Email    string `json:"email" xml:"email" validate:"required,email"`
+	Password string `db:"-" json:"password,omitempty" xml:"password,omitempty" validate:"required,min=8,maxbytes=72"`
+}
+
+func Validate(u User) error {
+	validator := validator.New()
+	if err := validator.RegisterValidation("maxbytes", maxBytes); err != nil {
+		return err
+	}
+	return validator.Struct(u)
+}
+
+// maxBytes limits the length of a string in bytes; max counts runes, but bcrypt only accepts
+// passwords of up to 72 bytes.
+func maxBytes(fl validator.FieldLevel) bool {
+	n, err := strconv.Atoi(fl.Param())
+	return err == nil && len(fl.Field().String()) <= n
 }
 
 type UserService struct {
-	db  *postgres.Db
-	log *zerolog.Logger
+	db   *postgres.Db
+	log  *zerolog.Logger
+	auth AuthConfig
 }
 
-func NewUserService(db *postgres.Db, log *zerolog.Logger) *UserService {
+func NewUserService(db *postgres.Db, log *zerolog.Logger, auth AuthConfig) *UserService {
 	return &UserService{
-		db:  db,
-		log: log,
+		db:   db,
+		log:  log,
+		auth: auth.withDefaults(),
 	}
 }
 
@@ -33,8 +55,13 @@ func (u *UserService) RouteAdder() func(e *echo.Echo) {
 	return func(e *echo.Echo) {
 		e.POST("/user", func(c echo.Context) error {
 			var newUser User
-			if err := c.Bind(&newUser); err != nil {
+			if err := rest.Bind(c, &newUser); err != nil {
 				u.log.Error().Err(err).Msg("Failed to bind user")
+				return err
+			}
+
+			if err := Validate(newUser); err != nil {
+				u.log.Error().Err(err).Msg("Invalid user")
 				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 			}
 
@@ -45,8 +72,9 @@ func (u *UserService) RouteAdder() func(e *echo.Echo) {
 			}
 
 			newUser.Id = id
-			return c.JSON(http.StatusCreated, newUser)
-		})
+			newUser.Password = ""
+			return rest.Respond(c, http.StatusCreated, newUser)
+		}, rest.Require(auth.PermUserWrite))
 
 		e.GET("/user/:id", func(c echo.Context) error {
 			idParam := c.Param("id")
@@ -66,20 +94,36 @@ func (u *UserService) RouteAdder() func(e *echo.Echo) {
 				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve user"})
 			}
 
-			return c.JSON(http.StatusOK, user)
-		})
+			return rest.Respond(c, http.StatusOK, user)
+		}, rest.Require(auth.PermUserRead))
+
+		u.addAuthRoutes(e)
+		u.addRoleRoutes(e)
 	}
 }
 
 func (u *UserService) GetUserByID(ctx context.Context, id int) (*User, error) {
-	return postgres.QueryOne[User](ctx, u.db.GetDB(), "select id, name, email from users where id=$1", id)
+	return postgres.InTenantResult(ctx, u.db, func(tx *sqlx.Tx) (*User, error) {
+		return postgres.QueryOne[User](ctx, tx, "select id, name, email from users where id=$1 and tenant_id=current_tenant()", id)
+	})
 }
 
 func (u *UserService) CreateUser(ctx context.Context, user User) (int, error) {
-	var id int
-	err := u.db.GetDB().QueryRowContext(ctx,
-		"insert into users (name, email) values ($1, $2) returning id;",
-		user.Name, user.Email).Scan(&id)
-	// You can use 'id' as needed, e.g., return it or log it
-	return id, err
+	if err := Validate(user); err != nil {
+		return 0, err
+	}
+
+	hash, err := HashPassword(user.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	// tenant_id defaults to the tenant of the transaction
+	return postgres.InTenantResult(ctx, u.db, func(tx *sqlx.Tx) (int, error) {
+		var id int
+		err := tx.QueryRowContext(ctx,
+			"insert into users (name, email, password_hash) values ($1, $2, $3) returning id;",
+			user.Name, user.Email, hash).Scan(&id)
+		return id, err
+	})
 }
@@ -2,12 +2,31 @@ package user
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-playground/validator/v10"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
 	test "github.com/romanWienicke/go-app-test/foundation/testing"
 	"github.com/rs/zerolog"
 )
 
+func TestValidatePasswordBytes(t *testing.T) {
+	user := User{Name: "Alice", Email: "alice@example.com", Password: strings.Repeat("ä", 36)}
+	if err := Validate(user); err != nil {
+		t.Fatalf("Expected 72 bytes to be valid, got %v", err)
+	}
+	// 37 runes but 74 bytes, more than bcrypt accepts
+	user.Password += "ä"
+	var validationErrors validator.ValidationErrors
+	if err := Validate(user); !errors.As(err, &validationErrors) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+}
+
 func TestCreateUser(t *testing.T) {
 	test.SetEnv(t, "../../.env")
 	dc := test.DockerComposeUp(t, "../../docker-compose.yaml", "postgres")
@@ -24,14 +43,15 @@ func TestCreateUser(t *testing.T) {
 	})
 
 	log := zerolog.Nop()
-	userService := NewUserService(db, &log)
+	userService := NewUserService(db, &log, AuthConfig{Signer: auth.NewHS256Signer("secret")})
 
 	newUser := User{
-		Name:  "Test User",
-		Email: "testuser@example.com",
+		Name:     "Test User",
+		Email:    "testuser@example.com",
+		Password: "secret password",
 	}
 
-	ctx := context.Background()
+	ctx := postgres.WithTenant(context.Background(), "default")
 
 	id, err := userService.CreateUser(ctx, newUser)
 	if err != nil {
@@ -46,3 +66,93 @@ func TestCreateUser(t *testing.T) {
 		t.Fatalf("Retrieved user does not match created user")
 	}
 }
+
+func TestLogin(t *testing.T) {
+	test.SetEnv(t, "../../.env")
+	dc := test.DockerComposeUp(t, "../../docker-compose.yaml", "postgres")
+	test.SetupDatabaseEnv(t, dc["postgres"])
+	db := test.InitPostgres(t, "../../migrations")
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Failed to close db: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		t.Helper()
+		test.DockerComposeDown(t, "../../docker-compose.yaml")
+	})
+
+	log := zerolog.Nop()
+	verifier, err := auth.NewVerifier(auth.Config{Secret: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+	userService := NewUserService(db, &log, AuthConfig{
+		Signer:          auth.NewHS256Signer("secret"),
+		MaxFailedLogins: 3,
+		LockoutDuration: time.Minute,
+	})
+
+	ctx := postgres.WithTenant(context.Background(), "default")
+	id, err := userService.CreateUser(ctx, User{Name: "Login User", Email: "login@example.com", Password: "secret password"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := userService.SetRoles(ctx, id, []string{auth.RoleSupport}); err != nil {
+		t.Fatalf("Failed to assign roles: %v", err)
+	}
+	if err := userService.SetRoles(ctx, id, []string{"superuser"}); !errors.Is(err, ErrUnknownRole) {
+		t.Fatalf("Expected ErrUnknownRole, got %v", err)
+	}
+
+	// Login and verify the access token carries the roles
+	tokens, err := userService.Login(ctx, "Login@Example.com", "secret password")
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	claims, err := verifier.Verify(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Issued access token is invalid: %v", err)
+	}
+	if len(claims.Roles) != 1 || claims.Roles[0] != auth.RoleSupport {
+		t.Fatalf("Expected roles [support], got %v", claims.Roles)
+	}
+
+	// Rotate the refresh token, reusing the old one revokes the family
+	rotated, err := userService.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	if _, err := userService.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := userService.Refresh(ctx, rotated.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Expected rotated token to be revoked after reuse, got %v", err)
+	}
+
+	// Logout revokes the session
+	tokens, err = userService.Login(ctx, "login@example.com", "secret password")
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	if err := userService.Logout(ctx, tokens.RefreshToken, false); err != nil {
+		t.Fatalf("Failed to logout: %v", err)
+	}
+	if _, err := userService.Refresh(ctx, tokens.RefreshToken); err == nil {
+		t.Fatalf("Expected refresh after logout to fail")
+	}
+
+	// Lockout after repeated failures
+	for i := 0; i < 3; i++ {
+		if _, err := userService.Login(ctx, "login@example.com", "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+		}
+	}
+	// only the right password learns about the lockout
+	if _, err := userService.Login(ctx, "login@example.com", "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials for a locked account, got %v", err)
+	}
+	if _, err := userService.Login(ctx, "login@example.com", "secret password"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Expected ErrAccountLocked, got %v", err)
+	}
+}
@@ -0,0 +1,485 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/rest"
+)
+
+// Delivery states. Pending deliveries are retried until they succeed or run out of attempts.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Headers of a delivery. The signature is "v1=" and the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredTimestamp = errors.New("webhook timestamp outside tolerance")
+)
+
+// Config configures the delivery worker.
+type Config struct {
+	// PollInterval is how often due deliveries are looked for, 1s by default.
+	PollInterval time.Duration
+	// BatchSize is the number of deliveries claimed at once, 10 by default.
+	BatchSize int
+	// Timeout bounds a single delivery attempt, 10s by default.
+	Timeout time.Duration
+	// MaxAttempts is the number of failed attempts after which a delivery is dead, 8 by default.
+	MaxAttempts int
+	// BackoffBase is the wait after the first failure, doubled with every further failure up
+	// to BackoffMax. 10s and 1h by default.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// AllowHTTP accepts webhook URLs without TLS, only https is accepted by default.
+	AllowHTTP bool
+	// AllowPrivateNetworks delivers to loopback, private and link-local addresses, e.g. to
+	// partners in the same network. Off by default, so webhooks can't reach internal services.
+	AllowPrivateNetworks bool
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 10
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.BackoffBase <= 0 {
+		cfg.BackoffBase = 10 * time.Second
+	}
+	if cfg.BackoffMax <= 0 {
+		cfg.BackoffMax = time.Hour
+	}
+	return cfg
+}
+
+// backoff returns the wait before the next attempt after the given number of failed attempts.
+func (cfg Config) backoff(attempts int) time.Duration {
+	wait := cfg.BackoffBase
+	for i := 1; i < attempts && wait < cfg.BackoffMax; i++ {
+		wait *= 2
+	}
+	return min(wait, cfg.BackoffMax)
+}
+
+// Payload is the JSON body of a delivery as stored, so redeliveries send the same bytes.
+type Payload []byte
+
+func (p Payload) MarshalJSON() ([]byte, error) {
+	return p, nil
+}
+
+// Value passes the payload as text, lib/pq would send []byte as bytea, which jsonb rejects.
+func (p Payload) Value() (driver.Value, error) {
+	return string(p), nil
+}
+
+func (p *Payload) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		*p = bytes.Clone(v)
+	case string:
+		*p = Payload(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a webhook payload", src)
+	}
+	return nil
+}
+
+// Event is the body sent to the partner; the ID is the delivery's, so receivers can drop
+// duplicates.
+type Event struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Delivery is the delivery of an event to a webhook.
+type Delivery struct {
+	ID             uuid.UUID  `db:"id" json:"id" xml:"id"`
+	WebhookID      uuid.UUID  `db:"webhook_id" json:"webhook_id" xml:"webhook_id"`
+	EventType      string     `db:"event_type" json:"event_type" xml:"event_type"`
+	Payload        Payload    `db:"payload" json:"payload" xml:"-"`
+	Status         string     `db:"status" json:"status" xml:"status"`
+	Attempts       int        `db:"attempts" json:"attempts" xml:"attempts"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at" json:"next_attempt_at" xml:"next_attempt_at"`
+	LastStatusCode *int       `db:"last_status_code" json:"last_status_code,omitempty" xml:"last_status_code,omitempty"`
+	LastError      *string    `db:"last_error" json:"last_error,omitempty" xml:"last_error,omitempty"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at" xml:"created_at"`
+	DeliveredAt    *time.Time `db:"delivered_at" json:"delivered_at,omitempty" xml:"delivered_at,omitempty"`
+	AttemptLog     []Attempt  `db:"-" json:"attempt_log,omitempty" xml:"attempt_log>attempt,omitempty"`
+}
+
+// Attempt is a logged delivery attempt.
+type Attempt struct {
+	ID          int64     `db:"id" json:"id" xml:"id"`
+	AttemptedAt time.Time `db:"attempted_at" json:"attempted_at" xml:"attempted_at"`
+	StatusCode  *int      `db:"status_code" json:"status_code,omitempty" xml:"status_code,omitempty"`
+	Error       *string   `db:"error" json:"error,omitempty" xml:"error,omitempty"`
+	DurationMS  int64     `db:"duration_ms" json:"duration_ms" xml:"duration_ms"`
+}
+
+func (s *WebhookService) addDeliveryRoutes(e *echo.Echo) {
+	e.GET("/admin/webhooks/:id/deliveries", func(c echo.Context) error {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid webhook ID"})
+		}
+		limit, offset := 100, 0
+		err = echo.QueryParamsBinder(c).Int("limit", &limit).Int("offset", &offset).BindError()
+		if err != nil || limit < 1 || limit > 1000 || offset < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid paging parameters"})
+		}
+
+		if _, err := s.GetWebhookByID(c.Request().Context(), id); err != nil {
+			return webhookError(err, "Failed to retrieve webhook")
+		}
+		deliveries, err := s.ListDeliveries(c.Request().Context(), id, limit, offset)
+		if err != nil {
+			s.log.Error().Err(err).Msg("Failed to list webhook deliveries")
+			return webhookError(err, "Failed to list webhook deliveries")
+		}
+		return rest.Respond(c, http.StatusOK, deliveries)
+	}, rest.Require(auth.PermWebhookManage))
+
+	e.GET("/admin/webhooks/:id/deliveries/:deliveryId", func(c echo.Context) error {
+		webhookID, deliveryID, err := deliveryParams(c)
+		if err != nil {
+			return err
+		}
+
+		delivery, err := s.GetDelivery(c.Request().Context(), webhookID, deliveryID)
+		if err != nil {
+			s.log.Error().Err(err).Msg("Failed to retrieve webhook delivery")
+			return rest.ServiceError(err, "Delivery not found", "Failed to retrieve webhook delivery")
+		}
+		return rest.Respond(c, http.StatusOK, delivery)
+	}, rest.Require(auth.PermWebhookManage))
+
+	e.POST("/admin/webhooks/:id/deliveries/:deliveryId/redeliver", func(c echo.Context) error {
+		webhookID, deliveryID, err := deliveryParams(c)
+		if err != nil {
+			return err
+		}
+
+		delivery, err := s.Redeliver(c.Request().Context(), webhookID, deliveryID)
+		if err != nil {
+			s.log.Error().Err(err).Msg("Failed to redeliver webhook")
+			return rest.ServiceError(err, "Delivery not found", "Failed to redeliver webhook")
+		}
+		return rest.Respond(c, http.StatusAccepted, delivery)
+	}, rest.Require(auth.PermWebhookManage))
+}
+
+func deliveryParams(c echo.Context) (uuid.UUID, uuid.UUID, error) {
+	webhookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook ID")
+	}
+	deliveryID, err := uuid.Parse(c.Param("deliveryId"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid delivery ID")
+	}
+	return webhookID, deliveryID, nil
+}
+
+// Notify queues a delivery of the event to every active webhook subscribed to its type within
+// tx, the transaction of the change notified about. It implements order.Notifier. Only the
+// webhooks of the tenant of tx are notified.
+func (s *WebhookService) Notify(ctx context.Context, tx sqlx.ExtContext, eventType string, data any) error {
+	var webhookIDs []uuid.UUID
+	if err := sqlx.SelectContext(ctx, tx, &webhookIDs,
+		"select id from webhooks where active and $1 = any(event_types) and tenant_id=current_tenant()", eventType); err != nil {
+		return err
+	}
+	if len(webhookIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	rows := make([][]any, len(webhookIDs))
+	for i, webhookID := range webhookIDs {
+		id := uuid.New()
+		payload, err := json.Marshal(Event{ID: id, Type: eventType, CreatedAt: now, Data: data})
+		if err != nil {
+			return err
+		}
+		rows[i] = []any{id, webhookID, eventType, Payload(payload)}
+	}
+	if err := postgres.InsertRows(ctx, tx, "webhook_deliveries",
+		[]string{"id", "webhook_id", "event_type", "payload"}, rows); err != nil {
+		return err
+	}
+
+	// the worker may look before the commit and find nothing, it catches up on its next poll
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+const deliveryColumns = `id, webhook_id, event_type, payload, status, attempts, next_attempt_at,
+	last_status_code, last_error, created_at, delivered_at`
+
+// tenantWebhook restricts deliveries to the webhooks of the current tenant.
+const tenantWebhook = "webhook_id in (select id from webhooks where tenant_id=current_tenant())"
+
+// ListDeliveries returns the deliveries of a webhook, newest first, without their attempts.
+func (s *WebhookService) ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit, offset int) ([]Delivery, error) {
+	deliveries, err := postgres.InTenantResult(ctx, s.db, func(tx *sqlx.Tx) ([]Delivery, error) {
+		return postgres.QueryList[Delivery](ctx, tx,
+			"select "+deliveryColumns+" from webhook_deliveries where webhook_id=$1 and "+tenantWebhook+
+				" order by created_at desc, id limit $2 offset $3",
+			webhookID, limit, offset)
+	})
+	if deliveries == nil {
+		deliveries = []Delivery{}
+	}
+	return deliveries, err
+}
+
+// GetDelivery returns a delivery including its attempts.
+func (s *WebhookService) GetDelivery(ctx context.Context, webhookID, deliveryID uuid.UUID) (*Delivery, error) {
+	return postgres.InTenantResult(ctx, s.db, func(tx *sqlx.Tx) (*Delivery, error) {
+		delivery, err := postgres.QueryOne[Delivery](ctx, tx,
+			"select "+deliveryColumns+" from webhook_deliveries where id=$1 and webhook_id=$2 and "+tenantWebhook,
+			deliveryID, webhookID)
+		if err != nil {
+			return nil, err
+		}
+		delivery.AttemptLog, err = postgres.QueryList[Attempt](ctx, tx,
+			"select id, attempted_at, status_code, error, duration_ms from webhook_attempts where delivery_id=$1 order by id", deliveryID)
+		return delivery, err
+	})
+}
+
+// Redeliver queues a delivery again right away with a fresh retry budget, whatever its state.
+func (s *WebhookService) Redeliver(ctx context.Context, webhookID, deliveryID uuid.UUID) (*Delivery, error) {
+	err := s.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"update webhook_deliveries set status=$1, attempts=0, next_attempt_at=now(), delivered_at=null where id=$2 and webhook_id=$3 and "+tenantWebhook+";",
+			StatusPending, deliveryID, webhookID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return postgres.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return s.GetDelivery(ctx, webhookID, deliveryID)
+}
+
+// Run delivers due webhooks until ctx is done.
+func (s *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := s.DeliverDue(ctx)
+			if err != nil && ctx.Err() == nil {
+				s.log.Error().Err(err).Msg("Failed to deliver webhooks")
+			}
+			if err != nil || n < s.cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// claimedDelivery is a due delivery with the target of its webhook.
+type claimedDelivery struct {
+	ID       uuid.UUID `db:"id"`
+	Payload  Payload   `db:"payload"`
+	Attempts int       `db:"attempts"`
+	URL      string    `db:"url"`
+	Secret   string    `db:"secret"`
+}
+
+// DeliverDue claims a batch of due deliveries and attempts them, it returns the batch size.
+// Claiming pushes next_attempt_at beyond the attempt, so concurrent workers skip the batch and a
+// crashed worker's deliveries become due again.
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	var claimed []claimedDelivery
+	err := s.db.GetDB().SelectContext(ctx, &claimed, `
+		with due as (
+			select id from webhook_deliveries
+			where status = $1 and next_attempt_at <= now()
+			order by next_attempt_at
+			limit $2
+			for update skip locked
+		)
+		update webhook_deliveries d set next_attempt_at = now() + make_interval(secs => $3)
+		from due, webhooks w
+		where d.id = due.id and w.id = d.webhook_id
+		returning d.id, d.payload, d.attempts, w.url, w.secret`,
+		StatusPending, s.cfg.BatchSize, (s.cfg.Timeout + time.Minute).Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range claimed {
+		if err := s.deliver(ctx, d); err != nil {
+			return len(claimed), err
+		}
+	}
+	return len(claimed), nil
+}
+
+// deliver posts a delivery and records the outcome.
+func (s *WebhookService) deliver(ctx context.Context, d claimedDelivery) error {
+	start := time.Now()
+	statusCode, deliveryErr := s.post(ctx, d)
+	duration := time.Since(start).Milliseconds()
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	var message *string
+	if deliveryErr != nil {
+		m := deliveryErr.Error()
+		message = &m
+	}
+
+	tx, err := s.db.GetDB().BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx,
+		"insert into webhook_attempts (delivery_id, status_code, error, duration_ms) values ($1, $2, $3, $4);",
+		d.ID, code, message, duration); err != nil {
+		return err
+	}
+
+	attempts := d.Attempts + 1
+	switch {
+	case deliveryErr == nil:
+		_, err = tx.ExecContext(ctx,
+			`update webhook_deliveries set status=$1, attempts=$2, last_status_code=$3, last_error=null, delivered_at=now()
+			where id=$4;`,
+			StatusDelivered, attempts, code, d.ID)
+	case attempts >= s.cfg.MaxAttempts:
+		s.log.Warn().Str("delivery_id", d.ID.String()).Int("attempts", attempts).Msg("Webhook delivery is dead")
+		_, err = tx.ExecContext(ctx,
+			"update webhook_deliveries set status=$1, attempts=$2, last_status_code=$3, last_error=$4 where id=$5;",
+			StatusDead, attempts, code, message, d.ID)
+	default:
+		_, err = tx.ExecContext(ctx,
+			`update webhook_deliveries set attempts=$1, last_status_code=$2, last_error=$3,
+			next_attempt_at=now() + make_interval(secs => $4) where id=$5;`,
+			attempts, code, message, s.cfg.backoff(attempts).Seconds(), d.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// post sends the signed payload, any status but 2xx is a failure.
+func (s *WebhookService) post(ctx context.Context, d claimedDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(HeaderID, d.ID.String())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, now, d.Payload))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = res.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// Sign returns the signature header value of a body sent at timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a received delivery and that its timestamp is within tolerance,
+// which protects receivers against replays.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	timestamp := time.Unix(unix, 0)
+	if age := time.Since(timestamp); age > tolerance || age < -tolerance {
+		return ErrExpiredTimestamp
+	}
+
+	expected := Sign(secret, timestamp, body)
+	for _, signature := range strings.Split(header.Get(HeaderSignature), " ") {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
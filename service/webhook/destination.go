@@ -0,0 +1,92 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenURL is returned for webhook URLs the service must not call, e.g. addresses of the
+// internal network.
+var ErrForbiddenURL = errors.New("webhook URL not allowed")
+
+// sharedAddressSpace is the carrier-grade NAT range, which netip does not count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// internalAddress reports whether ip belongs to the host or an internal network: loopback,
+// private, link-local (which includes cloud metadata endpoints), unspecified and multicast
+// addresses.
+func internalAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+// checkURL rejects URLs partners must not register: plain HTTP unless allowed, and hosts resolving
+// to an internal address unless private networks are allowed. The addresses are checked again
+// on every connection, as DNS may change after the check.
+func (s *WebhookService) checkURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrForbiddenURL, err)
+	}
+	if u.Scheme != "https" && !(s.cfg.AllowHTTP && u.Scheme == "http") {
+		return fmt.Errorf("%w: scheme %s, expected https", ErrForbiddenURL, u.Scheme)
+	}
+	if s.cfg.AllowPrivateNetworks {
+		return nil
+	}
+
+	host := u.Hostname()
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if internalAddress(ip) {
+			return fmt.Errorf("%w: %s is an internal address", ErrForbiddenURL, host)
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrForbiddenURL, err)
+	}
+	for _, ip := range addrs {
+		if internalAddress(ip) {
+			return fmt.Errorf("%w: %s resolves to the internal address %s", ErrForbiddenURL, host, ip)
+		}
+	}
+	return nil
+}
+
+// newClient returns the client deliveries are posted with. Unless private networks are allowed
+// its dialer refuses internal addresses, whatever the host resolves to at the time of delivery.
+func newClient(cfg Config) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if internalAddress(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s is an internal address", ErrForbiddenURL, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would be dialed instead of the partner and bypass the check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+		// a redirect is a failed delivery, the partner has to fix the URL
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
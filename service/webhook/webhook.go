@@ -0,0 +1,255 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/romanWienicke/go-app-test/foundation/auth"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	"github.com/romanWienicke/go-app-test/rest"
+	"github.com/romanWienicke/go-app-test/service/order"
+	"github.com/rs/zerolog"
+)
+
+var ErrUnknownEventType = errors.New("unknown event type")
+
+// EventTypes are the events partners can subscribe to.
+var EventTypes = []string{order.EventCreated, order.EventUpdated}
+
+// Webhook is a partner subscription. The secret signs the deliveries; it is only returned when
+// the webhook is created.
+type Webhook struct {
+	ID         uuid.UUID      `db:"id" json:"id" xml:"id" validate:"omitempty,uuid4"`
+	URL        string         `db:"url" json:"url" xml:"url" validate:"required,http_url,max=2000"`
+	EventTypes pq.StringArray `db:"event_types" json:"event_types" xml:"event_types>event_type" validate:"required,min=1"`
+	Secret     string         `db:"secret" json:"secret,omitempty" xml:"secret,omitempty" validate:"omitempty,min=16,max=200"`
+	Active     bool           `db:"active" json:"active" xml:"active"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at" xml:"created_at"`
+}
+
+func Validate(w Webhook) error {
+	validator := validator.New()
+	if err := validator.Struct(w); err != nil {
+		return err
+	}
+	for _, eventType := range w.EventTypes {
+		if !slices.Contains(EventTypes, eventType) {
+			return fmt.Errorf("%w %q", ErrUnknownEventType, eventType)
+		}
+	}
+	return nil
+}
+
+type WebhookService struct {
+	db     *postgres.Db
+	log    *zerolog.Logger
+	cfg    Config
+	client *http.Client
+	// wake shortens the wait of the delivery worker when deliveries were queued
+	wake chan struct{}
+}
+
+func NewWebhookService(db *postgres.Db, log *zerolog.Logger, cfg Config) *WebhookService {
+	cfg = cfg.withDefaults()
+	return &WebhookService{
+		db:     db,
+		log:    log,
+		cfg:    cfg,
+		client: newClient(cfg),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+func (s *WebhookService) RouteAdder() func(e *echo.Echo) {
+	return func(e *echo.Echo) {
+		e.POST("/admin/webhooks", func(c echo.Context) error {
+			var newWebhook Webhook
+			if err := rest.Bind(c, &newWebhook); err != nil {
+				s.log.Error().Err(err).Msg("Failed to bind webhook")
+				return err
+			}
+
+			created, err := s.CreateWebhook(c.Request().Context(), newWebhook)
+			if err != nil {
+				s.log.Error().Err(err).Msg("Failed to create webhook")
+				return webhookError(err, "Failed to create webhook")
+			}
+			return rest.Respond(c, http.StatusCreated, created)
+		}, rest.Require(auth.PermWebhookManage))
+
+		e.GET("/admin/webhooks", func(c echo.Context) error {
+			webhooks, err := s.ListWebhooks(c.Request().Context())
+			if err != nil {
+				s.log.Error().Err(err).Msg("Failed to list webhooks")
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list webhooks"})
+			}
+			return rest.Respond(c, http.StatusOK, webhooks)
+		}, rest.Require(auth.PermWebhookManage))
+
+		e.GET("/admin/webhooks/:id", func(c echo.Context) error {
+			id, err := uuid.Parse(c.Param("id"))
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid webhook ID"})
+			}
+
+			webhook, err := s.GetWebhookByID(c.Request().Context(), id)
+			if err != nil {
+				s.log.Error().Err(err).Msg("Failed to retrieve webhook")
+				return webhookError(err, "Failed to retrieve webhook")
+			}
+			return rest.Respond(c, http.StatusOK, webhook)
+		}, rest.Require(auth.PermWebhookManage))
+
+		e.PUT("/admin/webhooks/:id", func(c echo.Context) error {
+			id, err := uuid.Parse(c.Param("id"))
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid webhook ID"})
+			}
+
+			var updatedWebhook Webhook
+			if err := rest.Bind(c, &updatedWebhook); err != nil {
+				s.log.Error().Err(err).Msg("Invalid request body")
+				return err
+			}
+			updatedWebhook.ID = id
+
+			webhook, err := s.UpdateWebhook(c.Request().Context(), updatedWebhook)
+			if err != nil {
+				s.log.Error().Err(err).Msg("Failed to update webhook")
+				return webhookError(err, "Failed to update webhook")
+			}
+			return rest.Respond(c, http.StatusOK, webhook)
+		}, rest.Require(auth.PermWebhookManage))
+
+		e.DELETE("/admin/webhooks/:id", func(c echo.Context) error {
+			id, err := uuid.Parse(c.Param("id"))
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid webhook ID"})
+			}
+
+			if err := s.DeleteWebhook(c.Request().Context(), id); err != nil {
+				s.log.Error().Err(err).Msg("Failed to delete webhook")
+				return webhookError(err, "Failed to delete webhook")
+			}
+			return c.NoContent(http.StatusNoContent)
+		}, rest.Require(auth.PermWebhookManage))
+
+		s.addDeliveryRoutes(e)
+	}
+}
+
+// webhookError maps service errors like rest.ServiceError, unknown event types and forbidden
+// URLs are invalid too.
+func webhookError(err error, failed string) error {
+	if errors.Is(err, ErrUnknownEventType) || errors.Is(err, ErrForbiddenURL) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	return rest.ServiceError(err, "Webhook not found", failed)
+}
+
+// CreateWebhook stores a subscription, a missing secret is generated.
+func (s *WebhookService) CreateWebhook(ctx context.Context, webhook Webhook) (*Webhook, error) {
+	if webhook.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			return nil, err
+		}
+		webhook.Secret = secret
+	}
+	if err := Validate(webhook); err != nil {
+		return nil, err
+	}
+	if err := s.checkURL(ctx, webhook.URL); err != nil {
+		return nil, err
+	}
+
+	// tenant_id defaults to the tenant of the transaction
+	webhook.ID = uuid.New()
+	webhook.Active = true
+	err := s.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		return tx.QueryRowContext(ctx,
+			"insert into webhooks (id, url, event_types, secret) values ($1, $2, $3, $4) returning created_at;",
+			webhook.ID, webhook.URL, webhook.EventTypes, webhook.Secret).Scan(&webhook.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (s *WebhookService) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	webhooks, err := postgres.InTenantResult(ctx, s.db, func(tx *sqlx.Tx) ([]Webhook, error) {
+		return postgres.QueryList[Webhook](ctx, tx,
+			"select id, url, event_types, active, created_at from webhooks where tenant_id=current_tenant() order by created_at")
+	})
+	if webhooks == nil {
+		webhooks = []Webhook{}
+	}
+	return webhooks, err
+}
+
+func (s *WebhookService) GetWebhookByID(ctx context.Context, id uuid.UUID) (*Webhook, error) {
+	return postgres.InTenantResult(ctx, s.db, func(tx *sqlx.Tx) (*Webhook, error) {
+		return postgres.QueryOne[Webhook](ctx, tx,
+			"select id, url, event_types, active, created_at from webhooks where id=$1 and tenant_id=current_tenant()", id)
+	})
+}
+
+// UpdateWebhook changes URL, event types and the active flag; a given secret replaces the old one.
+func (s *WebhookService) UpdateWebhook(ctx context.Context, webhook Webhook) (*Webhook, error) {
+	if err := Validate(webhook); err != nil {
+		return nil, err
+	}
+	if err := s.checkURL(ctx, webhook.URL); err != nil {
+		return nil, err
+	}
+
+	err := s.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"update webhooks set url=$1, event_types=$2, active=$3, secret=coalesce(nullif($4, ''), secret) where id=$5 and tenant_id=current_tenant();",
+			webhook.URL, webhook.EventTypes, webhook.Active, webhook.Secret, webhook.ID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return postgres.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetWebhookByID(ctx, webhook.ID)
+}
+
+func (s *WebhookService) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	return s.db.InTenant(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "delete from webhooks where id=$1 and tenant_id=current_tenant();", id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return postgres.ErrNoRows
+		}
+		return nil
+	})
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,245 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/romanWienicke/go-app-test/foundation/money"
+	"github.com/romanWienicke/go-app-test/foundation/postgres"
+	test "github.com/romanWienicke/go-app-test/foundation/testing"
+	"github.com/romanWienicke/go-app-test/service/customer"
+	"github.com/romanWienicke/go-app-test/service/order"
+	"github.com/romanWienicke/go-app-test/service/product"
+	"github.com/rs/zerolog"
+)
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	now := time.Now()
+	header := http.Header{}
+	header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	header.Set(HeaderSignature, Sign("secret-secret-secret", now, body))
+
+	if err := Verify("secret-secret-secret", header, body, time.Minute); err != nil {
+		t.Errorf("expected a valid signature: %v", err)
+	}
+	if err := Verify("another-secret-value", header, body, time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected the wrong secret to fail, got %v", err)
+	}
+	if err := Verify("secret-secret-secret", header, []byte(`{"id":"2"}`), time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected a tampered body to fail, got %v", err)
+	}
+
+	old := now.Add(-time.Hour)
+	header.Set(HeaderTimestamp, strconv.FormatInt(old.Unix(), 10))
+	header.Set(HeaderSignature, Sign("secret-secret-secret", old, body))
+	if err := Verify("secret-secret-secret", header, body, time.Minute); !errors.Is(err, ErrExpiredTimestamp) {
+		t.Errorf("expected a replayed delivery to fail, got %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := Config{BackoffBase: time.Second, BackoffMax: 10 * time.Second}.withDefaults()
+	for attempts, want := range map[int]time.Duration{
+		1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 50: 10 * time.Second,
+	} {
+		if got := cfg.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	webhook := Webhook{URL: "https://partner.example.com/hook", EventTypes: []string{order.EventCreated}}
+	if err := Validate(webhook); err != nil {
+		t.Errorf("expected a valid webhook: %v", err)
+	}
+	webhook.EventTypes = []string{"order.deleted"}
+	if err := Validate(webhook); !errors.Is(err, ErrUnknownEventType) {
+		t.Errorf("expected an unknown event type, got %v", err)
+	}
+	webhook.EventTypes = []string{order.EventCreated}
+	webhook.URL = "ftp://partner.example.com"
+	if err := Validate(webhook); err == nil {
+		t.Error("expected an invalid URL to fail")
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	log := zerolog.Nop()
+	tests := map[string]struct {
+		cfg     Config
+		url     string
+		allowed bool
+	}{
+		"public https":                  {url: "https://203.0.113.10/hook", allowed: true},
+		"plain http":                    {url: "http://203.0.113.10/hook"},
+		"plain http allowed":            {cfg: Config{AllowHTTP: true}, url: "http://203.0.113.10/hook", allowed: true},
+		"loopback":                      {url: "https://127.0.0.1/hook"},
+		"localhost":                     {url: "https://localhost:8443/hook"},
+		"private":                       {url: "https://10.1.2.3/hook"},
+		"link-local metadata":           {url: "https://169.254.169.254/latest/meta-data"},
+		"ipv4-mapped loopback":          {url: "https://[::ffff:127.0.0.1]/hook"},
+		"ipv6 unique local":             {url: "https://[fd00::1]/hook"},
+		"shared address space":          {url: "https://100.64.0.1/hook"},
+		"private networks allowed":      {cfg: Config{AllowPrivateNetworks: true}, url: "https://10.1.2.3/hook", allowed: true},
+		"plain http to private allowed": {cfg: Config{AllowHTTP: true, AllowPrivateNetworks: true}, url: "http://127.0.0.1:8080/hook", allowed: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := NewWebhookService(nil, &log, tc.cfg)
+			err := s.checkURL(context.Background(), tc.url)
+			if tc.allowed && err != nil {
+				t.Errorf("expected %s to be allowed: %v", tc.url, err)
+			}
+			if !tc.allowed && !errors.Is(err, ErrForbiddenURL) {
+				t.Errorf("expected %s to be forbidden, got %v", tc.url, err)
+			}
+		})
+	}
+}
+
+func TestClientRefusesInternalAddresses(t *testing.T) {
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer partner.Close()
+
+	// the URL passed the check while its host resolved elsewhere, the dialer checks again
+	_, err := newClient(Config{Timeout: time.Second}).Get(partner.URL)
+	if !errors.Is(err, ErrForbiddenURL) {
+		t.Errorf("expected the loopback partner to be refused, got %v", err)
+	}
+	res, err := newClient(Config{Timeout: time.Second, AllowPrivateNetworks: true}).Get(partner.URL)
+	if err != nil {
+		t.Fatalf("expected private networks to be allowed: %v", err)
+	}
+	_ = res.Body.Close()
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	test.SetEnv(t, "../../.env")
+	dc := test.DockerComposeUp(t, "../../docker-compose.yaml", "postgres")
+	test.SetupDatabaseEnv(t, dc["postgres"])
+	db := test.InitPostgres(t, "../../migrations")
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Failed to close db: %v", err)
+		}
+	}()
+
+	t.Cleanup(func() {
+		t.Helper()
+		test.DockerComposeDown(t, "../../docker-compose.yaml")
+	})
+	log := zerolog.Nop()
+	ctx := postgres.WithTenant(context.Background(), "default")
+
+	// the partner fails the first delivery and accepts the retry
+	received := make(chan *http.Request, 2)
+	var calls int
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify("partner-secret-value", r.Header, body, time.Minute); err != nil {
+			t.Errorf("Invalid signature: %v", err)
+		}
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- r
+	}))
+	defer partner.Close()
+
+	webhookService := NewWebhookService(db, &log, Config{BackoffBase: time.Millisecond, MaxAttempts: 3,
+		AllowHTTP: true, AllowPrivateNetworks: true})
+	webhook, err := webhookService.CreateWebhook(ctx, Webhook{
+		URL:        partner.URL,
+		EventTypes: []string{order.EventCreated},
+		Secret:     "partner-secret-value",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	customerID, err := customer.NewCustomerService(db, &log).CreateCustomer(ctx, customer.Customer{
+		Name:  "Test Customer",
+		Email: "webhook@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create customer: %v", err)
+	}
+	productID, err := product.NewProductService(db, &log).CreateProduct(ctx, product.Product{
+		Name:  "Test Product",
+		Price: money.New(2499, "EUR"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	orderService := order.NewOrderService(db, &log)
+	orderService.SetNotifier(webhookService)
+	orderID, err := orderService.CreateOrder(ctx, order.Order{
+		CustomerID: customerID,
+		Status:     "pending",
+		Total:      money.New(2499, "EUR"),
+		Items:      []order.OrderItem{{ProductID: productID, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	deliveries, err := webhookService.ListDeliveries(ctx, webhook.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].EventType != order.EventCreated {
+		t.Fatalf("Expected one queued delivery, got %+v", deliveries)
+	}
+	var event struct {
+		ID   uuid.UUID   `json:"id"`
+		Data order.Order `json:"data"`
+	}
+	if err := json.Unmarshal(deliveries[0].Payload, &event); err != nil {
+		t.Fatalf("Invalid payload: %v", err)
+	}
+	if event.ID != deliveries[0].ID || event.Data.ID != orderID {
+		t.Errorf("Unexpected payload %s", deliveries[0].Payload)
+	}
+
+	if _, err := webhookService.DeliverDue(ctx); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := webhookService.DeliverDue(ctx); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+
+	select {
+	case r := <-received:
+		if r.Header.Get(HeaderID) != deliveries[0].ID.String() {
+			t.Errorf("Unexpected delivery ID %s", r.Header.Get(HeaderID))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The retry was not delivered")
+	}
+
+	delivery, err := webhookService.GetDelivery(ctx, webhook.ID, deliveries[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to retrieve delivery: %v", err)
+	}
+	if delivery.Status != StatusDelivered || delivery.Attempts != 2 || len(delivery.AttemptLog) != 2 {
+		t.Errorf("Expected a delivery after two attempts, got %+v", delivery)
+	}
+	if code := delivery.AttemptLog[0].StatusCode; code == nil || *code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the first attempt to log 503, got %v", code)
+	}
+}
@@ -17,6 +17,7 @@ import (
 type TestCase struct {
 	Method              string
 	Path                string
+	Headers             map[string]string
 	Payload             any
 	ExpectedCode        int
 	ExpectedBody        any
@@ -28,6 +29,7 @@ type WebTest struct {
 	client  *http.Client
 	baseURL string
 	bag     map[string]string
+	headers map[string]string
 }
 
 type ResponseWithTime struct {
@@ -43,12 +45,22 @@ func NewWebTest(port string) *WebTest {
 	url := fmt.Sprintf("http://localhost:%s/", port)
 	bag := make(map[string]string)
 
-	return &WebTest{port: port, client: client, baseURL: url, bag: bag}
+	return &WebTest{port: port, client: client, baseURL: url, bag: bag, headers: make(map[string]string)}
+}
+
+// SetHeader sets a header sent with every request, test case headers take precedence.
+func (app *WebTest) SetHeader(name, value string) {
+	app.headers[name] = value
+}
+
+// SetBearerToken authenticates every request with the token.
+func (app *WebTest) SetBearerToken(token string) {
+	app.SetHeader("Authorization", "Bearer "+token)
 }
 
 func (app *WebTest) RunTest(t *testing.T, tc TestCase) time.Duration {
 	url := app.baseURL + strings.TrimPrefix(tc.Path, "/")
-	resp := app.request(t, url, tc.Method, tc.Payload)
+	resp := app.request(t, url, tc.Method, tc.Headers, tc.Payload)
 	if tc.ExpectedBodyPattern != "" {
 		app.expectRegex(t, resp, tc.ExpectedCode, tc.ExpectedBodyPattern)
 	} else {
@@ -77,7 +89,7 @@ func (app *WebTest) replaceBagValue(t *testing.T, target string, isRegex bool) s
 	return target
 }
 
-func (app *WebTest) request(t *testing.T, url, method string, payload any) *ResponseWithTime {
+func (app *WebTest) request(t *testing.T, url, method string, headers map[string]string, payload any) *ResponseWithTime {
 	client := app.client
 
 	url = app.replaceBagValue(t, url, false)
@@ -105,6 +117,7 @@ func (app *WebTest) request(t *testing.T, url, method string, payload any) *Resp
 			t.Errorf("Failed to create request: %v", err)
 		}
 		req.Header.Set("Content-Type", contentType)
+		app.setHeaders(t, req, headers)
 
 		sw := stopwatch.Stopwatch{}
 		sw.Start()
@@ -121,6 +134,7 @@ func (app *WebTest) request(t *testing.T, url, method string, payload any) *Resp
 	if err != nil {
 		t.Errorf("Failed to create request: %v", err)
 	}
+	app.setHeaders(t, req, headers)
 	stopwatch := stopwatch.Stopwatch{}
 	stopwatch.Start()
 	resp, err := client.Do(req)
@@ -132,6 +146,15 @@ func (app *WebTest) request(t *testing.T, url, method string, payload any) *Resp
 	return &ResponseWithTime{Response: resp, Elapsed: stopwatch.Elapsed()}
 }
 
+func (app *WebTest) setHeaders(t *testing.T, req *http.Request, headers map[string]string) {
+	for name, value := range app.headers {
+		req.Header.Set(name, app.replaceBagValue(t, value, false))
+	}
+	for name, value := range headers {
+		req.Header.Set(name, app.replaceBagValue(t, value, false))
+	}
+}
+
 func (app *WebTest) expectRegex(t *testing.T, resp *ResponseWithTime, expectedStatus int, expectedBodyPattern string) {
 	if resp.Response.StatusCode != expectedStatus {
 		t.Errorf("Expected status %d, got %d", expectedStatus, resp.Response.StatusCode)